@@ -0,0 +1,58 @@
+package auth
+
+import (
+	"context"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jperdior/chatbot-kit/domain"
+	"github.com/jperdior/chatbot-kit/domain/user"
+)
+
+// ErrNoSecurityContext is returned when a context carries no security context.
+var ErrNoSecurityContext = domain.NewUnauthorizedError("no security context in context", "authentication.required")
+
+type securityContextKey struct{}
+
+type tokenKey struct{}
+
+// WithSecurityContext returns a copy of ctx carrying the security context, and the user ID of a
+// user security context for user.UserIDFromContext. Any other security context hides the user ID
+// ctx carried.
+func WithSecurityContext(ctx context.Context, securityContext SecurityContext) context.Context {
+	var userID *user.UserID
+	if userSecurityContext, ok := securityContext.(*UserSecurityContext); ok {
+		userID = userSecurityContext.ID
+	}
+	ctx = user.ContextWithUserID(ctx, userID)
+	return context.WithValue(ctx, securityContextKey{}, securityContext)
+}
+
+// FromContext returns the security context carried by ctx, or by the request of a *gin.Context,
+// or ErrNoSecurityContext.
+func FromContext(ctx context.Context) (SecurityContext, error) {
+	securityContext, ok := requestContext(ctx).Value(securityContextKey{}).(SecurityContext)
+	if !ok || securityContext == nil {
+		return nil, ErrNoSecurityContext
+	}
+	return securityContext, nil
+}
+
+// WithToken returns a copy of ctx carrying the token the security context was built from.
+func WithToken(ctx context.Context, token string) context.Context {
+	return context.WithValue(ctx, tokenKey{}, token)
+}
+
+// TokenFromContext returns the token carried by ctx, or by the request of a *gin.Context.
+func TokenFromContext(ctx context.Context) (string, bool) {
+	token, ok := requestContext(ctx).Value(tokenKey{}).(string)
+	return token, ok && token != ""
+}
+
+// requestContext returns the context of the request of a *gin.Context, which the authentication
+// middlewares complete but gin only falls back to with ContextWithFallback.
+func requestContext(ctx context.Context) context.Context {
+	if c, ok := ctx.(*gin.Context); ok && c.Request != nil {
+		return c.Request.Context()
+	}
+	return ctx
+}
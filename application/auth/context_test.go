@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jperdior/chatbot-kit/domain/user"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSecurityContextKeys(t *testing.T) {
+	agent := newTestUser("agent")
+
+	t.Run("Security contexts are found with their user ID", func(t *testing.T) {
+		ctx := WithSecurityContext(context.Background(), agent)
+
+		found, err := FromContext(ctx)
+		require.NoError(t, err)
+		userID, err := user.UserIDFromContext(ctx)
+		require.NoError(t, err)
+
+		assert.Equal(t, agent, found)
+		assert.Equal(t, agent.ID, userID)
+	})
+
+	t.Run("Client security contexts hide the user ID", func(t *testing.T) {
+		ctx := WithSecurityContext(WithSecurityContext(context.Background(), agent), NewClientSecurityContext("bot", "Support bot"))
+
+		_, err := user.UserIDFromContext(ctx)
+
+		assert.ErrorIs(t, err, user.ErrNoUserID)
+	})
+
+	t.Run("Contexts without security context fail instead of panicking", func(t *testing.T) {
+		ctx := context.WithValue(context.Background(), "securityContext", agent)
+
+		_, err := FromContext(ctx)
+		_, nilErr := FromContext(WithSecurityContext(context.Background(), nil))
+
+		assert.ErrorIs(t, err, ErrNoSecurityContext)
+		assert.ErrorIs(t, nilErr, ErrNoSecurityContext)
+		assert.Nil(t, NewJWTSecurityProvider().GetSecurityContext(ctx))
+	})
+
+	t.Run("Tokens are found only when set", func(t *testing.T) {
+		token, ok := TokenFromContext(WithToken(context.Background(), "token"))
+		_, missing := TokenFromContext(context.Background())
+
+		assert.True(t, ok)
+		assert.Equal(t, "token", token)
+		assert.False(t, missing)
+	})
+
+	t.Run("Gin contexts are read through their request", func(t *testing.T) {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest("GET", "/status", nil)
+		c.Request = c.Request.WithContext(WithToken(WithSecurityContext(c.Request.Context(), agent), "token"))
+
+		found, err := FromContext(c)
+		require.NoError(t, err)
+		token, ok := TokenFromContext(c)
+
+		assert.Equal(t, agent, found)
+		assert.Equal(t, agent, NewJWTSecurityProvider().GetSecurityContext(c))
+		assert.True(t, ok)
+		assert.Equal(t, "token", token)
+	})
+
+	t.Run("Gin contexts without a request have no security context", func(t *testing.T) {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+
+		_, err := FromContext(c)
+
+		assert.ErrorIs(t, err, ErrNoSecurityContext)
+	})
+}
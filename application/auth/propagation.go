@@ -0,0 +1,179 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	domain "github.com/jperdior/chatbot-kit/domain/user"
+)
+
+// Bus message metadata entries carrying the security context of the actor who sent the message.
+const (
+	MetadataActorType     = "actor_type"
+	MetadataActorID       = "actor_id"
+	MetadataActorName     = "actor_name"
+	MetadataActorTenantID = "actor_tenant_id"
+	MetadataActorRoles    = "actor_roles"
+	MetadataActorScopes   = "actor_scopes"
+	MetadataActorToken    = "actor_token"
+	// MetadataSentAt is the RFC 3339 time the message carrying a token was sent.
+	MetadataSentAt = "sent_at"
+)
+
+var (
+	// ErrUntrustedActor is returned when a trust policy rejects the actor of a message.
+	ErrUntrustedActor = errors.New("auth: untrusted actor in message metadata")
+	// ErrUntrustedTenant is returned when a message asserts a tenant no trust policy vouches for.
+	ErrUntrustedTenant = errors.New("auth: untrusted tenant in message metadata")
+)
+
+// SecurityContextMetadata returns the metadata entries describing the security context, and the
+// token with the time it is sent when not empty.
+func SecurityContextMetadata(securityContext SecurityContext, token string) map[string]string {
+	metadata := map[string]string{
+		MetadataActorType:     string(securityContext.Type()),
+		MetadataActorID:       securityContext.GetIdentifier(),
+		MetadataActorTenantID: securityContext.GetTenantID(),
+	}
+	switch s := securityContext.(type) {
+	case *UserSecurityContext:
+		metadata[MetadataActorName] = s.Email
+		metadata[MetadataActorRoles] = strings.Join(s.Roles, " ")
+		metadata[MetadataActorScopes] = strings.Join(s.Scopes, " ")
+	case *ClientSecurityContext:
+		metadata[MetadataActorName] = s.ClientName
+		metadata[MetadataActorScopes] = strings.Join(s.Scopes, " ")
+	}
+	if token != "" {
+		metadata[MetadataActorToken] = token
+		metadata[MetadataSentAt] = time.Now().UTC().Format(time.RFC3339Nano)
+	}
+	return metadata
+}
+
+// SecurityContextFromMetadata rebuilds the security context asserted by the metadata entries,
+// nil when they carry none. It does not verify anything, see TrustPolicy.
+func SecurityContextFromMetadata(metadata map[string]string) (SecurityContext, error) {
+	switch SecurityContextType(metadata[MetadataActorType]) {
+	case "":
+		return nil, nil
+	case UserSecurityContextType:
+		userID, err := domain.NewUserID(metadata[MetadataActorID])
+		if err != nil {
+			return nil, err
+		}
+		securityContext := NewUserSecurityContext(userID, metadata[MetadataActorName], strings.Fields(metadata[MetadataActorRoles]))
+		securityContext.TenantID = metadata[MetadataActorTenantID]
+		securityContext.Scopes = strings.Fields(metadata[MetadataActorScopes])
+		return securityContext, nil
+	case ClientSecurityContextType:
+		if metadata[MetadataActorID] == "" {
+			return nil, ErrUntrustedActor
+		}
+		securityContext := NewClientSecurityContext(metadata[MetadataActorID], metadata[MetadataActorName])
+		securityContext.TenantID = metadata[MetadataActorTenantID]
+		securityContext.Scopes = strings.Fields(metadata[MetadataActorScopes])
+		return securityContext, nil
+	default:
+		return nil, ErrUntrustedActor
+	}
+}
+
+// TrustPolicy decides which security context, if any, the handlers of a consumed message run with.
+// A nil security context runs them anonymously, an error rejects the message.
+type TrustPolicy interface {
+	Restore(ctx context.Context, metadata map[string]string) (SecurityContext, error)
+}
+
+// TrustPolicyFunc is an adapter to allow the use of ordinary functions as trust policies.
+type TrustPolicyFunc func(ctx context.Context, metadata map[string]string) (SecurityContext, error)
+
+func (f TrustPolicyFunc) Restore(ctx context.Context, metadata map[string]string) (SecurityContext, error) {
+	return f(ctx, metadata)
+}
+
+// TenantTrustPolicy is a trust policy which may also vouch for the tenant asserted by the metadata
+// of the messages whose actor has none. Without it, such messages are rejected.
+type TenantTrustPolicy interface {
+	TrustPolicy
+	TrustsTenant() bool
+}
+
+type tenantTrustPolicy struct {
+	TrustPolicy
+}
+
+func (tenantTrustPolicy) TrustsTenant() bool {
+	return true
+}
+
+// TrustTenant returns the trust policy also vouching for the tenant asserted by the metadata of
+// the messages whose actor has none, e.g. TrustTenant(TrustNone) for anonymous messages. It is
+// only safe when nobody but the trusted services can publish to the broker.
+func TrustTenant(policy TrustPolicy) TenantTrustPolicy {
+	return tenantTrustPolicy{TrustPolicy: policy}
+}
+
+// TrustNone runs the handlers of every message anonymously.
+var TrustNone = TrustPolicyFunc(func(context.Context, map[string]string) (SecurityContext, error) {
+	return nil, nil
+})
+
+// TrustAsserted restores the security context and the tenant asserted by the metadata as is. It
+// is only safe when nobody but the trusted services can publish to the broker.
+var TrustAsserted = TrustTenant(TrustPolicyFunc(func(_ context.Context, metadata map[string]string) (SecurityContext, error) {
+	return SecurityContextFromMetadata(metadata)
+}))
+
+// TokenVerifier returns the security context of a token valid at the given time, implemented by
+// token.Verifier for the tokens of the kit.
+type TokenVerifier interface {
+	Verify(ctx context.Context, token string, at time.Time) (SecurityContext, error)
+}
+
+// TrustToken restores the security context from the original token travelling with the message,
+// verified again by the verifier. Messages asserting an actor without a token, or another actor
+// type or ID than the token, are rejected; messages without an actor run anonymously.
+//
+// Messages may wait in a queue longer than their token lives, so the token is verified as of the
+// time the message was sent, found in MetadataSentAt. As that time is asserted by the sender, it
+// is not trusted further back than maxDelay: a token expiring during an outage longer than
+// maxDelay is rejected, and so is its message, left to the dead-letter exchange of the queue.
+func TrustToken(verifier TokenVerifier, maxDelay time.Duration) TrustPolicy {
+	return TrustPolicyFunc(func(ctx context.Context, metadata map[string]string) (SecurityContext, error) {
+		token := metadata[MetadataActorToken]
+		if token == "" {
+			if metadata[MetadataActorType] != "" {
+				return nil, ErrUntrustedActor
+			}
+			return nil, nil
+		}
+		securityContext, err := verifier.Verify(ctx, token, verificationTime(metadata[MetadataSentAt], maxDelay))
+		if err != nil {
+			return nil, errors.Join(ErrUntrustedActor, err)
+		}
+		if actorType, ok := metadata[MetadataActorType]; ok && SecurityContextType(actorType) != securityContext.Type() {
+			return nil, ErrUntrustedActor
+		}
+		if actorID, ok := metadata[MetadataActorID]; ok && actorID != securityContext.GetIdentifier() {
+			return nil, ErrUntrustedActor
+		}
+		return securityContext, nil
+	})
+}
+
+// verificationTime returns the time a message was sent, bounded to the last maxDelay, or now when
+// the time is missing or malformed.
+func verificationTime(sentAt string, maxDelay time.Duration) time.Time {
+	now := time.Now()
+	at, err := time.Parse(time.RFC3339Nano, sentAt)
+	if err != nil || at.After(now) {
+		return now
+	}
+	if earliest := now.Add(-maxDelay); at.Before(earliest) {
+		return earliest
+	}
+	return at
+}
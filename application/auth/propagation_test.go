@@ -0,0 +1,195 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testToken struct {
+	securityContext SecurityContext
+	expiresAt       time.Time
+}
+
+type testTokenVerifier map[string]testToken
+
+func (v testTokenVerifier) Verify(_ context.Context, token string, at time.Time) (SecurityContext, error) {
+	verified, ok := v[token]
+	if !ok {
+		return nil, errors.New("invalid token")
+	}
+	if !at.Before(verified.expiresAt) {
+		return nil, errors.New("token expired")
+	}
+	return verified.securityContext, nil
+}
+
+func TestSecurityContextMetadata(t *testing.T) {
+	t.Run("Users round trip through the metadata", func(t *testing.T) {
+		agent := newTestUser("agent", "viewer")
+		agent.TenantID = "acme"
+		agent.Scopes = []string{"chats:read"}
+
+		metadata := SecurityContextMetadata(agent, "")
+		restored, err := SecurityContextFromMetadata(metadata)
+
+		require.NoError(t, err)
+		assert.Equal(t, agent, restored)
+		assert.NotContains(t, metadata, MetadataActorToken)
+		assert.NotContains(t, metadata, MetadataSentAt)
+	})
+
+	t.Run("Clients round trip through the metadata", func(t *testing.T) {
+		client := NewClientSecurityContext("bot", "Support bot")
+		client.TenantID = "acme"
+		client.Scopes = []string{"chats:write"}
+
+		metadata := SecurityContextMetadata(client, "token")
+		restored, err := SecurityContextFromMetadata(metadata)
+
+		require.NoError(t, err)
+		assert.Equal(t, client, restored)
+		assert.Equal(t, "token", metadata[MetadataActorToken])
+		sentAt, err := time.Parse(time.RFC3339Nano, metadata[MetadataSentAt])
+		require.NoError(t, err)
+		assert.WithinDuration(t, time.Now(), sentAt, time.Second)
+	})
+
+	t.Run("Metadata without actor restores no security context", func(t *testing.T) {
+		restored, err := SecurityContextFromMetadata(map[string]string{"tenant_id": "acme"})
+
+		require.NoError(t, err)
+		assert.Nil(t, restored)
+	})
+
+	t.Run("Unknown actor types are rejected", func(t *testing.T) {
+		_, err := SecurityContextFromMetadata(map[string]string{MetadataActorType: "robot", MetadataActorID: "1"})
+
+		assert.ErrorIs(t, err, ErrUntrustedActor)
+	})
+}
+
+func TestTrustPolicies(t *testing.T) {
+	ctx := context.Background()
+	agent := newTestUser("agent")
+	bot := NewClientSecurityContext("bot", "Support bot")
+	bot.Scopes = []string{"chats:write"}
+	expiresAt := time.Now().Add(time.Hour)
+	policy := TrustToken(testTokenVerifier{
+		"agent-token": {agent, expiresAt},
+		"bot-token":   {bot, expiresAt},
+	}, time.Hour)
+
+	t.Run("TrustNone runs messages anonymously", func(t *testing.T) {
+		restored, err := TrustNone.Restore(ctx, SecurityContextMetadata(agent, ""))
+
+		require.NoError(t, err)
+		assert.Nil(t, restored)
+	})
+
+	t.Run("Only tenant trust policies vouch for asserted tenants", func(t *testing.T) {
+		for name, policy := range map[string]TrustPolicy{"TrustNone": TrustNone, "TrustToken": policy} {
+			_, ok := policy.(TenantTrustPolicy)
+			assert.False(t, ok, name)
+		}
+		assert.True(t, TrustAsserted.TrustsTenant())
+		assert.True(t, TrustTenant(TrustNone).TrustsTenant())
+	})
+
+	t.Run("TrustAsserted restores the asserted actor", func(t *testing.T) {
+		restored, err := TrustAsserted.Restore(ctx, SecurityContextMetadata(bot, ""))
+
+		require.NoError(t, err)
+		assert.Equal(t, bot, restored)
+	})
+
+	t.Run("TrustToken restores the actor of the verified token", func(t *testing.T) {
+		restored, err := policy.Restore(ctx, SecurityContextMetadata(agent, "agent-token"))
+
+		require.NoError(t, err)
+		assert.Equal(t, agent, restored)
+	})
+
+	t.Run("TrustToken runs messages without actor anonymously", func(t *testing.T) {
+		restored, err := policy.Restore(ctx, map[string]string{})
+
+		require.NoError(t, err)
+		assert.Nil(t, restored)
+	})
+
+	tests := []struct {
+		name     string
+		metadata map[string]string
+	}{
+		{"An actor without token", SecurityContextMetadata(agent, "")},
+		{"An invalid token", SecurityContextMetadata(agent, "forged")},
+		{"Another actor than the token", SecurityContextMetadata(newTestUser("admin"), "agent-token")},
+		{"Another actor type than the token", map[string]string{
+			MetadataActorType: string(UserSecurityContextType), MetadataActorToken: "bot-token",
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run("TrustToken rejects "+tt.name, func(t *testing.T) {
+			_, err := policy.Restore(ctx, tt.metadata)
+
+			assert.ErrorIs(t, err, ErrUntrustedActor)
+		})
+	}
+}
+
+func TestTrustTokenSentAt(t *testing.T) {
+	ctx := context.Background()
+	agent := newTestUser("agent")
+	now := time.Now()
+	policy := TrustToken(testTokenVerifier{"expired-token": {agent, now.Add(-10 * time.Minute)}}, time.Hour)
+	sentAt := func(at time.Time) map[string]string {
+		metadata := SecurityContextMetadata(agent, "expired-token")
+		metadata[MetadataSentAt] = at.Format(time.RFC3339Nano)
+		return metadata
+	}
+
+	t.Run("Tokens are verified as of the time the message was sent", func(t *testing.T) {
+		restored, err := policy.Restore(ctx, sentAt(now.Add(-20*time.Minute)))
+
+		require.NoError(t, err)
+		assert.Equal(t, agent, restored)
+	})
+
+	t.Run("Messages sent after the token expired are rejected", func(t *testing.T) {
+		_, err := policy.Restore(ctx, sentAt(now.Add(-5*time.Minute)))
+
+		assert.ErrorIs(t, err, ErrUntrustedActor)
+	})
+
+	t.Run("Send times are not trusted further back than the maximum delay", func(t *testing.T) {
+		strict := TrustToken(testTokenVerifier{"expired-token": {agent, now.Add(-10 * time.Minute)}}, 5*time.Minute)
+
+		_, err := strict.Restore(ctx, sentAt(now.Add(-20*time.Minute)))
+
+		assert.ErrorIs(t, err, ErrUntrustedActor)
+	})
+
+	t.Run("Messages without a valid send time are verified as of now", func(t *testing.T) {
+		missing := SecurityContextMetadata(agent, "expired-token")
+		delete(missing, MetadataSentAt)
+		malformed := sentAt(now.Add(-20 * time.Minute))
+		malformed[MetadataSentAt] = "yesterday"
+
+		_, missingErr := policy.Restore(ctx, missing)
+		_, malformedErr := policy.Restore(ctx, malformed)
+
+		assert.ErrorIs(t, missingErr, ErrUntrustedActor)
+		assert.ErrorIs(t, malformedErr, ErrUntrustedActor)
+	})
+
+	t.Run("Send times in the future are verified as of now", func(t *testing.T) {
+		_, err := policy.Restore(ctx, sentAt(now.Add(time.Hour)))
+
+		assert.ErrorIs(t, err, ErrUntrustedActor)
+	})
+}
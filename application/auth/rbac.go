@@ -0,0 +1,294 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/jperdior/chatbot-kit/application/command"
+	"github.com/jperdior/chatbot-kit/application/query"
+	"github.com/jperdior/chatbot-kit/domain"
+	"gopkg.in/yaml.v3"
+)
+
+// Role grants permissions, plus the ones of the roles it inherits from: an admin role inheriting
+// from agent, itself inheriting from viewer, can do everything an agent and a viewer can.
+// A permission ending with "*" grants every permission starting with its prefix.
+type Role struct {
+	Name        string   `json:"name" yaml:"name"`
+	Permissions []string `json:"permissions" yaml:"permissions"`
+	Inherits    []string `json:"inherits,omitempty" yaml:"inherits,omitempty"`
+}
+
+// RoleSource provides the role definitions, e.g. from a configuration file or a database.
+type RoleSource interface {
+	Roles(ctx context.Context) ([]Role, error)
+}
+
+// RoleSourceFunc is an adapter to allow the use of ordinary functions as role sources.
+type RoleSourceFunc func(ctx context.Context) ([]Role, error)
+
+func (f RoleSourceFunc) Roles(ctx context.Context) ([]Role, error) {
+	return f(ctx)
+}
+
+// RBAC resolves the permissions granted by roles and by the OAuth scopes mapped with SetScopes.
+// Its definitions can be reloaded at runtime.
+// A nil RBAC grants no permission.
+type RBAC struct {
+	mu          sync.RWMutex
+	permissions map[string][]string
+	// ancestors holds every role a role inherits from, transitively.
+	ancestors map[string]map[string]struct{}
+	scopes    map[string][]string
+}
+
+func NewRBAC(roles []Role) (*RBAC, error) {
+	rbac := &RBAC{}
+	if err := rbac.Reload(roles); err != nil {
+		return nil, err
+	}
+	return rbac, nil
+}
+
+// Reload replaces the role definitions, failing on unknown parents and inheritance cycles.
+func (r *RBAC) Reload(roles []Role) error {
+	definitions := make(map[string]Role, len(roles))
+	for _, role := range roles {
+		definitions[role.Name] = role
+	}
+
+	permissions := make(map[string][]string, len(roles))
+	ancestors := make(map[string]map[string]struct{}, len(roles))
+	var resolve func(name string, visiting map[string]bool) ([]string, error)
+	resolve = func(name string, visiting map[string]bool) ([]string, error) {
+		if resolved, ok := permissions[name]; ok {
+			return resolved, nil
+		}
+		role, ok := definitions[name]
+		if !ok {
+			return nil, fmt.Errorf("rbac: unknown role %s", name)
+		}
+		if visiting[name] {
+			return nil, fmt.Errorf("rbac: inheritance cycle through role %s", name)
+		}
+		visiting[name] = true
+		defer delete(visiting, name)
+
+		granted := make(map[string]struct{})
+		for _, permission := range role.Permissions {
+			granted[permission] = struct{}{}
+		}
+		inheritedRoles := make(map[string]struct{})
+		for _, parent := range role.Inherits {
+			inherited, err := resolve(parent, visiting)
+			if err != nil {
+				return nil, err
+			}
+			for _, permission := range inherited {
+				granted[permission] = struct{}{}
+			}
+			inheritedRoles[parent] = struct{}{}
+			for ancestor := range ancestors[parent] {
+				inheritedRoles[ancestor] = struct{}{}
+			}
+		}
+		ancestors[name] = inheritedRoles
+
+		resolved := make([]string, 0, len(granted))
+		for permission := range granted {
+			resolved = append(resolved, permission)
+		}
+		sort.Strings(resolved)
+		permissions[name] = resolved
+		return resolved, nil
+	}
+	for name := range definitions {
+		if _, err := resolve(name, make(map[string]bool)); err != nil {
+			return err
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.permissions = permissions
+	r.ancestors = ancestors
+	return nil
+}
+
+// SetScopes replaces the permissions granted by each OAuth scope. Scopes are matched by their
+// exact name, unmapped scopes granting nothing.
+func (r *RBAC) SetScopes(scopes map[string][]string) {
+	mapped := make(map[string][]string, len(scopes))
+	for scope, permissions := range scopes {
+		mapped[scope] = slices.Clone(permissions)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.scopes = mapped
+}
+
+// Load reloads the role definitions from the source.
+func (r *RBAC) Load(ctx context.Context, source RoleSource) error {
+	roles, err := source.Roles(ctx)
+	if err != nil {
+		return err
+	}
+	return r.Reload(roles)
+}
+
+// Permissions returns the permissions granted by the roles, unknown roles granting none.
+func (r *RBAC) Permissions(roles ...string) []string {
+	if r == nil {
+		return []string{}
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	granted := make(map[string]struct{})
+	for _, role := range roles {
+		for _, permission := range r.permissions[role] {
+			granted[permission] = struct{}{}
+		}
+	}
+	permissions := make([]string, 0, len(granted))
+	for permission := range granted {
+		permissions = append(permissions, permission)
+	}
+	sort.Strings(permissions)
+	return permissions
+}
+
+// Can reports whether any of the roles grants the permission.
+func (r *RBAC) Can(roles []string, permission string) bool {
+	if r == nil {
+		return false
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, role := range roles {
+		for _, granted := range r.permissions[role] {
+			if permissionMatches(granted, permission) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// CanScopes reports whether any of the scopes is mapped to the permission, see SetScopes.
+func (r *RBAC) CanScopes(scopes []string, permission string) bool {
+	if r == nil {
+		return false
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, scope := range scopes {
+		for _, granted := range r.scopes[scope] {
+			if permissionMatches(granted, permission) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// HasRole reports whether any of the roles is the role or inherits from it.
+func (r *RBAC) HasRole(roles []string, role string) bool {
+	if slices.Contains(roles, role) {
+		return true
+	}
+	if r == nil {
+		return false
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, granted := range roles {
+		if _, ok := r.ancestors[granted][role]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Authorize returns a permission denied error unless the security context is granted the permission.
+func Authorize(securityContext SecurityContext, permission string) error {
+	if !securityContext.Can(permission) {
+		return NewPermissionDeniedError(permission)
+	}
+	return nil
+}
+
+func permissionMatches(granted, permission string) bool {
+	if prefix, ok := strings.CutSuffix(granted, "*"); ok {
+		return strings.HasPrefix(permission, prefix)
+	}
+	return granted == permission
+}
+
+// LoadRolesFS reads role definitions from a YAML or JSON file holding a list of roles.
+func LoadRolesFS(fsys fs.FS, name string) ([]Role, error) {
+	content, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	var roles []Role
+	if path.Ext(name) == ".json" {
+		err = json.Unmarshal(content, &roles)
+	} else {
+		err = yaml.Unmarshal(content, &roles)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("rbac: failed to parse %s: %w", name, err)
+	}
+	return roles, nil
+}
+
+// NewPermissionDeniedError is returned when the security context lacks a permission.
+func NewPermissionDeniedError(permission string) *domain.DomainError {
+	return domain.NewForbiddenError("permission "+permission+" is required", "permission.denied").
+		WithParam("permission", permission)
+}
+
+// CommandPermissionMiddleware rejects the commands whose type requires a permission the security
+// context of ctx lacks. Commands of types missing from permissions are let through.
+func CommandPermissionMiddleware(provider SecurityProvider, permissions map[command.Type]string) command.Middleware {
+	return func(next command.Handler) command.Handler {
+		return command.HandlerFunc(func(ctx context.Context, cmd command.Command) error {
+			if err := authorizePermission(ctx, provider, permissions, cmd.Type()); err != nil {
+				return err
+			}
+			return next.Handle(ctx, cmd)
+		})
+	}
+}
+
+// QueryPermissionMiddleware rejects the queries whose type requires a permission the security
+// context of ctx lacks. Queries of types missing from permissions are let through.
+func QueryPermissionMiddleware(provider SecurityProvider, permissions map[query.Type]string) query.Middleware {
+	return func(next query.Handler) query.Handler {
+		return query.HandlerFunc(func(ctx context.Context, qry query.Query) (interface{}, error) {
+			if err := authorizePermission(ctx, provider, permissions, qry.Type()); err != nil {
+				return nil, err
+			}
+			return next.Handle(ctx, qry)
+		})
+	}
+}
+
+func authorizePermission[T comparable](ctx context.Context, provider SecurityProvider, permissions map[T]string, messageType T) error {
+	permission, ok := permissions[messageType]
+	if !ok {
+		return nil
+	}
+	securityContext := provider.GetSecurityContext(ctx)
+	if securityContext == nil {
+		return domain.NewUnauthorizedError("authentication is required", "authentication.required")
+	}
+	return Authorize(securityContext, permission)
+}
@@ -0,0 +1,223 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"testing/fstest"
+
+	"github.com/jperdior/chatbot-kit/application/command"
+	"github.com/jperdior/chatbot-kit/application/query"
+	"github.com/jperdior/chatbot-kit/domain"
+	"github.com/jperdior/chatbot-kit/domain/user"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testRoles() []Role {
+	return []Role{
+		{Name: "viewer", Permissions: []string{"chats:read"}},
+		{Name: "agent", Permissions: []string{"chats:write"}, Inherits: []string{"viewer"}},
+		{Name: "admin", Permissions: []string{"users:*"}, Inherits: []string{"agent"}},
+		{Name: "root", Permissions: []string{"*"}},
+	}
+}
+
+func newTestUser(roles ...string) *UserSecurityContext {
+	return NewUserSecurityContext(user.NewRandomUserID(), "user@example.com", roles)
+}
+
+func TestRBAC(t *testing.T) {
+	rbac, err := NewRBAC(testRoles())
+	require.NoError(t, err)
+
+	t.Run("Roles grant the permissions they inherit transitively", func(t *testing.T) {
+		assert.Equal(t, []string{"chats:read", "chats:write", "users:*"}, rbac.Permissions("admin"))
+		assert.True(t, rbac.Can([]string{"admin"}, "chats:read"))
+		assert.False(t, rbac.Can([]string{"viewer"}, "chats:write"))
+	})
+
+	t.Run("Wildcards grant every permission with their prefix", func(t *testing.T) {
+		assert.True(t, rbac.Can([]string{"admin"}, "users:delete"))
+		assert.False(t, rbac.Can([]string{"admin"}, "billing:read"))
+		assert.True(t, rbac.Can([]string{"root"}, "billing:read"))
+	})
+
+	t.Run("Roles have the roles they inherit transitively", func(t *testing.T) {
+		assert.True(t, rbac.HasRole([]string{"admin"}, "viewer"))
+		assert.True(t, rbac.HasRole([]string{"ghost"}, "ghost"))
+		assert.False(t, rbac.HasRole([]string{"viewer"}, "agent"))
+		assert.False(t, rbac.HasRole([]string{"root"}, "viewer"))
+	})
+
+	t.Run("Users have the roles their permission resolver makes them inherit", func(t *testing.T) {
+		admin := newTestUser("admin")
+
+		assert.True(t, WithPermissions(admin, rbac).HasRoles([]string{"agent", "viewer"}))
+		assert.False(t, WithPermissions(admin, rbac).HasRole("root"))
+		assert.False(t, admin.HasRole("viewer"))
+	})
+
+	t.Run("Unknown roles grant nothing", func(t *testing.T) {
+		assert.Empty(t, rbac.Permissions("ghost"))
+		assert.False(t, rbac.Can([]string{"ghost"}, "chats:read"))
+	})
+
+	t.Run("Inheritance cycles are rejected", func(t *testing.T) {
+		for name, roles := range map[string][]Role{
+			"self":     {{Name: "a", Inherits: []string{"a"}}},
+			"indirect": {{Name: "a", Inherits: []string{"b"}}, {Name: "b", Inherits: []string{"c"}}, {Name: "c", Inherits: []string{"a"}}},
+		} {
+			_, err := NewRBAC(roles)
+
+			assert.ErrorContains(t, err, "inheritance cycle", name)
+		}
+	})
+
+	t.Run("Unknown parents are rejected", func(t *testing.T) {
+		_, err := NewRBAC([]Role{{Name: "a", Inherits: []string{"missing"}}})
+
+		assert.ErrorContains(t, err, "unknown role missing")
+	})
+
+	t.Run("A failed reload keeps the previous definitions", func(t *testing.T) {
+		reloaded, err := NewRBAC(testRoles())
+		require.NoError(t, err)
+
+		require.Error(t, reloaded.Reload([]Role{{Name: "a", Inherits: []string{"a"}}}))
+		require.NoError(t, reloaded.Load(context.Background(), RoleSourceFunc(func(context.Context) ([]Role, error) {
+			return []Role{{Name: "viewer", Permissions: []string{"reports:read"}}}, nil
+		})))
+
+		assert.Equal(t, []string{"reports:read"}, reloaded.Permissions("viewer"))
+	})
+
+	t.Run("A nil RBAC grants nothing", func(t *testing.T) {
+		var empty *RBAC
+
+		assert.False(t, WithPermissions(newTestUser("root"), empty).Can("chats:read"))
+		assert.Empty(t, empty.Permissions("root"))
+	})
+
+	t.Run("Users are granted the permissions of their roles", func(t *testing.T) {
+		assert.NoError(t, Authorize(WithPermissions(newTestUser("agent"), rbac), "chats:write"))
+		assert.ErrorIs(t, Authorize(WithPermissions(newTestUser("viewer"), rbac), "chats:write"), domain.ErrForbidden)
+	})
+
+	t.Run("Clients are granted the permissions mapped to their scopes", func(t *testing.T) {
+		scoped, err := NewRBAC(testRoles())
+		require.NoError(t, err)
+		scoped.SetScopes(map[string][]string{"chats": {"chats:read", "chats:write"}, "admin": {"users:*"}})
+		newClient := func(scopes ...string) *ClientSecurityContext {
+			client := NewClientSecurityContext("crm", "CRM")
+			client.Scopes = scopes
+			return client
+		}
+
+		assert.NoError(t, Authorize(WithPermissions(newClient("chats"), scoped), "chats:write"))
+		assert.NoError(t, Authorize(WithPermissions(newClient("admin"), scoped), "users:delete"))
+		assert.ErrorIs(t, Authorize(WithPermissions(newClient("chats"), scoped), "users:read"), domain.ErrForbidden)
+		assert.ErrorIs(t, Authorize(WithPermissions(newClient("chats:write"), scoped), "chats:write"), domain.ErrForbidden, "scopes are not permissions")
+		assert.ErrorIs(t, Authorize(WithPermissions(newClient("*"), scoped), "chats:write"), domain.ErrForbidden, "scopes are no wildcards")
+		assert.ErrorIs(t, Authorize(WithPermissions(newClient("chats"), rbac), "chats:read"), domain.ErrForbidden, "unmapped scopes grant nothing")
+		assert.ErrorIs(t, Authorize(newClient("chats"), "chats:read"), domain.ErrForbidden)
+	})
+
+	t.Run("The scopes of users narrow down the permissions of their roles", func(t *testing.T) {
+		scoped, err := NewRBAC(testRoles())
+		require.NoError(t, err)
+		scoped.SetScopes(map[string][]string{"chats.read": {"chats:read"}, "all": {"*"}})
+		newScopedUser := func(scopes ...string) SecurityContext {
+			user := newTestUser("agent")
+			user.Scopes = scopes
+			return WithPermissions(user, scoped)
+		}
+
+		assert.True(t, newScopedUser("chats.read").Can("chats:read"))
+		assert.False(t, newScopedUser("chats.read").Can("chats:write"))
+		assert.False(t, newScopedUser("unknown").Can("chats:read"))
+		assert.True(t, newScopedUser("all").Can("chats:write"))
+		assert.False(t, newScopedUser("all").Can("users:read"), "scopes grant nothing the roles do not")
+		assert.True(t, newScopedUser().Can("chats:write"))
+	})
+
+	t.Run("Users without a permission resolver are granted nothing", func(t *testing.T) {
+		assert.ErrorIs(t, Authorize(newTestUser("root"), "chats:read"), domain.ErrForbidden)
+	})
+
+	t.Run("WithPermissions leaves the original security context untouched", func(t *testing.T) {
+		original := newTestUser("agent")
+
+		resolved := WithPermissions(original, rbac)
+
+		assert.True(t, resolved.Can("chats:write"))
+		assert.False(t, original.Can("chats:write"))
+	})
+}
+
+func TestLoadRolesFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"roles.yaml": {Data: []byte("- name: viewer\n  permissions: [chats:read]\n- name: agent\n  permissions: [chats:write]\n  inherits: [viewer]\n")},
+		"roles.json": {Data: []byte(`[{"name": "viewer", "permissions": ["chats:read"]}]`)},
+		"bad.yaml":   {Data: []byte("name: [")},
+	}
+
+	t.Run("Reads YAML and JSON definitions", func(t *testing.T) {
+		fromYAML, err := LoadRolesFS(fsys, "roles.yaml")
+		require.NoError(t, err)
+		fromJSON, err := LoadRolesFS(fsys, "roles.json")
+		require.NoError(t, err)
+
+		assert.Equal(t, Role{Name: "agent", Permissions: []string{"chats:write"}, Inherits: []string{"viewer"}}, fromYAML[1])
+		assert.Equal(t, []Role{{Name: "viewer", Permissions: []string{"chats:read"}}}, fromJSON)
+	})
+
+	t.Run("Fails on invalid files", func(t *testing.T) {
+		_, err := LoadRolesFS(fsys, "bad.yaml")
+
+		assert.Error(t, err)
+	})
+}
+
+type testCommand string
+
+func (m testCommand) Type() command.Type {
+	return command.Type(m)
+}
+
+type testQuery string
+
+func (q testQuery) Type() query.Type {
+	return query.Type(q)
+}
+
+func TestPermissionMiddlewares(t *testing.T) {
+	rbac, err := NewRBAC(testRoles())
+	require.NoError(t, err)
+	provider := NewJWTSecurityProvider()
+	viewer := WithSecurityContext(context.Background(), WithPermissions(newTestUser("viewer"), rbac))
+
+	commandHandler := command.WithMiddlewares(command.HandlerFunc(func(context.Context, command.Command) error {
+		return nil
+	}), CommandPermissionMiddleware(provider, map[command.Type]string{"chat.close": "chats:write"}))
+	queryHandler := query.WithMiddlewares(query.HandlerFunc(func(context.Context, query.Query) (interface{}, error) {
+		return "ok", nil
+	}), QueryPermissionMiddleware(provider, map[query.Type]string{"chat.find": "chats:read", "user.find": "users:read"}))
+
+	t.Run("Commands require their permission", func(t *testing.T) {
+		assert.ErrorIs(t, commandHandler.Handle(viewer, testCommand("chat.close")), domain.ErrForbidden)
+		assert.NoError(t, commandHandler.Handle(WithSecurityContext(context.Background(), WithPermissions(newTestUser("agent"), rbac)), testCommand("chat.close")))
+		assert.ErrorIs(t, commandHandler.Handle(context.Background(), testCommand("chat.close")), domain.ErrUnauthorized)
+		assert.NoError(t, commandHandler.Handle(context.Background(), testCommand("chat.open")))
+	})
+
+	t.Run("Queries require their permission", func(t *testing.T) {
+		result, err := queryHandler.Handle(viewer, testQuery("chat.find"))
+		require.NoError(t, err)
+		_, deniedErr := queryHandler.Handle(viewer, testQuery("user.find"))
+		_, anonymousErr := queryHandler.Handle(context.Background(), testQuery("chat.find"))
+
+		assert.Equal(t, "ok", result)
+		assert.ErrorIs(t, deniedErr, domain.ErrForbidden)
+		assert.ErrorIs(t, anonymousErr, domain.ErrUnauthorized)
+	})
+}
@@ -1,6 +1,8 @@
 package auth
 
 import (
+	"slices"
+
 	domain "github.com/jperdior/chatbot-kit/domain/user"
 )
 
@@ -9,33 +11,86 @@ type SecurityContextType string
 type SecurityContext interface {
 	Type() SecurityContextType
 	GetIdentifier() string
+	GetTenantID() string
 	HasRole(role string) bool
 	HasRoles(roles []string) bool
+	HasScope(scope string) bool
+	HasScopes(scopes []string) bool
+	// Can reports whether the permission is granted.
+	Can(permission string) bool
+}
+
+// PermissionResolver resolves the permissions granted by roles, implemented by RBAC.
+type PermissionResolver interface {
+	Can(roles []string, permission string) bool
+}
+
+// ScopeResolver resolves the permissions granted by OAuth scopes, implemented by RBAC. Scopes
+// grant no permission through a permission resolver not implementing it.
+type ScopeResolver interface {
+	CanScopes(scopes []string, permission string) bool
+}
+
+// RoleHierarchy resolves the roles inherited from other roles, implemented by RBAC. A permission
+// resolver implementing it makes HasRole and HasRoles honor the inheritance.
+type RoleHierarchy interface {
+	HasRole(roles []string, role string) bool
+}
+
+// WithPermissions returns a copy of the security context resolving the permissions of its roles
+// and scopes through resolver. Other security contexts are returned as is.
+func WithPermissions(securityContext SecurityContext, resolver PermissionResolver) SecurityContext {
+	switch original := securityContext.(type) {
+	case *UserSecurityContext:
+		resolved := *original
+		resolved.Permissions = resolver
+		return &resolved
+	case *ClientSecurityContext:
+		resolved := *original
+		resolved.Permissions = resolver
+		return &resolved
+	default:
+		return securityContext
+	}
+}
+
+func scopesCan(resolver PermissionResolver, scopes []string, permission string) bool {
+	scopeResolver, ok := resolver.(ScopeResolver)
+	return ok && scopeResolver.CanScopes(scopes, permission)
 }
 
 const UserSecurityContextType SecurityContextType = "user"
 
 type UserSecurityContext struct {
-	ID    *domain.UserID
-	Email string
-	Roles []string
+	ID       *domain.UserID
+	Email    string
+	Roles    []string
+	TenantID string
+	Scopes   []string
+	// Permissions resolves the permissions of Roles, none being granted without it, and the roles
+	// they inherit when it is a RoleHierarchy.
+	Permissions PermissionResolver
 }
 
 func (t *UserSecurityContext) GetIdentifier() string {
 	return t.ID.String()
 }
 
+func (t *UserSecurityContext) GetTenantID() string {
+	return t.TenantID
+}
+
 func (t *UserSecurityContext) Type() SecurityContextType {
 	return UserSecurityContextType
 }
 
+// HasRole reports whether the user has the role, or inherits it when its permission resolver is a
+// RoleHierarchy.
 func (t *UserSecurityContext) HasRole(role string) bool {
-	for _, r := range t.Roles {
-		if r == role {
-			return true
-		}
+	if hierarchy, ok := t.Permissions.(RoleHierarchy); ok {
+		return hierarchy.HasRole(t.Roles, role)
 	}
-	return false
+	return slices.Contains(t.Roles, role)
 }
 
 func (t *UserSecurityContext) HasRoles(roles []string) bool {
@@ -47,6 +102,23 @@ func (t *UserSecurityContext) HasRoles(roles []string) bool {
 	return true
 }
 
+func (t *UserSecurityContext) HasScope(scope string) bool {
+	return slices.Contains(t.Scopes, scope)
+}
+
+func (t *UserSecurityContext) HasScopes(scopes []string) bool {
+	return containsAll(t.Scopes, scopes)
+}
+
+// Can resolves the permissions of the roles of the user through its permission resolver. A user
+// granted scopes, e.g. by a delegated token, also needs one of them to grant the permission.
+func (t *UserSecurityContext) Can(permission string) bool {
+	if t.Permissions == nil || !t.Permissions.Can(t.Roles, permission) {
+		return false
+	}
+	return len(t.Scopes) == 0 || scopesCan(t.Permissions, t.Scopes, permission)
+}
+
 func NewUserSecurityContext(id *domain.UserID, email string, roles []string) *UserSecurityContext {
 	return &UserSecurityContext{
 		ID:    id,
@@ -60,19 +132,62 @@ const ClientSecurityContextType SecurityContextType = "client"
 type ClientSecurityContext struct {
 	ClientID   string
 	ClientName string
+	TenantID   string
+	Scopes     []string
+	// Permissions resolves the permissions of Scopes when it is a ScopeResolver, none being
+	// granted otherwise.
+	Permissions PermissionResolver
 }
 
 func (t *ClientSecurityContext) GetIdentifier() string {
 	return t.ClientID
 }
 
+func (t *ClientSecurityContext) GetTenantID() string {
+	return t.TenantID
+}
+
 func (t *ClientSecurityContext) Type() SecurityContextType {
 	return ClientSecurityContextType
 }
 
+// HasRole always returns false, clients have no roles.
+func (t *ClientSecurityContext) HasRole(role string) bool {
+	return false
+}
+
+// HasRoles returns true only for an empty list, clients have no roles.
+func (t *ClientSecurityContext) HasRoles(roles []string) bool {
+	return len(roles) == 0
+}
+
+func (t *ClientSecurityContext) HasScope(scope string) bool {
+	return slices.Contains(t.Scopes, scope)
+}
+
+// HasScopes returns true when the client was granted every scope.
+func (t *ClientSecurityContext) HasScopes(scopes []string) bool {
+	return containsAll(t.Scopes, scopes)
+}
+
+// Can resolves the permissions of the scopes of the client through its permission resolver,
+// clients have no roles.
+func (t *ClientSecurityContext) Can(permission string) bool {
+	return scopesCan(t.Permissions, t.Scopes, permission)
+}
+
 func NewClientSecurityContext(clientID, clientName string) *ClientSecurityContext {
 	return &ClientSecurityContext{
 		ClientID:   clientID,
 		ClientName: clientName,
 	}
 }
+
+func containsAll(granted, required []string) bool {
+	for _, value := range required {
+		if !slices.Contains(granted, value) {
+			return false
+		}
+	}
+	return true
+}
@@ -15,9 +15,11 @@ func NewJWTSecurityProvider() *JWTSecurityProvider {
 	return &JWTSecurityProvider{}
 }
 
+// GetSecurityContext returns the security context stored with WithSecurityContext, as the
+// authentication middlewares do in the request context. Handlers may pass their *gin.Context.
 func (p *JWTSecurityProvider) GetSecurityContext(ctx context.Context) SecurityContext {
-	securityContext, ok := ctx.Value("securityContext").(SecurityContext)
-	if !ok {
+	securityContext, err := FromContext(ctx)
+	if err != nil {
 		return nil
 	}
 	return securityContext
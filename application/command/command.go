@@ -3,6 +3,11 @@ package command
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"math/rand/v2"
+	"time"
+
+	"github.com/jperdior/chatbot-kit/domain"
 )
 
 // Bus defines the expected behaviour from a command bus.
@@ -23,8 +28,9 @@ type Bus interface {
 type Type string
 
 type CommandEnvelope struct {
-	CommandType Type            `json:"type"`
-	Data        json.RawMessage `json:"data"`
+	CommandType Type              `json:"type"`
+	Data        json.RawMessage   `json:"data"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
 }
 
 // Command represents an application command.
@@ -36,3 +42,76 @@ type Command interface {
 type Handler interface {
 	Handle(context.Context, Command) error
 }
+
+// HandlerFunc is an adapter to allow the use of ordinary functions as command handlers.
+type HandlerFunc func(context.Context, Command) error
+
+// Handle calls f(ctx, cmd).
+func (f HandlerFunc) Handle(ctx context.Context, cmd Command) error {
+	return f(ctx, cmd)
+}
+
+// Middleware decorates a command handler with cross-cutting behaviour.
+type Middleware func(Handler) Handler
+
+// WithMiddlewares wraps the handler with the given middlewares, the first one being the outermost.
+func WithMiddlewares(handler Handler, middlewares ...Middleware) Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	return handler
+}
+
+// Delays between the attempts of RetryMiddleware, doubling from retryBaseDelay up to retryMaxDelay.
+var (
+	retryBaseDelay = 10 * time.Millisecond
+	retryMaxDelay  = time.Second
+)
+
+// RetryMiddleware re-runs the handler while it fails with an error accepted by shouldRetry,
+// up to maxAttempts executions in total, a nil shouldRetry retrying nothing. The handler always
+// runs at least once. Attempts are spaced by an exponential backoff with jitter, so that the
+// handlers conflicting on a hot aggregate do not collide again, and stop when ctx is done.
+// It must wrap any transactional middleware so that each attempt runs in a fresh transaction.
+func RetryMiddleware(maxAttempts int, shouldRetry func(error) bool) Middleware {
+	maxAttempts = max(maxAttempts, 1)
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, cmd Command) error {
+			var err error
+			for attempt := 1; attempt <= maxAttempts; attempt++ {
+				err = next.Handle(ctx, cmd)
+				if err == nil || shouldRetry == nil || !shouldRetry(err) || attempt == maxAttempts {
+					return err
+				}
+				timer := time.NewTimer(retryDelay(attempt))
+				select {
+				case <-ctx.Done():
+					timer.Stop()
+					return err
+				case <-timer.C:
+				}
+			}
+			return err
+		})
+	}
+}
+
+// retryDelay returns a random delay between half and all of the backoff of the attempt.
+func retryDelay(attempt int) time.Duration {
+	backoff := retryMaxDelay
+	if attempt < 32 {
+		backoff = min(retryBaseDelay<<(attempt-1), retryMaxDelay)
+	}
+	if backoff <= 0 {
+		return 0
+	}
+	return backoff/2 + rand.N(backoff/2+1)
+}
+
+// RetryOnConflictMiddleware re-runs the handler when it fails with a domain.ConcurrencyConflictError.
+func RetryOnConflictMiddleware(maxAttempts int) Middleware {
+	return RetryMiddleware(maxAttempts, func(err error) bool {
+		var conflict *domain.ConcurrencyConflictError
+		return errors.As(err, &conflict)
+	})
+}
@@ -0,0 +1,122 @@
+package command
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jperdior/chatbot-kit/domain"
+	"github.com/stretchr/testify/assert"
+)
+
+type testRenameChat struct{}
+
+func (testRenameChat) Type() Type { return "chat.rename" }
+
+// failingHandler fails with the given errors in turn, then succeeds.
+func failingHandler(attempts *int, errs ...error) Handler {
+	return HandlerFunc(func(context.Context, Command) error {
+		*attempts++
+		if *attempts <= len(errs) {
+			return errs[*attempts-1]
+		}
+		return nil
+	})
+}
+
+func TestRetryOnConflictMiddleware(t *testing.T) {
+	conflict := domain.NewConcurrencyConflictError("chat", "42", 3)
+
+	t.Run("Conflicts are retried until the handler succeeds", func(t *testing.T) {
+		attempts := 0
+		handler := WithMiddlewares(failingHandler(&attempts, conflict, fmt.Errorf("saving: %w", conflict)), RetryOnConflictMiddleware(3))
+
+		err := handler.Handle(context.Background(), testRenameChat{})
+
+		assert.NoError(t, err)
+		assert.Equal(t, 3, attempts)
+	})
+
+	t.Run("Conflicts are retried up to the limit", func(t *testing.T) {
+		attempts := 0
+		handler := WithMiddlewares(failingHandler(&attempts, conflict, conflict, conflict, conflict), RetryOnConflictMiddleware(3))
+
+		err := handler.Handle(context.Background(), testRenameChat{})
+
+		assert.ErrorIs(t, err, conflict)
+		assert.Equal(t, 3, attempts)
+	})
+
+	t.Run("Other errors are not retried", func(t *testing.T) {
+		failure := errors.New("boom")
+		attempts := 0
+		handler := WithMiddlewares(failingHandler(&attempts, failure), RetryOnConflictMiddleware(3))
+
+		err := handler.Handle(context.Background(), testRenameChat{})
+
+		assert.ErrorIs(t, err, failure)
+		assert.Equal(t, 1, attempts)
+	})
+
+	t.Run("Cancelled contexts are not retried", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		attempts := 0
+		handler := WithMiddlewares(failingHandler(&attempts, conflict, conflict), RetryOnConflictMiddleware(3))
+
+		err := handler.Handle(ctx, testRenameChat{})
+
+		assert.ErrorIs(t, err, conflict)
+		assert.Equal(t, 1, attempts)
+	})
+
+	t.Run("Contexts done during the backoff stop the retries", func(t *testing.T) {
+		defer func(delay time.Duration) { retryBaseDelay = delay }(retryBaseDelay)
+		retryBaseDelay = time.Hour
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		attempts := 0
+		handler := WithMiddlewares(failingHandler(&attempts, conflict, conflict), RetryOnConflictMiddleware(3))
+
+		started := time.Now()
+		err := handler.Handle(ctx, testRenameChat{})
+
+		assert.ErrorIs(t, err, conflict)
+		assert.Equal(t, 1, attempts)
+		assert.Less(t, time.Since(started), time.Second)
+	})
+
+	t.Run("A nil shouldRetry retries nothing", func(t *testing.T) {
+		attempts := 0
+		handler := WithMiddlewares(failingHandler(&attempts, conflict), RetryMiddleware(3, nil))
+
+		assert.ErrorIs(t, handler.Handle(context.Background(), testRenameChat{}), conflict)
+		assert.Equal(t, 1, attempts)
+	})
+
+	t.Run("Handlers run at least once", func(t *testing.T) {
+		attempts := 0
+		handler := WithMiddlewares(failingHandler(&attempts), RetryMiddleware(0, func(error) bool { return true }))
+
+		assert.NoError(t, handler.Handle(context.Background(), testRenameChat{}))
+		assert.Equal(t, 1, attempts)
+	})
+}
+
+func TestRetryDelay(t *testing.T) {
+	for attempt, backoff := range map[int]time.Duration{
+		1:  retryBaseDelay,
+		2:  2 * retryBaseDelay,
+		4:  8 * retryBaseDelay,
+		40: retryMaxDelay,
+	} {
+		for range 20 {
+			delay := retryDelay(attempt)
+
+			assert.GreaterOrEqual(t, delay, backoff/2, "attempt %d", attempt)
+			assert.LessOrEqual(t, delay, backoff, "attempt %d", attempt)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package consistency
+
+import (
+	"context"
+
+	"github.com/jperdior/chatbot-kit/application/command"
+)
+
+type contextKey struct{}
+
+// WithReadYourWrites returns a copy of ctx whose reads are served by the primary database,
+// so they observe the writes made just before.
+func WithReadYourWrites(ctx context.Context) context.Context {
+	return context.WithValue(ctx, contextKey{}, true)
+}
+
+// ReadYourWrites reports whether reads made with ctx must be served by the primary database.
+func ReadYourWrites(ctx context.Context) bool {
+	readYourWrites, _ := ctx.Value(contextKey{}).(bool)
+	return readYourWrites
+}
+
+// CommandMiddleware serves every read made by command handlers from the primary database.
+func CommandMiddleware() command.Middleware {
+	return func(next command.Handler) command.Handler {
+		return command.HandlerFunc(func(ctx context.Context, cmd command.Command) error {
+			return next.Handle(WithReadYourWrites(ctx), cmd)
+		})
+	}
+}
@@ -0,0 +1,16 @@
+package correlation
+
+import "context"
+
+type contextKey struct{}
+
+// WithID returns a copy of ctx carrying the given correlation ID.
+func WithID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// IDFromContext returns the correlation ID carried by ctx, or an empty string.
+func IDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
@@ -3,8 +3,10 @@ package event
 import (
 	"context"
 	"encoding/json"
-	"github.com/google/uuid"
+	"sync"
 	"time"
+
+	"github.com/jperdior/chatbot-kit/domain/uuidgen"
 )
 
 // Bus defines the expected behaviour from an event bus.
@@ -30,8 +32,9 @@ type Type string
 
 // EventEnvelope represents an envelope for an event.
 type EventEnvelope struct {
-	EventType Type            `json:"type"` // The type of the event
-	Data      json.RawMessage `json:"data"`
+	EventType Type              `json:"type"` // The type of the event
+	Data      json.RawMessage   `json:"data"`
+	Metadata  map[string]string `json:"metadata,omitempty"` // Context values such as the tenant
 }
 
 // Event represents a domain event.
@@ -42,6 +45,27 @@ type Event interface {
 	Type() Type
 }
 
+var (
+	idGeneratorMu sync.RWMutex
+	idGenerator   = uuidgen.V7
+)
+
+// SetIDGenerator sets the generator of event IDs, UUIDv7 by default. nil restores the default.
+func SetIDGenerator(generator uuidgen.Generator) {
+	if generator == nil {
+		generator = uuidgen.V7
+	}
+	idGeneratorMu.Lock()
+	defer idGeneratorMu.Unlock()
+	idGenerator = generator
+}
+
+func newEventID() string {
+	idGeneratorMu.RLock()
+	defer idGeneratorMu.RUnlock()
+	return idGenerator.New().String()
+}
+
 type BaseEvent struct {
 	EventID     string    `json:"id"`
 	AggregateID string    `json:"aggregate_id"`
@@ -50,7 +74,7 @@ type BaseEvent struct {
 
 func NewBaseEvent(aggregateID string) *BaseEvent {
 	return &BaseEvent{
-		EventID:     uuid.New().String(),
+		EventID:     newEventID(),
 		AggregateID: aggregateID,
 		OccurredOn:  time.Now(),
 	}
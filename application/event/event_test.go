@@ -0,0 +1,28 @@
+package event
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/jperdior/chatbot-kit/domain/uuidgen"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetIDGenerator(t *testing.T) {
+	t.Cleanup(func() { SetIDGenerator(nil) })
+
+	t.Run("Event IDs come from the configured generator", func(t *testing.T) {
+		SetIDGenerator(uuidgen.Sequence())
+
+		assert.Equal(t, "00000000-0000-4000-8000-000000000001", NewBaseEvent("aggregate").ID())
+	})
+
+	t.Run("Nil restores the UUIDv7 default", func(t *testing.T) {
+		SetIDGenerator(uuidgen.Sequence())
+		SetIDGenerator(nil)
+
+		var id string
+		assert.NotPanics(t, func() { id = NewBaseEvent("aggregate").ID() })
+		assert.Equal(t, uuid.Version(7), uuid.MustParse(id).Version())
+	})
+}
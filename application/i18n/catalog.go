@@ -0,0 +1,265 @@
+package i18n
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+	"sync"
+
+	"golang.org/x/text/feature/plural"
+	"golang.org/x/text/language"
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed locales
+var kitLocales embed.FS
+
+type languageKey struct{}
+
+// WithLanguage returns a copy of ctx carrying the language negotiated for the request.
+func WithLanguage(ctx context.Context, lang string) context.Context {
+	return context.WithValue(ctx, languageKey{}, lang)
+}
+
+// LanguageFromContext returns the language stored with WithLanguage, if any.
+func LanguageFromContext(ctx context.Context) (string, bool) {
+	lang, ok := ctx.Value(languageKey{}).(string)
+	return lang, ok && lang != ""
+}
+
+// Catalog holds the messages of every language, indexed by the keys of the domain errors.
+// Messages may contain {name} placeholders replaced by the parameters given to Translate, and
+// have plural forms under the zero, one, two, few, many and other subkeys of their key.
+type Catalog struct {
+	mu       sync.RWMutex
+	fallback language.Tag
+	tags     []language.Tag
+	messages map[language.Tag]map[string]string
+	matcher  language.Matcher
+}
+
+// NewCatalog returns an empty catalog, falling back to the given language.
+func NewCatalog(fallback string) (*Catalog, error) {
+	tag, err := language.Parse(fallback)
+	if err != nil {
+		return nil, fmt.Errorf("invalid fallback language %s: %w", fallback, err)
+	}
+	catalog := &Catalog{
+		fallback: tag,
+		messages: make(map[language.Tag]map[string]string),
+	}
+	catalog.addTag(tag)
+	return catalog, nil
+}
+
+// NewKitCatalog returns a catalog with the messages of the kit errors in English and Spanish,
+// falling back to English. Application messages can be added on top of them.
+func NewKitCatalog() (*Catalog, error) {
+	catalog, err := NewCatalog("en")
+	if err != nil {
+		return nil, err
+	}
+	if err := catalog.LoadFS(kitLocales, "locales"); err != nil {
+		return nil, err
+	}
+	return catalog, nil
+}
+
+// Add merges the messages of a language, overriding existing keys.
+func (c *Catalog) Add(lang string, messages map[string]string) error {
+	tag, err := language.Parse(lang)
+	if err != nil {
+		return fmt.Errorf("invalid language %s: %w", lang, err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.addTag(tag)
+	for key, message := range messages {
+		c.messages[tag][key] = message
+	}
+	return nil
+}
+
+// LoadFS loads the <lang>.yaml, <lang>.yml and <lang>.json files of dir. Nested objects are
+// flattened with dots, so {"email": {"invalid": "..."}} defines the email.invalid key.
+func (c *Catalog) LoadFS(fsys fs.FS, dir string) error {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		ext := path.Ext(entry.Name())
+		if ext != ".yaml" && ext != ".yml" && ext != ".json" {
+			continue
+		}
+		content, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return err
+		}
+
+		var tree map[string]any
+		if ext == ".json" {
+			err = json.Unmarshal(content, &tree)
+		} else {
+			err = yaml.Unmarshal(content, &tree)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to parse messages file %s: %w", entry.Name(), err)
+		}
+
+		messages := make(map[string]string)
+		flatten("", tree, messages)
+		if err := c.Add(strings.TrimSuffix(entry.Name(), ext), messages); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Match returns the supported language best matching the preferences, which may be
+// Accept-Language header values or locales such as es_ES. Empty preferences are ignored.
+func (c *Catalog) Match(preferences ...string) string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var desired []language.Tag
+	for _, preference := range preferences {
+		if preference == "" {
+			continue
+		}
+		tags, _, err := language.ParseAcceptLanguage(strings.ReplaceAll(preference, "_", "-"))
+		if err != nil {
+			continue
+		}
+		desired = append(desired, tags...)
+	}
+	if len(desired) == 0 {
+		return c.fallback.String()
+	}
+	_, index, _ := c.matcher.Match(desired...)
+	return c.tags[index].String()
+}
+
+// Translate returns the message of key in the given language, falling back to the fallback
+// language, with its placeholders replaced by params. When params has an integer count, the
+// plural form of count in the language, or else the other form, is preferred to key itself.
+// ok is false when no message exists.
+func (c *Catalog) Translate(lang, key string, params map[string]any) (message string, ok bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if tag, err := language.Parse(lang); err == nil {
+		message, ok = c.find(tag, key, params)
+	}
+	if !ok {
+		message, ok = c.find(c.fallback, key, params)
+	}
+	if !ok {
+		return "", false
+	}
+	return interpolate(message, params), true
+}
+
+// find looks the plural forms of key up before key itself.
+func (c *Catalog) find(tag language.Tag, key string, params map[string]any) (string, bool) {
+	if count, ok := pluralCount(params); ok {
+		form := pluralForms[plural.Cardinal.MatchPlural(tag, count, 0, 0, 0, 0)]
+		for _, candidate := range []string{key + "." + form, key + ".other"} {
+			if message, ok := c.lookup(tag, candidate); ok {
+				return message, true
+			}
+		}
+	}
+	return c.lookup(tag, key)
+}
+
+var pluralForms = map[plural.Form]string{
+	plural.Other: "other",
+	plural.Zero:  "zero",
+	plural.One:   "one",
+	plural.Two:   "two",
+	plural.Few:   "few",
+	plural.Many:  "many",
+}
+
+func pluralCount(params map[string]any) (int, bool) {
+	var count int
+	switch v := params["count"].(type) {
+	case int:
+		count = v
+	case int32:
+		count = int(v)
+	case int64:
+		count = int(v)
+	case uint:
+		count = int(v)
+	case uint32:
+		count = int(v)
+	case uint64:
+		count = int(v)
+	default:
+		return 0, false
+	}
+	return max(count, -count), true
+}
+
+// lookup finds the key in the language or its parents, es-MX falling back to es.
+func (c *Catalog) lookup(tag language.Tag, key string) (string, bool) {
+	for {
+		if messages, ok := c.messages[tag]; ok {
+			if message, ok := messages[key]; ok {
+				return message, true
+			}
+		}
+		if tag == language.Und {
+			return "", false
+		}
+		tag = tag.Parent()
+	}
+}
+
+func (c *Catalog) addTag(tag language.Tag) {
+	if _, ok := c.messages[tag]; ok {
+		return
+	}
+	c.messages[tag] = make(map[string]string)
+	c.tags = append(c.tags, tag)
+	// The first tag of the matcher is the default one, the fallback is always added first.
+	c.matcher = language.NewMatcher(c.tags)
+}
+
+func flatten(prefix string, tree map[string]any, messages map[string]string) {
+	for name, value := range tree {
+		key := name
+		if prefix != "" {
+			key = prefix + "." + name
+		}
+		switch v := value.(type) {
+		case map[string]any:
+			flatten(key, v, messages)
+		case string:
+			messages[key] = v
+		default:
+			messages[key] = fmt.Sprint(v)
+		}
+	}
+}
+
+func interpolate(message string, params map[string]any) string {
+	if len(params) == 0 {
+		return message
+	}
+	replacements := make([]string, 0, len(params)*2)
+	for name, value := range params {
+		replacements = append(replacements, "{"+name+"}", fmt.Sprint(value))
+	}
+	return strings.NewReplacer(replacements...).Replace(message)
+}
@@ -0,0 +1,147 @@
+package i18n
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestCatalog(t *testing.T) *Catalog {
+	t.Helper()
+	catalog, err := NewCatalog("en")
+	require.NoError(t, err)
+	require.NoError(t, catalog.Add("en", map[string]string{
+		"chat.archived":         "The chat {name} is archived",
+		"chat.closed":           "The chat is closed",
+		"messages.unread.one":   "You have one unread message",
+		"messages.unread.other": "You have {count} unread messages",
+		"agents.online.other":   "{count} agents online",
+	}))
+	require.NoError(t, catalog.Add("es", map[string]string{
+		"chat.archived":         "El chat {name} está archivado",
+		"messages.unread.one":   "Tienes un mensaje sin leer",
+		"messages.unread.other": "Tienes {count} mensajes sin leer",
+	}))
+	require.NoError(t, catalog.Add("es-MX", map[string]string{
+		"chat.archived": "La conversación {name} está archivada",
+	}))
+	return catalog
+}
+
+func TestCatalogTranslate(t *testing.T) {
+	catalog := newTestCatalog(t)
+
+	tests := []struct {
+		name     string
+		lang     string
+		key      string
+		params   map[string]any
+		expected string
+	}{
+		{"Messages are translated", "es", "chat.archived", map[string]any{"name": "sales"}, "El chat sales está archivado"},
+		{"Regional languages take their own messages", "es-MX", "chat.archived", map[string]any{"name": "sales"}, "La conversación sales está archivada"},
+		{"Regional languages fall back to their parent", "es-AR", "chat.archived", map[string]any{"name": "sales"}, "El chat sales está archivado"},
+		{"Missing messages fall back to the fallback language", "es-MX", "chat.closed", nil, "The chat is closed"},
+		{"Unknown languages fall back to the fallback language", "fr", "chat.archived", map[string]any{"name": "sales"}, "The chat sales is archived"},
+		{"Invalid languages fall back to the fallback language", "not a language!", "chat.closed", nil, "The chat is closed"},
+		{"Unknown placeholders are kept", "en", "chat.archived", nil, "The chat {name} is archived"},
+		{"Extra parameters are ignored", "en", "chat.closed", map[string]any{"name": "sales"}, "The chat is closed"},
+		{"The plural form of the count is chosen", "es", "messages.unread", map[string]any{"count": 1}, "Tienes un mensaje sin leer"},
+		{"Other counts take the other form", "es", "messages.unread", map[string]any{"count": 3}, "Tienes 3 mensajes sin leer"},
+		{"Zero takes the form of the language", "en", "messages.unread", map[string]any{"count": int64(0)}, "You have 0 unread messages"},
+		{"Negative counts take the form of their absolute value", "en", "messages.unread", map[string]any{"count": -1}, "You have one unread message"},
+		{"Missing plural forms fall back to the other form", "en", "agents.online", map[string]any{"count": 1}, "1 agents online"},
+		{"Missing plural messages fall back to the fallback language", "es", "agents.online", map[string]any{"count": 2}, "2 agents online"},
+		{"Non integer counts do not select a plural form", "en", "chat.closed", map[string]any{"count": "3"}, "The chat is closed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			message, ok := catalog.Translate(tt.lang, tt.key, tt.params)
+
+			assert.True(t, ok)
+			assert.Equal(t, tt.expected, message)
+		})
+	}
+
+	t.Run("Missing keys are not translated", func(t *testing.T) {
+		message, ok := catalog.Translate("es", "chat.deleted", nil)
+
+		assert.False(t, ok)
+		assert.Empty(t, message)
+	})
+
+	t.Run("Plural keys without a count are not translated", func(t *testing.T) {
+		_, ok := catalog.Translate("en", "messages.unread", nil)
+
+		assert.False(t, ok)
+	})
+}
+
+func TestCatalogMatch(t *testing.T) {
+	catalog := newTestCatalog(t)
+
+	tests := []struct {
+		name        string
+		preferences []string
+		expected    string
+	}{
+		{"No preferences match the fallback", nil, "en"},
+		{"Empty preferences are ignored", []string{"", "es"}, "es"},
+		{"Accept-Language weights are honored", []string{"fr-FR, es;q=0.8, en;q=0.5"}, "es"},
+		{"Locales are accepted", []string{"es_MX"}, "es-MX"},
+		{"Earlier preferences win", []string{"en", "es"}, "en"},
+		{"Unsupported languages match the fallback", []string{"fr"}, "en"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, catalog.Match(tt.preferences...))
+		})
+	}
+}
+
+func TestCatalogLoadFS(t *testing.T) {
+	catalog, err := NewCatalog("en")
+	require.NoError(t, err)
+
+	err = catalog.LoadFS(fstest.MapFS{
+		"messages/en.yaml":  {Data: []byte("chat:\n  archived: \"The chat is archived\"\n  limit: 10\n")},
+		"messages/es.json":  {Data: []byte(`{"chat": {"archived": "El chat está archivado"}}`)},
+		"messages/notes.md": {Data: []byte("# Not a catalog")},
+	}, "messages")
+	require.NoError(t, err)
+
+	english, _ := catalog.Translate("en", "chat.archived", nil)
+	spanish, _ := catalog.Translate("es", "chat.archived", nil)
+	limit, _ := catalog.Translate("en", "chat.limit", nil)
+	assert.Equal(t, "The chat is archived", english)
+	assert.Equal(t, "El chat está archivado", spanish)
+	assert.Equal(t, "10", limit)
+
+	t.Run("Malformed files fail the loading", func(t *testing.T) {
+		err := catalog.LoadFS(fstest.MapFS{"messages/fr.json": {Data: []byte("{")}}, "messages")
+
+		assert.ErrorContains(t, err, "fr.json")
+	})
+}
+
+func TestKitCatalog(t *testing.T) {
+	catalog, err := NewKitCatalog()
+	require.NoError(t, err)
+
+	// Every kit message is translated, so none of them falls back to English.
+	catalog.mu.RLock()
+	defer catalog.mu.RUnlock()
+	english := catalog.messages[catalog.fallback]
+	for _, tag := range catalog.tags {
+		for key := range english {
+			assert.Contains(t, catalog.messages[tag], key, "%s has no message for %s", tag, key)
+		}
+		for key := range catalog.messages[tag] {
+			assert.Contains(t, english, key, "%s has a message for %s, English has none", tag, key)
+		}
+	}
+}
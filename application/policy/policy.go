@@ -0,0 +1,264 @@
+// Package policy authorizes actions on resources from the attributes of the subject, the action
+// and the resource, for rules that roles and permissions cannot express such as "an agent may
+// read a conversation only in their own workspace".
+package policy
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/jperdior/chatbot-kit/application/auth"
+	"github.com/jperdior/chatbot-kit/application/command"
+	"github.com/jperdior/chatbot-kit/application/query"
+	"github.com/jperdior/chatbot-kit/domain"
+)
+
+type Effect string
+
+const (
+	// NotApplicable is returned by the policies that have no opinion on a request.
+	NotApplicable Effect = ""
+	Allow         Effect = "allow"
+	Deny          Effect = "deny"
+)
+
+// Resource is the target of an action. Attributes hold whatever the policies need to know about
+// it, e.g. the workspace a conversation belongs to.
+type Resource struct {
+	Type       string
+	ID         string
+	Attributes map[string]any
+}
+
+// Request asks whether the subject may perform the action on the resource. SubjectAttributes
+// complete the attributes derived from the security context, which they cannot override, see
+// WithSubjectAttributes.
+type Request struct {
+	Subject           auth.SecurityContext
+	SubjectAttributes map[string]any
+	Action            string
+	Resource          Resource
+}
+
+// Decision is the outcome of a policy, or of the engine. Policy names the policy that decided.
+type Decision struct {
+	Effect Effect
+	Reason string
+	Policy string
+}
+
+func (d Decision) Allowed() bool {
+	return d.Effect == Allow
+}
+
+// Policy evaluates requests, returning a NotApplicable decision for the ones it has no opinion on.
+type Policy interface {
+	Name() string
+	Evaluate(ctx context.Context, request Request) (Decision, error)
+}
+
+type funcPolicy struct {
+	name     string
+	evaluate func(ctx context.Context, request Request) (Decision, error)
+}
+
+// Func returns a policy written as an ordinary function.
+func Func(name string, evaluate func(ctx context.Context, request Request) (Decision, error)) Policy {
+	return &funcPolicy{name: name, evaluate: evaluate}
+}
+
+func (p *funcPolicy) Name() string {
+	return p.name
+}
+
+func (p *funcPolicy) Evaluate(ctx context.Context, request Request) (Decision, error) {
+	return p.evaluate(ctx, request)
+}
+
+// Auditor records the decisions of the engine.
+type Auditor interface {
+	Record(ctx context.Context, request Request, decision Decision)
+}
+
+// AuditorFunc is an adapter to allow the use of ordinary functions as auditors.
+type AuditorFunc func(ctx context.Context, request Request, decision Decision)
+
+func (f AuditorFunc) Record(ctx context.Context, request Request, decision Decision) {
+	f(ctx, request, decision)
+}
+
+// LogAuditor writes the decisions to the standard logger.
+var LogAuditor = AuditorFunc(func(_ context.Context, request Request, decision Decision) {
+	actor := "anonymous"
+	if request.Subject != nil {
+		actor = string(request.Subject.Type()) + ":" + request.Subject.GetIdentifier()
+	}
+	log.Printf("Authorization %s: %s %s %s/%s (%s: %s)", decision.Effect, actor, request.Action,
+		request.Resource.Type, request.Resource.ID, decision.Policy, decision.Reason)
+})
+
+// ResourceLoader completes the attributes of a resource, e.g. from its repository.
+type ResourceLoader func(ctx context.Context, resource Resource) (Resource, error)
+
+// SubjectAttributesFunc returns attributes of a subject unknown to its security context.
+type SubjectAttributesFunc func(ctx context.Context, subject auth.SecurityContext) (map[string]any, error)
+
+type Option func(*Engine)
+
+func WithPolicies(policies ...Policy) Option {
+	return func(e *Engine) {
+		e.policies = append(e.policies, policies...)
+	}
+}
+
+// WithAuditor records every decision of the engine.
+func WithAuditor(auditor Auditor) Option {
+	return func(e *Engine) {
+		e.auditor = auditor
+	}
+}
+
+// WithResourceLoader loads the attributes of the resources of the given type before evaluation.
+func WithResourceLoader(resourceType string, loader ResourceLoader) Option {
+	return func(e *Engine) {
+		e.loaders[resourceType] = loader
+	}
+}
+
+func WithSubjectAttributes(attributes SubjectAttributesFunc) Option {
+	return func(e *Engine) {
+		e.subjectAttributes = attributes
+	}
+}
+
+// Engine combines policies: any deny wins over allows, and a request no policy allows is denied.
+type Engine struct {
+	policies          []Policy
+	auditor           Auditor
+	loaders           map[string]ResourceLoader
+	subjectAttributes SubjectAttributesFunc
+}
+
+func NewEngine(opts ...Option) *Engine {
+	engine := &Engine{loaders: make(map[string]ResourceLoader)}
+	for _, opt := range opts {
+		opt(engine)
+	}
+	return engine
+}
+
+// Decide evaluates the request against every policy. An error of a policy fails the request.
+func (e *Engine) Decide(ctx context.Context, request Request) (Decision, error) {
+	if loader, ok := e.loaders[request.Resource.Type]; ok {
+		resource, err := loader(ctx, request.Resource)
+		if err != nil {
+			return Decision{}, err
+		}
+		request.Resource = resource
+	}
+	if e.subjectAttributes != nil && request.Subject != nil {
+		attributes, err := e.subjectAttributes(ctx, request.Subject)
+		if err != nil {
+			return Decision{}, err
+		}
+		// Derived attributes are merged last, so callers cannot override them.
+		merged := make(map[string]any, len(attributes)+len(request.SubjectAttributes))
+		for name, value := range request.SubjectAttributes {
+			merged[name] = value
+		}
+		for name, value := range attributes {
+			merged[name] = value
+		}
+		request.SubjectAttributes = merged
+	}
+
+	decision := Decision{
+		Effect: Deny,
+		Reason: fmt.Sprintf("no policy allows %s on %s", request.Action, request.Resource.Type),
+		Policy: "default",
+	}
+	for _, policy := range e.policies {
+		result, err := policy.Evaluate(ctx, request)
+		if err != nil {
+			return Decision{}, fmt.Errorf("policy %s: %w", policy.Name(), err)
+		}
+		if result.Policy == "" {
+			result.Policy = policy.Name()
+		}
+		if result.Effect == Deny {
+			decision = result
+			break
+		}
+		if result.Effect == Allow && !decision.Allowed() {
+			decision = result
+		}
+	}
+
+	if e.auditor != nil {
+		e.auditor.Record(ctx, request, decision)
+	}
+	return decision, nil
+}
+
+// Authorize returns a forbidden domain.DomainError when the subject may not perform the action.
+func (e *Engine) Authorize(ctx context.Context, subject auth.SecurityContext, action string, resource Resource) error {
+	decision, err := e.Decide(ctx, Request{Subject: subject, Action: action, Resource: resource})
+	if err != nil {
+		return err
+	}
+	if !decision.Allowed() {
+		return NewDeniedError(action, resource, decision)
+	}
+	return nil
+}
+
+// NewDeniedError is returned when a request is denied.
+func NewDeniedError(action string, resource Resource, decision Decision) *domain.DomainError {
+	return domain.NewForbiddenError(fmt.Sprintf("%s on %s denied: %s", action, resource.Type, decision.Reason), "policy.denied").
+		WithParam("action", action).
+		WithParam("resource", resource.Type).
+		WithParam("reason", decision.Reason)
+}
+
+// Authorizable is implemented by the commands and queries authorized by the bus middlewares.
+type Authorizable interface {
+	Action() string
+	Resource() Resource
+}
+
+// CommandMiddleware authorizes the commands implementing Authorizable before their handler runs.
+func CommandMiddleware(engine *Engine, provider auth.SecurityProvider) command.Middleware {
+	return func(next command.Handler) command.Handler {
+		return command.HandlerFunc(func(ctx context.Context, cmd command.Command) error {
+			if err := authorize(ctx, engine, provider, cmd); err != nil {
+				return err
+			}
+			return next.Handle(ctx, cmd)
+		})
+	}
+}
+
+// QueryMiddleware authorizes the queries implementing Authorizable before their handler runs.
+func QueryMiddleware(engine *Engine, provider auth.SecurityProvider) query.Middleware {
+	return func(next query.Handler) query.Handler {
+		return query.HandlerFunc(func(ctx context.Context, qry query.Query) (interface{}, error) {
+			if err := authorize(ctx, engine, provider, qry); err != nil {
+				return nil, err
+			}
+			return next.Handle(ctx, qry)
+		})
+	}
+}
+
+func authorize(ctx context.Context, engine *Engine, provider auth.SecurityProvider, message any) error {
+	authorizable, ok := message.(Authorizable)
+	if !ok {
+		return nil
+	}
+	securityContext := provider.GetSecurityContext(ctx)
+	if securityContext == nil {
+		return domain.NewUnauthorizedError("authentication is required", "authentication.required")
+	}
+	return engine.Authorize(ctx, securityContext, authorizable.Action(), authorizable.Resource())
+}
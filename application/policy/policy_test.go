@@ -0,0 +1,174 @@
+package policy
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jperdior/chatbot-kit/application/auth"
+	"github.com/jperdior/chatbot-kit/application/command"
+	"github.com/jperdior/chatbot-kit/application/query"
+	"github.com/jperdior/chatbot-kit/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func fixedPolicy(name string, effect Effect) Policy {
+	return Func(name, func(context.Context, Request) (Decision, error) {
+		return Decision{Effect: effect, Reason: name}, nil
+	})
+}
+
+func TestEngine(t *testing.T) {
+	ctx := context.Background()
+	request := Request{Subject: newTestAgent("acme"), Action: "read", Resource: Resource{Type: "conversation", ID: "42"}}
+
+	tests := []struct {
+		name     string
+		policies []Policy
+		expected Decision
+	}{
+		{"Requests no policy allows are denied", nil, Decision{Effect: Deny, Reason: "no policy allows read on conversation", Policy: "default"}},
+		{"Not applicable policies deny by default", []Policy{fixedPolicy("abstain", NotApplicable)}, Decision{Effect: Deny, Reason: "no policy allows read on conversation", Policy: "default"}},
+		{"An allow is enough", []Policy{fixedPolicy("abstain", NotApplicable), fixedPolicy("allow", Allow)}, Decision{Effect: Allow, Reason: "allow", Policy: "allow"}},
+		{"A deny overrides allows", []Policy{fixedPolicy("allow", Allow), fixedPolicy("deny", Deny)}, Decision{Effect: Deny, Reason: "deny", Policy: "deny"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decision, err := NewEngine(WithPolicies(tt.policies...)).Decide(ctx, request)
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, decision)
+		})
+	}
+
+	t.Run("Policy errors fail the request", func(t *testing.T) {
+		failure := errors.New("boom")
+		engine := NewEngine(WithPolicies(Func("broken", func(context.Context, Request) (Decision, error) {
+			return Decision{}, failure
+		})))
+
+		_, err := engine.Decide(ctx, request)
+
+		assert.ErrorIs(t, err, failure)
+	})
+
+	t.Run("Resources and subjects are completed before evaluation", func(t *testing.T) {
+		var evaluated Request
+		engine := NewEngine(
+			WithPolicies(Func("spy", func(_ context.Context, request Request) (Decision, error) {
+				evaluated = request
+				return Decision{Effect: Allow}, nil
+			})),
+			WithResourceLoader("conversation", func(_ context.Context, resource Resource) (Resource, error) {
+				resource.Attributes = map[string]any{"workspace_id": "acme"}
+				return resource, nil
+			}),
+			WithSubjectAttributes(func(context.Context, auth.SecurityContext) (map[string]any, error) {
+				return map[string]any{"department": "sales", "level": 1}, nil
+			}),
+		)
+
+		_, err := engine.Decide(ctx, Request{Subject: request.Subject, SubjectAttributes: map[string]any{"shift": "night"}, Action: "read", Resource: request.Resource})
+
+		require.NoError(t, err)
+		assert.Equal(t, "acme", evaluated.Resource.Attributes["workspace_id"])
+		assert.Equal(t, map[string]any{"department": "sales", "level": 1, "shift": "night"}, evaluated.SubjectAttributes)
+	})
+
+	t.Run("Callers cannot override derived subject attributes", func(t *testing.T) {
+		engine := NewEngine(
+			WithPolicies(Func("same workspace", func(_ context.Context, request Request) (Decision, error) {
+				if request.SubjectAttributes["workspace_id"] == request.Resource.Attributes["workspace_id"] {
+					return Decision{Effect: Allow}, nil
+				}
+				return Decision{Effect: Deny, Reason: "another workspace"}, nil
+			})),
+			WithSubjectAttributes(func(context.Context, auth.SecurityContext) (map[string]any, error) {
+				return map[string]any{"workspace_id": "acme"}, nil
+			}),
+		)
+
+		decision, err := engine.Decide(ctx, Request{
+			Subject:           request.Subject,
+			SubjectAttributes: map[string]any{"workspace_id": "globex"},
+			Action:            "read",
+			Resource:          Resource{Type: "conversation", ID: "42", Attributes: map[string]any{"workspace_id": "globex"}},
+		})
+
+		require.NoError(t, err)
+		assert.Equal(t, Deny, decision.Effect)
+	})
+
+	t.Run("Decisions are audited", func(t *testing.T) {
+		var audited []Decision
+		engine := NewEngine(WithPolicies(fixedPolicy("allow", Allow)), WithAuditor(AuditorFunc(func(_ context.Context, _ Request, decision Decision) {
+			audited = append(audited, decision)
+		})))
+
+		_, err := engine.Decide(ctx, request)
+
+		require.NoError(t, err)
+		assert.Equal(t, []Decision{{Effect: Allow, Reason: "allow", Policy: "allow"}}, audited)
+	})
+
+	t.Run("Denied requests are forbidden errors", func(t *testing.T) {
+		err := NewEngine(WithPolicies(fixedPolicy("deny", Deny))).Authorize(ctx, request.Subject, "read", request.Resource)
+
+		var domainErr *domain.DomainError
+		require.ErrorAs(t, err, &domainErr)
+		assert.ErrorIs(t, err, domain.ErrForbidden)
+		assert.Equal(t, "policy.denied", domainErr.Key)
+		assert.Equal(t, "deny", domainErr.Params["reason"])
+	})
+}
+
+type testCloseConversation struct{}
+
+func (testCloseConversation) Type() command.Type { return "conversation.close" }
+func (testCloseConversation) Action() string     { return "close" }
+func (testCloseConversation) Resource() Resource { return Resource{Type: "conversation", ID: "42"} }
+
+type testFindConversation struct{}
+
+func (testFindConversation) Type() query.Type   { return "conversation.find" }
+func (testFindConversation) Action() string     { return "read" }
+func (testFindConversation) Resource() Resource { return Resource{Type: "conversation", ID: "42"} }
+
+type testPing struct{}
+
+func (testPing) Type() command.Type { return "ping" }
+
+func TestMiddlewares(t *testing.T) {
+	engine := NewEngine(WithPolicies(Func("readers", func(_ context.Context, request Request) (Decision, error) {
+		if request.Action == "read" {
+			return Decision{Effect: Allow}, nil
+		}
+		return Decision{Effect: NotApplicable}, nil
+	})))
+	provider := auth.NewJWTSecurityProvider()
+	authenticated := auth.WithSecurityContext(context.Background(), newTestAgent("acme"))
+
+	commandHandler := command.WithMiddlewares(command.HandlerFunc(func(context.Context, command.Command) error {
+		return nil
+	}), CommandMiddleware(engine, provider))
+	queryHandler := query.WithMiddlewares(query.HandlerFunc(func(context.Context, query.Query) (interface{}, error) {
+		return "conversation", nil
+	}), QueryMiddleware(engine, provider))
+
+	t.Run("Authorizable commands are authorized", func(t *testing.T) {
+		assert.ErrorIs(t, commandHandler.Handle(authenticated, testCloseConversation{}), domain.ErrForbidden)
+		assert.ErrorIs(t, commandHandler.Handle(context.Background(), testCloseConversation{}), domain.ErrUnauthorized)
+		assert.NoError(t, commandHandler.Handle(context.Background(), testPing{}))
+	})
+
+	t.Run("Authorizable queries are authorized", func(t *testing.T) {
+		result, err := queryHandler.Handle(authenticated, testFindConversation{})
+		_, anonymousErr := queryHandler.Handle(context.Background(), testFindConversation{})
+
+		require.NoError(t, err)
+		assert.Equal(t, "conversation", result)
+		assert.ErrorIs(t, anonymousErr, domain.ErrUnauthorized)
+	})
+}
@@ -0,0 +1,277 @@
+package policy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/jperdior/chatbot-kit/application/auth"
+	"gopkg.in/yaml.v3"
+)
+
+type Operator string
+
+const (
+	Equal     Operator = "eq"
+	NotEqual  Operator = "ne"
+	In        Operator = "in"
+	NotIn     Operator = "not_in"
+	Contains  Operator = "contains"
+	Exists    Operator = "exists"
+	NotExists Operator = "not_exists"
+)
+
+// Condition compares an attribute to a literal Value, or to another attribute named by ValueOf.
+// Attributes are named "subject.<name>" or "resource.<name>", the subject having at least id,
+// type, tenant_id, roles and scopes and the resource id and type, which the attributes given
+// with the request cannot override. Attributes that are nil, empty strings or empty lists are
+// missing. Apart from exists and not_exists, a condition on a missing attribute, or compared to
+// a missing attribute, cannot be decided and fails closed: it never holds in an allow rule and
+// always holds in a deny rule. A deny rule meant to ignore the requests missing an attribute
+// checks that it exists first.
+type Condition struct {
+	Attribute string   `json:"attribute" yaml:"attribute"`
+	Operator  Operator `json:"operator" yaml:"operator"`
+	Value     any      `json:"value,omitempty" yaml:"value,omitempty"`
+	ValueOf   string   `json:"value_of,omitempty" yaml:"value_of,omitempty"`
+}
+
+// Rule is a declarative policy applying its effect when the action and the resource type match,
+// "*" matching any, and every condition holds. For instance, in YAML:
+//
+//	# agents may only read the conversations of their own workspace
+//	name: agents-read-own-workspace
+//	effect: allow
+//	actions: [read]
+//	resources: [conversation]
+//	conditions:
+//	  - {attribute: subject.roles, operator: contains, value: agent}
+//	  - {attribute: resource.workspace_id, operator: eq, value_of: subject.tenant_id}
+//
+//	# archived conversations are read-only, whatever the roles
+//	name: archived-conversations-read-only
+//	effect: deny
+//	actions: [update, delete]
+//	resources: [conversation]
+//	conditions:
+//	  - {attribute: resource.status, operator: exists}
+//	  - {attribute: resource.status, operator: eq, value: archived}
+type Rule struct {
+	Name        string      `json:"name" yaml:"name"`
+	Description string      `json:"description,omitempty" yaml:"description,omitempty"`
+	Effect      Effect      `json:"effect" yaml:"effect"`
+	Actions     []string    `json:"actions" yaml:"actions"`
+	Resources   []string    `json:"resources" yaml:"resources"`
+	Conditions  []Condition `json:"conditions,omitempty" yaml:"conditions,omitempty"`
+}
+
+// Validate checks the effect, the targets and the conditions of the rule.
+func (r Rule) Validate() error {
+	if r.Effect != Allow && r.Effect != Deny {
+		return fmt.Errorf("policy: rule %s has an invalid effect %q", r.Name, r.Effect)
+	}
+	if len(r.Actions) == 0 || len(r.Resources) == 0 {
+		return fmt.Errorf("policy: rule %s must list its actions and resources, \"*\" matching any", r.Name)
+	}
+	for _, condition := range r.Conditions {
+		switch condition.Operator {
+		case Equal, NotEqual, In, NotIn, Contains, Exists, NotExists:
+		default:
+			return fmt.Errorf("policy: rule %s has an invalid operator %q", r.Name, condition.Operator)
+		}
+		if !validAttribute(condition.Attribute) {
+			return fmt.Errorf("policy: rule %s has an invalid attribute %q", r.Name, condition.Attribute)
+		}
+		if condition.ValueOf != "" && !validAttribute(condition.ValueOf) {
+			return fmt.Errorf("policy: rule %s has an invalid attribute %q", r.Name, condition.ValueOf)
+		}
+	}
+	return nil
+}
+
+func validAttribute(name string) bool {
+	return strings.HasPrefix(name, "subject.") || strings.HasPrefix(name, "resource.")
+}
+
+func (r Rule) matches(request Request) bool {
+	return matchesAny(r.Actions, request.Action) && matchesAny(r.Resources, request.Resource.Type)
+}
+
+func matchesAny(patterns []string, value string) bool {
+	return slices.Contains(patterns, "*") || slices.Contains(patterns, value)
+}
+
+// RulePolicy evaluates declarative rules, the first matching deny or else the first matching
+// allow deciding.
+type RulePolicy struct {
+	name  string
+	rules []Rule
+}
+
+func NewRulePolicy(name string, rules ...Rule) (*RulePolicy, error) {
+	for _, rule := range rules {
+		if err := rule.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	return &RulePolicy{name: name, rules: rules}, nil
+}
+
+func (p *RulePolicy) Name() string {
+	return p.name
+}
+
+func (p *RulePolicy) Evaluate(_ context.Context, request Request) (Decision, error) {
+	attributes := requestAttributes(request)
+	decision := Decision{Effect: NotApplicable}
+	for _, rule := range p.rules {
+		if !rule.matches(request) || !holds(rule.Conditions, attributes, rule.Effect == Deny) {
+			continue
+		}
+		reason := rule.Description
+		if reason == "" {
+			reason = "rule " + rule.Name
+		}
+		result := Decision{Effect: rule.Effect, Reason: reason, Policy: p.name + "/" + rule.Name}
+		if rule.Effect == Deny {
+			return result, nil
+		}
+		if decision.Effect == NotApplicable {
+			decision = result
+		}
+	}
+	return decision, nil
+}
+
+// LoadRulesFS reads rules from a YAML or JSON file holding a list of rules.
+func LoadRulesFS(fsys fs.FS, name string) ([]Rule, error) {
+	content, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	var rules []Rule
+	if path.Ext(name) == ".json" {
+		err = json.Unmarshal(content, &rules)
+	} else {
+		err = yaml.Unmarshal(content, &rules)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("policy: failed to parse %s: %w", name, err)
+	}
+	return rules, nil
+}
+
+// requestAttributes collects the attributes given with the request, then the ones derived from
+// the subject and the resource, which take precedence.
+func requestAttributes(request Request) map[string]any {
+	attributes := make(map[string]any)
+	for name, value := range request.SubjectAttributes {
+		attributes["subject."+name] = value
+	}
+	for name, value := range request.Resource.Attributes {
+		attributes["resource."+name] = value
+	}
+	if subject := request.Subject; subject != nil {
+		attributes["subject.id"] = subject.GetIdentifier()
+		attributes["subject.type"] = string(subject.Type())
+		attributes["subject.tenant_id"] = subject.GetTenantID()
+		switch s := subject.(type) {
+		case *auth.UserSecurityContext:
+			attributes["subject.roles"] = s.Roles
+			attributes["subject.scopes"] = s.Scopes
+			attributes["subject.email"] = s.Email
+		case *auth.ClientSecurityContext:
+			attributes["subject.roles"] = []string{}
+			attributes["subject.scopes"] = s.Scopes
+		}
+	}
+	attributes["resource.type"] = request.Resource.Type
+	attributes["resource.id"] = request.Resource.ID
+	return attributes
+}
+
+// holds reports whether every condition holds, the ones on missing attributes holding when
+// undecided is true.
+func holds(conditions []Condition, attributes map[string]any, undecided bool) bool {
+	for _, condition := range conditions {
+		if !condition.holds(attributes, undecided) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c Condition) holds(attributes map[string]any, undecided bool) bool {
+	value, exists := attribute(attributes, c.Attribute)
+	switch c.Operator {
+	case Exists:
+		return exists
+	case NotExists:
+		return !exists
+	}
+	if !exists {
+		return undecided
+	}
+
+	expected := c.Value
+	if c.ValueOf != "" {
+		var ok bool
+		if expected, ok = attribute(attributes, c.ValueOf); !ok {
+			return undecided
+		}
+	}
+
+	switch c.Operator {
+	case Equal:
+		return equal(value, expected)
+	case NotEqual:
+		return !equal(value, expected)
+	case In:
+		return containsValue(expected, value)
+	case NotIn:
+		return !containsValue(expected, value)
+	case Contains:
+		return containsValue(value, expected)
+	}
+	return false
+}
+
+// attribute returns the named attribute, reporting empty values as missing so that, e.g., a
+// subject without tenant never matches a resource without workspace.
+func attribute(attributes map[string]any, name string) (any, bool) {
+	value, ok := attributes[name]
+	if !ok || value == nil {
+		return nil, false
+	}
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.String, reflect.Slice, reflect.Array, reflect.Map:
+		return value, v.Len() > 0
+	case reflect.Pointer, reflect.Interface:
+		return value, !v.IsNil()
+	}
+	return value, true
+}
+
+// equal compares values loosely so that literals read from YAML or JSON match typed attributes.
+func equal(a, b any) bool {
+	return fmt.Sprint(a) == fmt.Sprint(b)
+}
+
+func containsValue(list, value any) bool {
+	v := reflect.ValueOf(list)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return false
+	}
+	for i := 0; i < v.Len(); i++ {
+		if equal(v.Index(i).Interface(), value) {
+			return true
+		}
+	}
+	return false
+}
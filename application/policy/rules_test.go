@@ -0,0 +1,294 @@
+package policy
+
+import (
+	"context"
+	"testing"
+	"testing/fstest"
+
+	"github.com/jperdior/chatbot-kit/application/auth"
+	"github.com/jperdior/chatbot-kit/domain/user"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestAgent(tenantID string) *auth.UserSecurityContext {
+	agent := auth.NewUserSecurityContext(user.NewRandomUserID(), "agent@example.com", []string{"agent"})
+	agent.TenantID = tenantID
+	agent.Scopes = []string{"chats:read"}
+	return agent
+}
+
+func TestConditions(t *testing.T) {
+	attributes := requestAttributes(Request{
+		Subject: newTestAgent("acme"),
+		Resource: Resource{Type: "conversation", ID: "42", Attributes: map[string]any{
+			"workspace_id": "acme",
+			"priority":     3,
+			"labels":       []string{"vip", "billing"},
+			"assignee":     "",
+			"watchers":     []string{},
+			"archived":     false,
+		}},
+	})
+
+	tests := []struct {
+		name      string
+		condition Condition
+		expected  bool
+	}{
+		{"eq holds for equal values", Condition{Attribute: "resource.workspace_id", Operator: Equal, Value: "acme"}, true},
+		{"eq fails for different values", Condition{Attribute: "resource.workspace_id", Operator: Equal, Value: "globex"}, false},
+		{"eq compares literals loosely", Condition{Attribute: "resource.priority", Operator: Equal, Value: "3"}, true},
+		{"eq compares attributes", Condition{Attribute: "resource.workspace_id", Operator: Equal, ValueOf: "subject.tenant_id"}, true},
+		{"eq holds for false booleans", Condition{Attribute: "resource.archived", Operator: Equal, Value: false}, true},
+		{"ne holds for different values", Condition{Attribute: "resource.workspace_id", Operator: NotEqual, Value: "globex"}, true},
+		{"ne fails for equal values", Condition{Attribute: "resource.workspace_id", Operator: NotEqual, Value: "acme"}, false},
+		{"in holds for listed values", Condition{Attribute: "resource.workspace_id", Operator: In, Value: []any{"acme", "globex"}}, true},
+		{"in fails for unlisted values", Condition{Attribute: "resource.workspace_id", Operator: In, Value: []any{"globex"}}, false},
+		{"in fails against a non list", Condition{Attribute: "resource.workspace_id", Operator: In, Value: "acme"}, false},
+		{"not_in holds for unlisted values", Condition{Attribute: "resource.workspace_id", Operator: NotIn, Value: []any{"globex"}}, true},
+		{"not_in fails for listed values", Condition{Attribute: "resource.workspace_id", Operator: NotIn, Value: []any{"acme"}}, false},
+		{"contains holds for list members", Condition{Attribute: "subject.roles", Operator: Contains, Value: "agent"}, true},
+		{"contains fails for other values", Condition{Attribute: "resource.labels", Operator: Contains, Value: "spam"}, false},
+		{"exists holds for present attributes", Condition{Attribute: "subject.email", Operator: Exists}, true},
+		{"exists fails for unknown attributes", Condition{Attribute: "resource.owner", Operator: Exists}, false},
+		{"exists fails for empty strings", Condition{Attribute: "resource.assignee", Operator: Exists}, false},
+		{"exists fails for empty lists", Condition{Attribute: "resource.watchers", Operator: Exists}, false},
+		{"not_exists holds for empty values", Condition{Attribute: "resource.assignee", Operator: NotExists}, true},
+		{"not_exists fails for present attributes", Condition{Attribute: "resource.id", Operator: NotExists}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, tt.condition.holds(attributes, false))
+			assert.Equal(t, tt.expected, tt.condition.holds(attributes, true))
+		})
+	}
+
+	undecided := []struct {
+		name      string
+		condition Condition
+	}{
+		{"eq on empty attributes", Condition{Attribute: "resource.assignee", Operator: Equal, Value: ""}},
+		{"eq against empty attributes", Condition{Attribute: "resource.workspace_id", Operator: Equal, ValueOf: "resource.assignee"}},
+		{"ne on missing attributes", Condition{Attribute: "resource.owner", Operator: NotEqual, Value: "acme"}},
+		{"ne against missing attributes", Condition{Attribute: "resource.workspace_id", Operator: NotEqual, ValueOf: "resource.owner"}},
+		{"not_in on missing attributes", Condition{Attribute: "resource.owner", Operator: NotIn, Value: []any{"acme"}}},
+		{"contains on empty lists", Condition{Attribute: "resource.watchers", Operator: Contains, Value: "agent"}},
+	}
+
+	for _, tt := range undecided {
+		t.Run(tt.name+" never holds in allow rules and always holds in deny rules", func(t *testing.T) {
+			assert.False(t, tt.condition.holds(attributes, false))
+			assert.True(t, tt.condition.holds(attributes, true))
+		})
+	}
+}
+
+func TestRequestAttributes(t *testing.T) {
+	agent := newTestAgent("acme")
+
+	attributes := requestAttributes(Request{
+		Subject:           agent,
+		SubjectAttributes: map[string]any{"tenant_id": "globex", "roles": []string{"admin"}, "id": "root", "department": "sales"},
+		Resource: Resource{Type: "conversation", ID: "42", Attributes: map[string]any{
+			"type": "invoice", "id": "7", "workspace_id": "acme",
+		}},
+	})
+
+	t.Run("Derived attributes cannot be overridden by the request", func(t *testing.T) {
+		assert.Equal(t, "acme", attributes["subject.tenant_id"])
+		assert.Equal(t, []string{"agent"}, attributes["subject.roles"])
+		assert.Equal(t, agent.GetIdentifier(), attributes["subject.id"])
+		assert.Equal(t, "conversation", attributes["resource.type"])
+		assert.Equal(t, "42", attributes["resource.id"])
+	})
+
+	t.Run("Other attributes are added", func(t *testing.T) {
+		assert.Equal(t, "sales", attributes["subject.department"])
+		assert.Equal(t, "acme", attributes["resource.workspace_id"])
+	})
+}
+
+func TestRuleValidate(t *testing.T) {
+	valid := Rule{Name: "valid", Effect: Allow, Actions: []string{"read"}, Resources: []string{"*"}}
+
+	tests := []struct {
+		name   string
+		modify func(rule *Rule)
+	}{
+		{"An unknown effect", func(rule *Rule) { rule.Effect = "maybe" }},
+		{"No actions", func(rule *Rule) { rule.Actions = nil }},
+		{"No resources", func(rule *Rule) { rule.Resources = []string{} }},
+		{"An unknown operator", func(rule *Rule) {
+			rule.Conditions = []Condition{{Attribute: "subject.id", Operator: "like"}}
+		}},
+		{"An attribute of neither the subject nor the resource", func(rule *Rule) {
+			rule.Conditions = []Condition{{Attribute: "tenant_id", Operator: Exists}}
+		}},
+		{"A compared attribute of neither the subject nor the resource", func(rule *Rule) {
+			rule.Conditions = []Condition{{Attribute: "subject.id", Operator: Equal, ValueOf: "owner"}}
+		}},
+	}
+
+	require.NoError(t, valid.Validate())
+	for _, tt := range tests {
+		t.Run(tt.name+" is rejected", func(t *testing.T) {
+			rule := valid
+			tt.modify(&rule)
+
+			assert.Error(t, rule.Validate())
+			_, err := NewRulePolicy("rules", rule)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestRulePolicy(t *testing.T) {
+	ownWorkspace := Rule{
+		Name:      "agents-read-own-workspace",
+		Effect:    Allow,
+		Actions:   []string{"read"},
+		Resources: []string{"conversation"},
+		Conditions: []Condition{
+			{Attribute: "subject.roles", Operator: Contains, Value: "agent"},
+			{Attribute: "resource.workspace_id", Operator: Equal, ValueOf: "subject.tenant_id"},
+		},
+	}
+	archived := Rule{
+		Name:        "no-archived",
+		Description: "archived conversations are read only",
+		Effect:      Deny,
+		Actions:     []string{"*"},
+		Resources:   []string{"conversation"},
+		Conditions:  []Condition{{Attribute: "resource.archived", Operator: Equal, Value: true}},
+	}
+	policy, err := NewRulePolicy("conversations", ownWorkspace, archived)
+	require.NoError(t, err)
+
+	conversation := func(workspaceID string, archived bool) Resource {
+		return Resource{Type: "conversation", ID: "42", Attributes: map[string]any{"workspace_id": workspaceID, "archived": archived}}
+	}
+
+	tests := []struct {
+		name     string
+		request  Request
+		expected Decision
+	}{
+		{
+			name:     "Agents read the conversations of their workspace",
+			request:  Request{Subject: newTestAgent("acme"), Action: "read", Resource: conversation("acme", false)},
+			expected: Decision{Effect: Allow, Reason: "rule agents-read-own-workspace", Policy: "conversations/agents-read-own-workspace"},
+		},
+		{
+			name:     "Agents do not read the conversations of other workspaces",
+			request:  Request{Subject: newTestAgent("acme"), Action: "read", Resource: conversation("globex", false)},
+			expected: Decision{Effect: NotApplicable},
+		},
+		{
+			name:     "Agents without tenant do not read conversations without workspace",
+			request:  Request{Subject: newTestAgent(""), Action: "read", Resource: conversation("", false)},
+			expected: Decision{Effect: NotApplicable},
+		},
+		{
+			name:     "Deny rules win",
+			request:  Request{Subject: newTestAgent("acme"), Action: "read", Resource: conversation("acme", true)},
+			expected: Decision{Effect: Deny, Reason: "archived conversations are read only", Policy: "conversations/no-archived"},
+		},
+		{
+			name:     "Other actions are not applicable",
+			request:  Request{Subject: newTestAgent("acme"), Action: "delete", Resource: conversation("acme", false)},
+			expected: Decision{Effect: NotApplicable},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decision, err := policy.Evaluate(context.Background(), tt.request)
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, decision)
+		})
+	}
+}
+
+func TestRulePolicyMissingAttributes(t *testing.T) {
+	otherWorkspace := Rule{
+		Name:       "no-other-workspace",
+		Effect:     Deny,
+		Actions:    []string{"*"},
+		Resources:  []string{"conversation"},
+		Conditions: []Condition{{Attribute: "resource.workspace_id", Operator: NotEqual, ValueOf: "subject.tenant_id"}},
+	}
+	escalated := Rule{
+		Name:      "no-escalated",
+		Effect:    Deny,
+		Actions:   []string{"*"},
+		Resources: []string{"conversation"},
+		Conditions: []Condition{
+			{Attribute: "resource.level", Operator: Exists},
+			{Attribute: "resource.level", Operator: Equal, Value: "escalated"},
+		},
+	}
+	agents := Rule{
+		Name:       "agents",
+		Effect:     Allow,
+		Actions:    []string{"*"},
+		Resources:  []string{"conversation"},
+		Conditions: []Condition{{Attribute: "resource.workspace_id", Operator: Equal, ValueOf: "subject.tenant_id"}},
+	}
+	policy, err := NewRulePolicy("conversations", otherWorkspace, escalated, agents)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		subject    auth.SecurityContext
+		attributes map[string]any
+		expected   Effect
+	}{
+		{"Resources of the workspace are allowed", newTestAgent("acme"), map[string]any{"workspace_id": "acme"}, Allow},
+		{"Resources of other workspaces are denied", newTestAgent("acme"), map[string]any{"workspace_id": "globex"}, Deny},
+		{"Resources without workspace are denied", newTestAgent("acme"), nil, Deny},
+		{"Subjects without tenant are denied", newTestAgent(""), map[string]any{"workspace_id": "acme"}, Deny},
+		{"Deny rules checking the attribute exists ignore resources without it", newTestAgent("acme"), map[string]any{"workspace_id": "acme", "level": ""}, Allow},
+		{"Deny rules checking the attribute exists apply to resources with it", newTestAgent("acme"), map[string]any{"workspace_id": "acme", "level": "escalated"}, Deny},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decision, err := policy.Evaluate(context.Background(), Request{
+				Subject:  tt.subject,
+				Action:   "read",
+				Resource: Resource{Type: "conversation", ID: "42", Attributes: tt.attributes},
+			})
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, decision.Effect)
+		})
+	}
+}
+
+func TestLoadRulesFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"rules.yaml": {Data: []byte(`
+- name: agents-read-own-workspace
+  effect: allow
+  actions: [read]
+  resources: [conversation]
+  conditions:
+    - {attribute: resource.workspace_id, operator: eq, value_of: subject.tenant_id}
+`)},
+		"rules.json": {Data: []byte(`[{"name": "all", "effect": "deny", "actions": ["*"], "resources": ["*"]}]`)},
+	}
+
+	t.Run("Reads YAML and JSON rules", func(t *testing.T) {
+		fromYAML, err := LoadRulesFS(fsys, "rules.yaml")
+		require.NoError(t, err)
+		fromJSON, err := LoadRulesFS(fsys, "rules.json")
+		require.NoError(t, err)
+
+		require.Len(t, fromYAML, 1)
+		assert.Equal(t, Condition{Attribute: "resource.workspace_id", Operator: Equal, ValueOf: "subject.tenant_id"}, fromYAML[0].Conditions[0])
+		assert.Equal(t, []Rule{{Name: "all", Effect: Deny, Actions: []string{"*"}, Resources: []string{"*"}}}, fromJSON)
+	})
+}
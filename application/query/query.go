@@ -24,3 +24,22 @@ type Query interface {
 type Handler interface {
 	Handle(context.Context, Query) (interface{}, error)
 }
+
+// HandlerFunc is an adapter to allow the use of ordinary functions as query handlers.
+type HandlerFunc func(context.Context, Query) (interface{}, error)
+
+// Handle calls f(ctx, qry).
+func (f HandlerFunc) Handle(ctx context.Context, qry Query) (interface{}, error) {
+	return f(ctx, qry)
+}
+
+// Middleware decorates a query handler with cross-cutting behaviour.
+type Middleware func(Handler) Handler
+
+// WithMiddlewares wraps the handler with the given middlewares, the first one being the outermost.
+func WithMiddlewares(handler Handler, middlewares ...Middleware) Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	return handler
+}
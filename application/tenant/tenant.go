@@ -0,0 +1,42 @@
+package tenant
+
+import (
+	"context"
+	"errors"
+)
+
+// MetadataKey is the bus message metadata entry carrying the tenant ID.
+const MetadataKey = "tenant_id"
+
+// ErrMissingTenant is returned when tenant scoped data is accessed without a tenant in the context.
+var ErrMissingTenant = errors.New("tenant: no tenant in context")
+
+// ErrOtherTenant is returned when a statement would write the data of another tenant.
+var ErrOtherTenant = errors.New("tenant: data of another tenant")
+
+type contextKey struct{}
+
+type isolationKey struct{}
+
+// WithID returns a copy of ctx carrying the given tenant ID.
+func WithID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// IDFromContext returns the tenant ID carried by ctx.
+func IDFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(contextKey{}).(string)
+	return id, ok && id != ""
+}
+
+// WithoutIsolation returns a copy of ctx allowed to access the data of every tenant.
+// It is meant for system tasks such as migrations or cross-tenant reports.
+func WithoutIsolation(ctx context.Context) context.Context {
+	return context.WithValue(ctx, isolationKey{}, true)
+}
+
+// IsolationDisabled reports whether ctx was created by WithoutIsolation.
+func IsolationDisabled(ctx context.Context) bool {
+	disabled, _ := ctx.Value(isolationKey{}).(bool)
+	return disabled
+}
@@ -0,0 +1,28 @@
+package uow
+
+import (
+	"context"
+
+	"github.com/jperdior/chatbot-kit/application/command"
+)
+
+// UnitOfWork defines the expected behaviour from a unit of work.
+type UnitOfWork interface {
+	// Do runs fn inside a transaction carried by the context passed to fn.
+	// Calling Do again with that context starts a nested transaction.
+	Do(ctx context.Context, fn func(ctx context.Context) error) error
+	// AfterCommit registers a hook to run once the outermost transaction commits.
+	// Without an active transaction the hook runs immediately.
+	AfterCommit(ctx context.Context, hook func(ctx context.Context))
+}
+
+// CommandMiddleware runs every command handler inside a unit of work.
+func CommandMiddleware(unitOfWork UnitOfWork) command.Middleware {
+	return func(next command.Handler) command.Handler {
+		return command.HandlerFunc(func(ctx context.Context, cmd command.Command) error {
+			return unitOfWork.Do(ctx, func(ctx context.Context) error {
+				return next.Handle(ctx, cmd)
+			})
+		})
+	}
+}
@@ -9,6 +9,7 @@ type BaseAggregate struct {
 	events    []event.Event
 	CreatedAt time.Time
 	UpdatedAt time.Time
+	Version   int
 }
 
 func (a *BaseAggregate) PullEvents() []event.Event {
@@ -20,3 +21,23 @@ func (a *BaseAggregate) PullEvents() []event.Event {
 func (a *BaseAggregate) Record(event event.Event) {
 	a.events = append(a.events, event)
 }
+
+// AggregateRoot is implemented by aggregates embedding BaseAggregate.
+type AggregateRoot interface {
+	PullEvents() []event.Event
+	Record(event event.Event)
+}
+
+// Versioned is implemented by aggregates and models taking part in optimistic concurrency control.
+type Versioned interface {
+	GetVersion() int
+	SetVersion(version int)
+}
+
+func (a *BaseAggregate) GetVersion() int {
+	return a.Version
+}
+
+func (a *BaseAggregate) SetVersion(version int) {
+	a.Version = version
+}
@@ -8,12 +8,18 @@ type CriteriaInterface interface {
 	PageSize() int
 }
 
+// DeletedInclusionCriteria is implemented by criteria that can include soft-deleted rows.
+type DeletedInclusionCriteria interface {
+	IncludeDeleted() bool
+}
+
 type Criteria struct {
-	filters  []FilterInterface
-	sort     string
-	sortDir  string
-	page     int
-	pageSize int
+	filters        []FilterInterface
+	sort           string
+	sortDir        string
+	page           int
+	pageSize       int
+	includeDeleted bool
 }
 
 func NewCriteria(filters []FilterInterface, sort, sortDir string, page, pageSize int) *Criteria {
@@ -46,6 +52,16 @@ func (c *Criteria) PageSize() int {
 	return c.pageSize
 }
 
+// WithDeleted makes the criteria match soft-deleted rows too.
+func (c *Criteria) WithDeleted() *Criteria {
+	c.includeDeleted = true
+	return c
+}
+
+func (c *Criteria) IncludeDeleted() bool {
+	return c.includeDeleted
+}
+
 type FilterInterface interface {
 	Name() string
 	Operation() string
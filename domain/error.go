@@ -1,25 +1,182 @@
 package domain
 
-import (
-	"fmt"
-	"log"
+// ErrorCategory classifies domain errors so that the presentation layers can map them,
+// e.g. to HTTP or gRPC status codes.
+type ErrorCategory string
+
+const (
+	CategoryValidation   ErrorCategory = "validation"
+	CategoryNotFound     ErrorCategory = "not_found"
+	CategoryConflict     ErrorCategory = "conflict"
+	CategoryUnauthorized ErrorCategory = "unauthorized"
+	CategoryForbidden    ErrorCategory = "forbidden"
+	CategoryUnavailable  ErrorCategory = "unavailable"
+	// CategoryInternal is for failures the caller cannot fix, such as misconfigurations.
+	CategoryInternal ErrorCategory = "internal"
+)
+
+// Sentinels matching any DomainError of their category with errors.Is.
+var (
+	ErrValidation   = &DomainError{Category: CategoryValidation}
+	ErrNotFound     = &DomainError{Category: CategoryNotFound}
+	ErrConflict     = &DomainError{Category: CategoryConflict}
+	ErrUnauthorized = &DomainError{Category: CategoryUnauthorized}
+	ErrForbidden    = &DomainError{Category: CategoryForbidden}
+	ErrUnavailable  = &DomainError{Category: CategoryUnavailable}
+	ErrInternal     = &DomainError{Category: CategoryInternal}
 )
 
+// FieldError describes why a single field is invalid.
+type FieldError struct {
+	Field   string         `json:"field"`
+	Message string         `json:"message"`
+	Key     string         `json:"key,omitempty"`
+	Params  map[string]any `json:"-"`
+}
+
 type DomainError struct {
-	Message string
-	Key     string
+	Message  string
+	Key      string
+	Category ErrorCategory
+	Fields   []FieldError
+	// Params are interpolated in the localized message of Key.
+	Params map[string]any
+	cause  error
 }
 
 // Error implements the error interface for DomainError.
 func (e *DomainError) Error() string {
-	return fmt.Sprintf("DomainError{Message: %s, Key: %s}", e.Message, e.Key)
+	if e.cause != nil {
+		return e.Message + ": " + e.cause.Error()
+	}
+	return e.Message
+}
+
+// Unwrap returns the error wrapped with WithCause.
+func (e *DomainError) Unwrap() error {
+	return e.cause
+}
+
+// Is reports whether target is a DomainError with the same key and category, an empty key or
+// category in target matching any, so that errors.Is(err, ErrNotFound) matches every not found error.
+func (e *DomainError) Is(target error) bool {
+	t, ok := target.(*DomainError)
+	if !ok || (t.Key == "" && t.Category == "") {
+		return false
+	}
+	return (t.Key == "" || t.Key == e.Key) && (t.Category == "" || t.Category == e.Category)
+}
+
+// As lets errors.As extract the DomainError embedded in the typed errors, such as NotFoundError.
+func (e *DomainError) As(target any) bool {
+	if t, ok := target.(**DomainError); ok {
+		*t = e
+		return true
+	}
+	return false
+}
+
+// WithField returns a copy of the error with the details of an invalid field added. The With
+// methods never modify their receiver, so they are safe to call on shared errors.
+func (e *DomainError) WithField(field, message, key string) *DomainError {
+	clone := e.clone()
+	clone.Fields = append(clone.Fields, FieldError{Field: field, Message: message, Key: key})
+	return clone
+}
+
+// WithParam returns a copy of the error with a parameter of the localized message set.
+func (e *DomainError) WithParam(name string, value any) *DomainError {
+	clone := e.clone()
+	clone.Params[name] = value
+	return clone
 }
 
+// WithCause returns a copy of the error wrapping the underlying error, available through errors.Unwrap.
+func (e *DomainError) WithCause(cause error) *DomainError {
+	clone := e.clone()
+	clone.cause = cause
+	return clone
+}
+
+func (e *DomainError) clone() *DomainError {
+	clone := *e
+	clone.Fields = append([]FieldError(nil), e.Fields...)
+	clone.Params = make(map[string]any, len(e.Params)+1)
+	for name, value := range e.Params {
+		clone.Params[name] = value
+	}
+	return &clone
+}
+
+// NewDomainError returns a validation error, the category of most domain invariants.
 func NewDomainError(message, key string) *DomainError {
-	domainErr := &DomainError{
-		Message: message,
-		Key:     key,
+	return NewCategorizedError(CategoryValidation, message, key)
+}
+
+func NewCategorizedError(category ErrorCategory, message, key string) *DomainError {
+	return &DomainError{
+		Message:  message,
+		Key:      key,
+		Category: category,
+	}
+}
+
+func NewValidationError(message, key string, fields ...FieldError) *DomainError {
+	err := NewCategorizedError(CategoryValidation, message, key)
+	err.Fields = fields
+	return err
+}
+
+func NewConflictError(message, key string) *DomainError {
+	return NewCategorizedError(CategoryConflict, message, key)
+}
+
+func NewUnauthorizedError(message, key string) *DomainError {
+	return NewCategorizedError(CategoryUnauthorized, message, key)
+}
+
+func NewForbiddenError(message, key string) *DomainError {
+	return NewCategorizedError(CategoryForbidden, message, key)
+}
+
+func NewUnavailableError(message, key string) *DomainError {
+	return NewCategorizedError(CategoryUnavailable, message, key)
+}
+
+func NewInternalError(message, key string) *DomainError {
+	return NewCategorizedError(CategoryInternal, message, key)
+}
+
+// NotFoundError is returned when an entity cannot be found by its identifier.
+type NotFoundError struct {
+	*DomainError
+	Entity string
+	ID     string
+}
+
+func NewNotFoundError(entity, id string) *NotFoundError {
+	domainErr := NewCategorizedError(CategoryNotFound, entity+" with ID "+id+" not found", "not_found")
+	return &NotFoundError{
+		DomainError: domainErr.WithParam("entity", entity).WithParam("id", id),
+		Entity:      entity,
+		ID:          id,
+	}
+}
+
+// ConcurrencyConflictError is returned when an entity was modified by someone else since it was loaded.
+type ConcurrencyConflictError struct {
+	*DomainError
+	Entity  string
+	ID      string
+	Version int
+}
+
+func NewConcurrencyConflictError(entity, id string, version int) *ConcurrencyConflictError {
+	domainErr := NewCategorizedError(CategoryConflict, entity+" with ID "+id+" was modified concurrently", "concurrency_conflict")
+	return &ConcurrencyConflictError{
+		DomainError: domainErr.WithParam("entity", entity).WithParam("id", id),
+		Entity:      entity,
+		ID:          id,
+		Version:     version,
 	}
-	log.Println(domainErr) // Log the error
-	return domainErr
 }
@@ -0,0 +1,67 @@
+package domain
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDomainError(t *testing.T) {
+	t.Run("With methods leave shared errors untouched", func(t *testing.T) {
+		shared := NewUnauthorizedError("invalid token", "token.invalid")
+
+		withParam := shared.WithParam("reason", "expired")
+		withField := shared.WithField("token", "is expired", "token.expired")
+		withCause := shared.WithCause(errors.New("boom"))
+
+		assert.Empty(t, shared.Params)
+		assert.Empty(t, shared.Fields)
+		assert.Nil(t, errors.Unwrap(shared))
+		assert.Equal(t, "expired", withParam.Params["reason"])
+		assert.Len(t, withField.Fields, 1)
+		assert.Equal(t, "invalid token: boom", withCause.Error())
+		assert.True(t, errors.Is(withCause, shared))
+	})
+
+	t.Run("Chained With calls do not share their fields", func(t *testing.T) {
+		base := NewValidationError("invalid", "request.invalid").WithField("name", "is required", "validation.required")
+
+		first := base.WithField("email", "is required", "validation.required")
+		second := base.WithField("age", "is required", "validation.required")
+
+		assert.Len(t, base.Fields, 1)
+		assert.Equal(t, "email", first.Fields[1].Field)
+		assert.Equal(t, "age", second.Fields[1].Field)
+	})
+
+	t.Run("Sentinels can be specialized concurrently", func(t *testing.T) {
+		var wg sync.WaitGroup
+		for i := 0; i < 50; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				err := ErrNotFound.WithParam("id", i)
+				assert.Equal(t, i, err.Params["id"])
+			}(i)
+		}
+		wg.Wait()
+
+		assert.Empty(t, ErrNotFound.Params)
+	})
+
+	t.Run("Typed errors match their category", func(t *testing.T) {
+		err := NewNotFoundError("user", "42")
+
+		assert.True(t, errors.Is(err, ErrNotFound))
+		assert.False(t, errors.Is(err, ErrConflict))
+		assert.Equal(t, "42", err.Params["id"])
+	})
+
+	t.Run("Specifications that cannot be converted are internal errors", func(t *testing.T) {
+		_, err := SpecificationFilters[int](Not[int](NewSpecification(func(int) bool { return true })))
+
+		assert.True(t, errors.Is(err, ErrInternal))
+	})
+}
@@ -0,0 +1,135 @@
+package domain
+
+// Specification encapsulates a business rule that can be checked against a candidate.
+type Specification[T any] interface {
+	IsSatisfiedBy(candidate T) bool
+}
+
+// FilterSpecification is a Specification that can also be expressed as Criteria filters,
+// so the same rule can validate aggregates in memory and query the database.
+type FilterSpecification[T any] interface {
+	Specification[T]
+	Filters() []FilterInterface
+}
+
+// PredicateSpecification is a leaf Specification backed by a predicate and, optionally,
+// the filters that express the same rule for persistence. A specification built without a
+// predicate only serves queries and is satisfied by no candidate in memory.
+type PredicateSpecification[T any] struct {
+	predicate func(T) bool
+	filters   []FilterInterface
+}
+
+func NewSpecification[T any](predicate func(T) bool, filters ...FilterInterface) *PredicateSpecification[T] {
+	return &PredicateSpecification[T]{
+		predicate: predicate,
+		filters:   filters,
+	}
+}
+
+func (s *PredicateSpecification[T]) IsSatisfiedBy(candidate T) bool {
+	if s.predicate == nil {
+		return false
+	}
+	return s.predicate(candidate)
+}
+
+func (s *PredicateSpecification[T]) Filters() []FilterInterface {
+	return s.filters
+}
+
+// AndSpecification is satisfied when all of its specifications are satisfied, so an empty one
+// is satisfied by every candidate and matches every row.
+type AndSpecification[T any] struct {
+	specs []Specification[T]
+}
+
+func And[T any](specs ...Specification[T]) *AndSpecification[T] {
+	return &AndSpecification[T]{specs: specs}
+}
+
+func (s *AndSpecification[T]) IsSatisfiedBy(candidate T) bool {
+	for _, spec := range s.specs {
+		if !spec.IsSatisfiedBy(candidate) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *AndSpecification[T]) Specifications() []Specification[T] {
+	return s.specs
+}
+
+// OrSpecification is satisfied when any of its specifications is satisfied, so an empty one
+// is satisfied by no candidate and matches no row.
+type OrSpecification[T any] struct {
+	specs []Specification[T]
+}
+
+func Or[T any](specs ...Specification[T]) *OrSpecification[T] {
+	return &OrSpecification[T]{specs: specs}
+}
+
+func (s *OrSpecification[T]) IsSatisfiedBy(candidate T) bool {
+	for _, spec := range s.specs {
+		if spec.IsSatisfiedBy(candidate) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *OrSpecification[T]) Specifications() []Specification[T] {
+	return s.specs
+}
+
+// NotSpecification is satisfied when the wrapped specification is not.
+type NotSpecification[T any] struct {
+	spec Specification[T]
+}
+
+func Not[T any](spec Specification[T]) *NotSpecification[T] {
+	return &NotSpecification[T]{spec: spec}
+}
+
+func (s *NotSpecification[T]) IsSatisfiedBy(candidate T) bool {
+	return !s.spec.IsSatisfiedBy(candidate)
+}
+
+func (s *NotSpecification[T]) Specification() Specification[T] {
+	return s.spec
+}
+
+// SpecificationFilters flattens a specification made of filter specifications joined by And
+// into Criteria filters. Or and Not cannot be expressed as a flat filter list.
+func SpecificationFilters[T any](spec Specification[T]) ([]FilterInterface, error) {
+	switch s := spec.(type) {
+	case *AndSpecification[T]:
+		var filters []FilterInterface
+		for _, child := range s.specs {
+			childFilters, err := SpecificationFilters(child)
+			if err != nil {
+				return nil, err
+			}
+			filters = append(filters, childFilters...)
+		}
+		return filters, nil
+	case FilterSpecification[T]:
+		if len(s.Filters()) == 0 {
+			return nil, NewInternalError("specification has no filters", "specification.not_convertible")
+		}
+		return s.Filters(), nil
+	default:
+		return nil, NewInternalError("specification cannot be converted to filters", "specification.not_convertible")
+	}
+}
+
+// NewCriteriaFromSpecification builds a Criteria whose filters express the given specification.
+func NewCriteriaFromSpecification[T any](spec Specification[T], sort, sortDir string, page, pageSize int) (*Criteria, error) {
+	filters, err := SpecificationFilters(spec)
+	if err != nil {
+		return nil, err
+	}
+	return NewCriteria(filters, sort, sortDir, page, pageSize), nil
+}
@@ -0,0 +1,38 @@
+package domain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSpecification(t *testing.T) {
+	positive := NewSpecification(func(n int) bool { return n > 0 }, NewFilter("n", ">", 0))
+
+	t.Run("An empty And is satisfied by every candidate", func(t *testing.T) {
+		assert.True(t, And[int]().IsSatisfiedBy(-1))
+		assert.False(t, Not[int](And[int]()).IsSatisfiedBy(-1))
+	})
+
+	t.Run("An empty Or is satisfied by no candidate", func(t *testing.T) {
+		assert.False(t, Or[int]().IsSatisfiedBy(1))
+		assert.True(t, Not[int](Or[int]()).IsSatisfiedBy(1))
+	})
+
+	t.Run("Composites combine their children", func(t *testing.T) {
+		assert.True(t, And[int](positive, Not[int](Or[int]())).IsSatisfiedBy(1))
+		assert.False(t, Or[int](Not[int](positive), Or[int]()).IsSatisfiedBy(1))
+	})
+
+	t.Run("A query-only specification satisfies no candidate", func(t *testing.T) {
+		spec := NewSpecification[int](nil, NewFilter("n", ">", 0))
+
+		assert.NotPanics(t, func() { spec.IsSatisfiedBy(1) })
+		assert.False(t, spec.IsSatisfiedBy(1))
+
+		filters, err := SpecificationFilters[int](spec)
+		require.NoError(t, err)
+		assert.Len(t, filters, 1)
+	})
+}
@@ -8,13 +8,10 @@ type InvalidUserIDError struct {
 
 func NewInvalidUserIDError(userID string) *InvalidUserIDError {
 	return &InvalidUserIDError{
-		DomainError: &domain.DomainError{
-			Message: "User with ID " + userID + " is not valid",
-			Key:     "invalid_user_id",
-		},
+		DomainError: domain.NewValidationError("User with ID "+userID+" is not valid", "invalid_user_id").
+			WithParam("id", userID),
 	}
 }
 
-func (e InvalidUserIDError) Error() string {
-	return e.Message
-}
+// ErrNoUserID is returned when a context carries no user ID.
+var ErrNoUserID = domain.NewUnauthorizedError("no user ID in context", "authentication.required")
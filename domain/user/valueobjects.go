@@ -2,9 +2,24 @@ package user
 
 import (
 	"context"
+	"sync"
+
 	"github.com/jperdior/chatbot-kit/domain"
+	"github.com/jperdior/chatbot-kit/domain/uuidgen"
+)
+
+var (
+	idGeneratorMu sync.RWMutex
+	idGenerator   uuidgen.Generator
 )
 
+// SetIDGenerator sets the generator of user IDs, nil falls back to the uuidgen default.
+func SetIDGenerator(generator uuidgen.Generator) {
+	idGeneratorMu.Lock()
+	defer idGeneratorMu.Unlock()
+	idGenerator = generator
+}
+
 type UserID struct {
 	*domain.UUIDValueObject
 }
@@ -17,16 +32,28 @@ func NewUserID(value string) (*UserID, error) {
 	return &UserID{UUIDValueObject: uid}, nil
 }
 
+type userIDKey struct{}
+
+// ContextWithUserID returns a copy of ctx carrying the ID of the authenticated user.
+func ContextWithUserID(ctx context.Context, id *UserID) context.Context {
+	return context.WithValue(ctx, userIDKey{}, id)
+}
+
+// UserIDFromContext returns the ID of the authenticated user carried by ctx, or ErrNoUserID.
 func UserIDFromContext(ctx context.Context) (*UserID, error) {
-	userID := ctx.Value("ID").(string)
-	uid, err := domain.NewUuidValueObject(userID)
-	if err != nil {
-		return &UserID{}, NewInvalidUserIDError(userID)
+	id, ok := ctx.Value(userIDKey{}).(*UserID)
+	if !ok || id == nil || id.UUIDValueObject == nil {
+		return nil, ErrNoUserID
 	}
-	return &UserID{UUIDValueObject: uid}, nil
+	return id, nil
 }
 
 func NewRandomUserID() *UserID {
-	uid := domain.NewRandomUUIDValueObject()
-	return &UserID{UUIDValueObject: uid}
+	idGeneratorMu.RLock()
+	generator := idGenerator
+	idGeneratorMu.RUnlock()
+	if generator == nil {
+		return &UserID{UUIDValueObject: domain.NewRandomUUIDValueObject()}
+	}
+	return &UserID{UUIDValueObject: domain.NewUUIDValueObjectWith(generator)}
 }
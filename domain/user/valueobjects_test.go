@@ -0,0 +1,49 @@
+package user
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jperdior/chatbot-kit/domain/uuidgen"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetIDGenerator(t *testing.T) {
+	t.Cleanup(func() { SetIDGenerator(nil) })
+
+	t.Run("User IDs come from the configured generator", func(t *testing.T) {
+		SetIDGenerator(uuidgen.Sequence())
+
+		assert.Equal(t, "00000000-0000-4000-8000-000000000001", NewRandomUserID().String())
+	})
+
+	t.Run("Nil falls back to the uuidgen default", func(t *testing.T) {
+		SetIDGenerator(uuidgen.Sequence())
+		SetIDGenerator(nil)
+
+		assert.NotPanics(t, func() { NewRandomUserID() })
+		assert.NotEqual(t, NewRandomUserID().String(), NewRandomUserID().String())
+	})
+}
+
+func TestUserIDFromContext(t *testing.T) {
+	t.Run("Returns the user ID carried by the context", func(t *testing.T) {
+		id := NewRandomUserID()
+
+		found, err := UserIDFromContext(ContextWithUserID(context.Background(), id))
+
+		require.NoError(t, err)
+		assert.Equal(t, id, found)
+	})
+
+	t.Run("Fails without user ID instead of panicking", func(t *testing.T) {
+		ctx := context.WithValue(context.Background(), "ID", "not-typed")
+
+		_, err := UserIDFromContext(ctx)
+		_, nilErr := UserIDFromContext(ContextWithUserID(context.Background(), nil))
+
+		assert.ErrorIs(t, err, ErrNoUserID)
+		assert.ErrorIs(t, nilErr, ErrNoUserID)
+	})
+}
@@ -0,0 +1,86 @@
+package uuidgen
+
+import (
+	"encoding/binary"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Generator defines the expected behaviour from a UUID generator.
+type Generator interface {
+	New() uuid.UUID
+}
+
+// GeneratorFunc is an adapter to allow the use of ordinary functions as generators.
+type GeneratorFunc func() uuid.UUID
+
+// New calls f().
+func (f GeneratorFunc) New() uuid.UUID {
+	return f()
+}
+
+var (
+	// V4 generates random UUIDs.
+	V4 Generator = GeneratorFunc(uuid.New)
+	// V7 generates time-ordered UUIDs, which keep B-tree indexes compact.
+	V7 Generator = GeneratorFunc(func() uuid.UUID {
+		return uuid.Must(uuid.NewV7())
+	})
+)
+
+var (
+	defaultMu        sync.RWMutex
+	defaultGenerator = V4
+)
+
+// SetDefault sets the generator used when no specific one is configured, nil restores V4.
+func SetDefault(generator Generator) {
+	if generator == nil {
+		generator = V4
+	}
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	defaultGenerator = generator
+}
+
+// Default returns the generator used when no specific one is configured.
+func Default() Generator {
+	defaultMu.RLock()
+	defer defaultMu.RUnlock()
+	return defaultGenerator
+}
+
+// New generates a UUID with the default generator.
+func New() uuid.UUID {
+	return Default().New()
+}
+
+// Sequence returns a generator of deterministic UUIDs for tests, the first one being
+// 00000000-0000-4000-8000-000000000001.
+func Sequence() Generator {
+	var counter uint64
+	return GeneratorFunc(func() uuid.UUID {
+		var id uuid.UUID
+		binary.BigEndian.PutUint64(id[8:], atomic.AddUint64(&counter, 1))
+		id[6] = 0x40
+		id[8] |= 0x80
+		return id
+	})
+}
+
+// Timestamp returns the time embedded in a time-based UUID (v1, v6 or v7).
+func Timestamp(id uuid.UUID) (time.Time, bool) {
+	switch id.Version() {
+	case 7:
+		ms := int64(binary.BigEndian.Uint64(append([]byte{0, 0}, id[:6]...)))
+		return time.UnixMilli(ms), true
+	case 1, 6:
+		sec, nsec := id.Time().UnixTime()
+		return time.Unix(sec, nsec), true
+	default:
+		return time.Time{}, false
+	}
+}
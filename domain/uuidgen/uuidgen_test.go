@@ -0,0 +1,44 @@
+package uuidgen
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetDefault(t *testing.T) {
+	t.Cleanup(func() { SetDefault(nil) })
+
+	t.Run("The default generator can be replaced", func(t *testing.T) {
+		SetDefault(Sequence())
+
+		assert.Equal(t, "00000000-0000-4000-8000-000000000001", New().String())
+	})
+
+	t.Run("Nil restores the default generator", func(t *testing.T) {
+		SetDefault(Sequence())
+		SetDefault(nil)
+
+		assert.NotPanics(t, func() { New() })
+		assert.Equal(t, uuid.Version(4), New().Version())
+	})
+}
+
+func TestTimestamp(t *testing.T) {
+	t.Run("Returns the time of UUIDv7", func(t *testing.T) {
+		before := time.Now().Truncate(time.Millisecond)
+
+		timestamp, ok := Timestamp(V7.New())
+
+		assert.True(t, ok)
+		assert.WithinDuration(t, before, timestamp, time.Second)
+	})
+
+	t.Run("Random UUIDs have no time", func(t *testing.T) {
+		_, ok := Timestamp(V4.New())
+
+		assert.False(t, ok)
+	})
+}
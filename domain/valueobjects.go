@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/jperdior/chatbot-kit/domain/uuidgen"
 )
 
 // EmailValueObject represents a value object for emails
@@ -43,9 +44,22 @@ func (u UUIDValueObject) String() string {
 	return u.value.String()
 }
 
+// Timestamp returns the creation time embedded in time-based UUIDs such as UUIDv7.
+func (u UUIDValueObject) Timestamp() (time.Time, bool) {
+	return uuidgen.Timestamp(u.value)
+}
+
+// NewRandomUUIDValueObject generates a UUID with the default uuidgen generator.
 func NewRandomUUIDValueObject() *UUIDValueObject {
-	uid := uuid.New()
-	return &UUIDValueObject{value: uid}
+	return NewUUIDValueObjectWith(uuidgen.Default())
+}
+
+// NewUUIDValueObjectWith generates a UUID with the given generator, the default one when nil.
+func NewUUIDValueObjectWith(generator uuidgen.Generator) *UUIDValueObject {
+	if generator == nil {
+		generator = uuidgen.Default()
+	}
+	return &UUIDValueObject{value: generator.New()}
 }
 
 func NewUuidValueObject(value string) (*UUIDValueObject, error) {
@@ -85,14 +99,16 @@ func (pageValueObject *PageValueObject) Value() int {
 	return int(*pageValueObject)
 }
 
+const maxPageSize = 100
+
 type PageSizeValueObject int
 
 func NewPageSizeValueObject(value int) (PageSizeValueObject, error) {
 	if value < 1 {
 		return PageSizeValueObject(25), nil
 	}
-	if value > 100 {
-		return -1, NewDomainError("page size must be less than or equal to 100", "page_size.invalid")
+	if value > maxPageSize {
+		return -1, NewDomainError("page size must be less than or equal to 100", "page_size.invalid").WithParam("max", maxPageSize)
 	}
 	return PageSizeValueObject(value), nil
 }
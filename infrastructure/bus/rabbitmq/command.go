@@ -16,6 +16,7 @@ type CommandBus struct {
 	queue    string
 	handlers map[command.Type][]command.Handler
 	types    map[command.Type]reflect.Type
+	options  busOptions
 }
 
 // RegisterCommandType at startup
@@ -30,7 +31,7 @@ func (b *CommandBus) RegisterCommand(commandType command.Type, commandStruct int
 }
 
 // NewCommandBus initializes a new RabbitMQ-based CommandBus.
-func NewCommandBus(amqpURL, exchange, queue string) (*CommandBus, error) {
+func NewCommandBus(amqpURL, exchange, queue string, opts ...BusOption) (*CommandBus, error) {
 	conn, err := amqp.Dial(amqpURL)
 	if err != nil {
 		return nil, err
@@ -64,6 +65,7 @@ func NewCommandBus(amqpURL, exchange, queue string) (*CommandBus, error) {
 		queue:    queue,
 		handlers: make(map[command.Type][]command.Handler),
 		types:    make(map[command.Type]reflect.Type),
+		options:  newBusOptions(opts),
 	}, nil
 }
 
@@ -79,6 +81,7 @@ func (b *CommandBus) Dispatch(ctx context.Context, cmd command.Command) error {
 	envelope := command.CommandEnvelope{
 		CommandType: cmd.Type(),
 		Data:        marshalledCommand,
+		Metadata:    b.options.messageMetadata(ctx),
 	}
 
 	data, err := json.Marshal(envelope)
@@ -106,7 +109,9 @@ func (b *CommandBus) Register(cmdType command.Type, handler command.Handler) {
 	b.handlers[cmdType] = append(b.handlers[cmdType], handler)
 }
 
-// Consume listens for messages from the queue and dispatches them.
+// Consume listens for messages from the queue and dispatches them. Messages that cannot be
+// decoded or whose metadata is not trusted are rejected without requeueing, to the dead-letter
+// exchange of the queue when it has one. The message bodies, carrying tokens, are never logged.
 func (b *CommandBus) Consume() error {
 	log.Printf("Starting to consume from queue: %s", b.queue)
 	_, err := b.channel.QueueDeclare(
@@ -142,13 +147,13 @@ func (b *CommandBus) Consume() error {
 	}
 
 	for msg := range msgs {
-		log.Printf("Received message: %s", msg.Body)
 		var envelope command.CommandEnvelope
 		if err := json.Unmarshal(msg.Body, &envelope); err != nil {
 			log.Printf("Failed to decode event envelope from queue %s: %v", b.queue, err)
 			_ = msg.Nack(false, false) // Reject the message without requeueing
 			continue
 		}
+		log.Printf("Received command: %s", envelope.CommandType)
 		commandType, found := b.types[envelope.CommandType]
 		if !found {
 			log.Printf("Unknown event type: %s", envelope.CommandType)
@@ -178,8 +183,14 @@ func (b *CommandBus) Consume() error {
 			continue
 		}
 
+		ctx, err := b.options.contextFromMetadata(context.Background(), envelope.Metadata)
+		if err != nil {
+			log.Printf("Rejected command %s: %v", cmd.Type(), err)
+			_ = msg.Nack(false, false)
+			continue
+		}
 		for _, handler := range handlers {
-			if err := handler.Handle(context.Background(), cmd); err != nil {
+			if err := handler.Handle(ctx, cmd); err != nil {
 				log.Printf("Error handling command %s: %v", cmd.Type(), err)
 				_ = msg.Nack(false, true) // Requeue on failure
 				continue
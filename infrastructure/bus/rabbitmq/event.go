@@ -19,6 +19,7 @@ type EventBus struct {
 	queues   []string
 	handlers map[event.Type][]event.Handler
 	types    map[event.Type]reflect.Type
+	options  busOptions
 }
 
 // RegisterEventType at startup
@@ -27,7 +28,7 @@ func (b *EventBus) RegisterEventType(eventType event.Type, eventStruct interface
 }
 
 // NewEventBus initializes a new RabbitMQ-based EventBus.
-func NewEventBus(amqpURL, exchange string) (*EventBus, error) {
+func NewEventBus(amqpURL, exchange string, opts ...BusOption) (*EventBus, error) {
 	conn, err := amqp.Dial(amqpURL)
 	if err != nil {
 		return nil, err
@@ -60,6 +61,7 @@ func NewEventBus(amqpURL, exchange string) (*EventBus, error) {
 		exchange: exchange,
 		handlers: make(map[event.Type][]event.Handler),
 		types:    make(map[event.Type]reflect.Type),
+		options:  newBusOptions(opts),
 	}, nil
 }
 
@@ -80,6 +82,7 @@ func (b *EventBus) Publish(ctx context.Context, events []event.Event) error {
 		envelope := event.EventEnvelope{
 			EventType: evt.Type(),
 			Data:      marshalledEvent,
+			Metadata:  b.options.messageMetadata(ctx),
 		}
 		data, err := json.Marshal(envelope)
 		if err != nil {
@@ -127,7 +130,9 @@ func (b *EventBus) BindQueue(queue, routingKey string) error {
 	return nil
 }
 
-// Consume listens for messages from the specified queue and dispatches them.
+// Consume listens for messages from the specified queue and dispatches them. Messages that cannot
+// be decoded or whose metadata is not trusted are rejected without requeueing, to the dead-letter
+// exchange of the queue when it has one. The message bodies, carrying tokens, are never logged.
 func (b *EventBus) Consume(queue string) error {
 	log.Printf("Consuming from queue %s\n", queue)
 	msgs, err := b.channel.Consume(
@@ -145,13 +150,13 @@ func (b *EventBus) Consume(queue string) error {
 	}
 	log.Printf("Consumer successfully started on queue: %s", queue)
 	for msg := range msgs { // Blocking loop, processes messages one by one
-		log.Printf("Received message: %s", msg.Body)
 		var envelope event.EventEnvelope
 		if err := json.Unmarshal(msg.Body, &envelope); err != nil {
 			log.Printf("Failed to decode event envelope from queue %s: %v", queue, err)
 			_ = msg.Nack(false, false) // Reject the message without requeueing
 			continue
 		}
+		log.Printf("Received event %s from queue %s", envelope.EventType, queue)
 
 		eventType, found := b.types[envelope.EventType]
 		if !found {
@@ -184,8 +189,14 @@ func (b *EventBus) Consume(queue string) error {
 		}
 
 		// Process handlers synchronously (one at a time)
+		ctx, err := b.options.contextFromMetadata(context.Background(), envelope.Metadata)
+		if err != nil {
+			log.Printf("Rejected event %s from queue %s: %v", envelope.EventType, queue, err)
+			_ = msg.Nack(false, false)
+			continue
+		}
 		for _, handler := range handlers {
-			err := handler.Handle(context.Background(), evt)
+			err := handler.Handle(ctx, evt)
 			if err != nil {
 				log.Printf("Error handling event %s from queue %s: %v", envelope.EventType, queue, err)
 				_ = msg.Nack(false, true) // Requeue the message on failure
@@ -0,0 +1,114 @@
+package rabbitmq
+
+import (
+	"context"
+
+	"github.com/jperdior/chatbot-kit/application/auth"
+	"github.com/jperdior/chatbot-kit/application/tenant"
+)
+
+type busOptions struct {
+	securityProvider auth.SecurityProvider
+	trustPolicy      auth.TrustPolicy
+	propagateToken   bool
+	permissions      auth.PermissionResolver
+}
+
+type BusOption func(*busOptions)
+
+// WithSecurityContextPropagation sends the security context found by provider along with the
+// messages, and runs their handlers with the security context the trust policy restores and its
+// tenant. Without it, or unless the policy is an auth.TenantTrustPolicy, messages naming a tenant
+// without an actor of that tenant are rejected.
+func WithSecurityContextPropagation(provider auth.SecurityProvider, trustPolicy auth.TrustPolicy) BusOption {
+	return func(o *busOptions) {
+		o.securityProvider = provider
+		o.trustPolicy = trustPolicy
+	}
+}
+
+// WithTokenPropagation also sends the original token of the actor, for auth.TrustToken to
+// verify it again on consume.
+func WithTokenPropagation() BusOption {
+	return func(o *busOptions) {
+		o.propagateToken = true
+	}
+}
+
+// WithPermissionResolver resolves the permissions of the users and clients restored by the
+// trust policy, e.g. with an auth.RBAC.
+func WithPermissionResolver(resolver auth.PermissionResolver) BusOption {
+	return func(o *busOptions) {
+		o.permissions = resolver
+	}
+}
+
+func newBusOptions(opts []BusOption) busOptions {
+	options := busOptions{}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return options
+}
+
+// messageMetadata collects the context values travelling with a message.
+func (o busOptions) messageMetadata(ctx context.Context) map[string]string {
+	metadata := make(map[string]string)
+	if tenantID, ok := tenant.IDFromContext(ctx); ok {
+		metadata[tenant.MetadataKey] = tenantID
+	}
+	if o.securityProvider != nil {
+		if securityContext := o.securityProvider.GetSecurityContext(ctx); securityContext != nil {
+			var token string
+			if o.propagateToken {
+				token, _ = auth.TokenFromContext(ctx)
+			}
+			for key, value := range auth.SecurityContextMetadata(securityContext, token) {
+				metadata[key] = value
+			}
+		}
+	}
+	return metadata
+}
+
+// contextFromMetadata restores the context values travelling with a message. The tenant is the
+// one of the actor restored by the trust policy, the message failing when it names another one.
+// The tenant of a message whose actor has none must be vouched for by an auth.TenantTrustPolicy.
+func (o busOptions) contextFromMetadata(ctx context.Context, metadata map[string]string) (context.Context, error) {
+	tenantID := metadata[tenant.MetadataKey]
+	var actorTenantID string
+	if o.trustPolicy != nil {
+		securityContext, err := o.trustPolicy.Restore(ctx, metadata)
+		if err != nil {
+			return ctx, err
+		}
+		if securityContext != nil {
+			actorTenantID = securityContext.GetTenantID()
+			if o.permissions != nil {
+				securityContext = auth.WithPermissions(securityContext, o.permissions)
+			}
+			ctx = auth.WithSecurityContext(ctx, securityContext)
+			if token, ok := metadata[auth.MetadataActorToken]; ok {
+				ctx = auth.WithToken(ctx, token)
+			}
+		}
+	}
+	switch {
+	case actorTenantID != "":
+		if tenantID != "" && tenantID != actorTenantID {
+			return ctx, auth.ErrUntrustedActor
+		}
+		tenantID = actorTenantID
+	case tenantID != "" && !o.trustsTenant():
+		return ctx, auth.ErrUntrustedTenant
+	}
+	if tenantID != "" {
+		ctx = tenant.WithID(ctx, tenantID)
+	}
+	return ctx, nil
+}
+
+func (o busOptions) trustsTenant() bool {
+	policy, ok := o.trustPolicy.(auth.TenantTrustPolicy)
+	return ok && policy.TrustsTenant()
+}
@@ -0,0 +1,249 @@
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jperdior/chatbot-kit/application/auth"
+	"github.com/jperdior/chatbot-kit/application/tenant"
+	"github.com/jperdior/chatbot-kit/domain/user"
+	"github.com/jperdior/chatbot-kit/infrastructure/token"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testTokenVerifier accepts the tokens it maps to a security context, whatever the time.
+type testTokenVerifier map[string]auth.SecurityContext
+
+func (v testTokenVerifier) Verify(_ context.Context, token string, _ time.Time) (auth.SecurityContext, error) {
+	securityContext, ok := v[token]
+	if !ok {
+		return nil, errors.New("invalid token")
+	}
+	return securityContext, nil
+}
+
+func newTestAgent(tenantID string) *auth.UserSecurityContext {
+	agent := auth.NewUserSecurityContext(user.NewRandomUserID(), "agent@example.com", []string{"agent"})
+	agent.TenantID = tenantID
+	agent.Scopes = []string{"chats:read"}
+	return agent
+}
+
+func TestMessageMetadata(t *testing.T) {
+	agent := newTestAgent("acme")
+	ctx := auth.WithToken(auth.WithSecurityContext(tenant.WithID(context.Background(), "acme"), agent), "agent-token")
+
+	t.Run("Only the tenant travels without propagation", func(t *testing.T) {
+		metadata := newBusOptions(nil).messageMetadata(ctx)
+
+		assert.Equal(t, map[string]string{tenant.MetadataKey: "acme"}, metadata)
+	})
+
+	t.Run("The security context travels with propagation", func(t *testing.T) {
+		options := newBusOptions([]BusOption{WithSecurityContextPropagation(auth.NewJWTSecurityProvider(), auth.TrustAsserted)})
+
+		metadata := options.messageMetadata(ctx)
+
+		assert.Equal(t, agent.GetIdentifier(), metadata[auth.MetadataActorID])
+		assert.NotContains(t, metadata, auth.MetadataActorToken)
+	})
+
+	t.Run("The token travels with token propagation", func(t *testing.T) {
+		options := newBusOptions([]BusOption{
+			WithSecurityContextPropagation(auth.NewJWTSecurityProvider(), auth.TrustAsserted),
+			WithTokenPropagation(),
+		})
+
+		metadata := options.messageMetadata(ctx)
+
+		assert.Equal(t, "agent-token", metadata[auth.MetadataActorToken])
+	})
+}
+
+func TestContextFromMetadata(t *testing.T) {
+	options := newBusOptions([]BusOption{WithSecurityContextPropagation(auth.NewJWTSecurityProvider(), auth.TrustAsserted)})
+
+	t.Run("Restores the actor and its tenant", func(t *testing.T) {
+		agent := newTestAgent("acme")
+
+		ctx, err := options.contextFromMetadata(context.Background(), auth.SecurityContextMetadata(agent, ""))
+
+		require.NoError(t, err)
+		restored, err := auth.FromContext(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, agent, restored)
+		tenantID, _ := tenant.IDFromContext(ctx)
+		assert.Equal(t, "acme", tenantID)
+	})
+
+	t.Run("Resolves the permissions of the restored actor", func(t *testing.T) {
+		rbac, err := auth.NewRBAC([]auth.Role{{Name: "agent", Permissions: []string{"chats:read", "chats:write"}}})
+		require.NoError(t, err)
+		rbac.SetScopes(map[string][]string{"chats:read": {"chats:read"}})
+		options := newBusOptions([]BusOption{
+			WithSecurityContextPropagation(auth.NewJWTSecurityProvider(), auth.TrustAsserted),
+			WithPermissionResolver(rbac),
+		})
+
+		ctx, err := options.contextFromMetadata(context.Background(), auth.SecurityContextMetadata(newTestAgent("acme"), ""))
+
+		require.NoError(t, err)
+		restored, err := auth.FromContext(ctx)
+		require.NoError(t, err)
+		assert.True(t, restored.Can("chats:read"))
+		assert.False(t, restored.Can("chats:write"), "the scopes of the actor narrow down its roles")
+	})
+
+	t.Run("Restores the tenant a tenant trust policy vouches for", func(t *testing.T) {
+		anonymous := newBusOptions([]BusOption{WithSecurityContextPropagation(auth.NewJWTSecurityProvider(), auth.TrustTenant(auth.TrustNone))})
+
+		ctx, err := anonymous.contextFromMetadata(context.Background(), map[string]string{tenant.MetadataKey: "acme"})
+
+		require.NoError(t, err)
+		tenantID, _ := tenant.IDFromContext(ctx)
+		assert.Equal(t, "acme", tenantID)
+		_, err = auth.FromContext(ctx)
+		assert.ErrorIs(t, err, auth.ErrNoSecurityContext)
+	})
+
+	t.Run("Rejects the tenant no trust policy vouches for", func(t *testing.T) {
+		agent := newTestAgent("")
+		verifier := auth.TrustToken(testTokenVerifier{"agent-token": agent}, time.Minute)
+		metadata := auth.SecurityContextMetadata(agent, "agent-token")
+		metadata[tenant.MetadataKey] = "acme"
+
+		for name, options := range map[string]busOptions{
+			"without propagation": newBusOptions(nil),
+			"with TrustNone":      newBusOptions([]BusOption{WithSecurityContextPropagation(auth.NewJWTSecurityProvider(), auth.TrustNone)}),
+			"with TrustToken":     newBusOptions([]BusOption{WithSecurityContextPropagation(auth.NewJWTSecurityProvider(), verifier)}),
+		} {
+			_, err := options.contextFromMetadata(context.Background(), metadata)
+
+			assert.ErrorIs(t, err, auth.ErrUntrustedTenant, name)
+		}
+	})
+
+	t.Run("Restores the tenant of the verified actor", func(t *testing.T) {
+		agent := newTestAgent("acme")
+		verified := newBusOptions([]BusOption{WithSecurityContextPropagation(auth.NewJWTSecurityProvider(),
+			auth.TrustToken(testTokenVerifier{"agent-token": agent}, time.Minute))})
+
+		ctx, err := verified.contextFromMetadata(context.Background(), auth.SecurityContextMetadata(agent, "agent-token"))
+
+		require.NoError(t, err)
+		tenantID, _ := tenant.IDFromContext(ctx)
+		assert.Equal(t, "acme", tenantID)
+		token, _ := auth.TokenFromContext(ctx)
+		assert.Equal(t, "agent-token", token)
+	})
+
+	t.Run("Rejects messages naming another tenant than the actor's", func(t *testing.T) {
+		metadata := auth.SecurityContextMetadata(newTestAgent("acme"), "")
+		metadata[tenant.MetadataKey] = "globex"
+
+		_, err := options.contextFromMetadata(context.Background(), metadata)
+
+		assert.ErrorIs(t, err, auth.ErrUntrustedActor)
+	})
+
+	t.Run("Rejects actors the trust policy rejects", func(t *testing.T) {
+		_, err := options.contextFromMetadata(context.Background(), map[string]string{auth.MetadataActorType: "robot"})
+
+		assert.ErrorIs(t, err, auth.ErrUntrustedActor)
+	})
+}
+
+func signTestToken(t *testing.T, claims jwt.MapClaims) string {
+	t.Helper()
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("secret"))
+	require.NoError(t, err)
+	return signed
+}
+
+func TestTokenPropagationRoundTrip(t *testing.T) {
+	rbac, err := auth.NewRBAC([]auth.Role{{Name: "agent", Permissions: []string{"chats:write"}}})
+	require.NoError(t, err)
+	verifier := token.NewVerifier("secret", token.WithPermissionResolver(rbac))
+	options := newBusOptions([]BusOption{
+		WithSecurityContextPropagation(auth.NewJWTSecurityProvider(), auth.TrustToken(verifier, time.Minute)),
+		WithTokenPropagation(),
+	})
+	userClaims := func(expiresAt time.Time) jwt.MapClaims {
+		return jwt.MapClaims{
+			"token_type": "user",
+			"ID":         "0f8fad5b-d9cb-469f-a165-70867728950e",
+			"email":      "agent@example.com",
+			"roles":      []string{"agent"},
+			"tenant_id":  "acme",
+			"iat":        time.Now().Add(-time.Hour).Unix(),
+			"exp":        expiresAt.Unix(),
+		}
+	}
+	// publish sends a message as the actor the JWT middleware would authenticate with the token.
+	publish := func(t *testing.T, signed string) map[string]string {
+		t.Helper()
+		securityContext, err := verifier.Verify(context.Background(), signed, time.Now())
+		require.NoError(t, err)
+		ctx := auth.WithToken(auth.WithSecurityContext(tenant.WithID(context.Background(), "acme"), securityContext), signed)
+		return options.messageMetadata(ctx)
+	}
+
+	t.Run("Consumers restore the actor from its verified token", func(t *testing.T) {
+		metadata := publish(t, signTestToken(t, userClaims(time.Now().Add(time.Hour))))
+
+		ctx, err := options.contextFromMetadata(context.Background(), metadata)
+
+		require.NoError(t, err)
+		restored, err := auth.FromContext(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, "0f8fad5b-d9cb-469f-a165-70867728950e", restored.GetIdentifier())
+		assert.True(t, restored.Can("chats:write"))
+		tenantID, _ := tenant.IDFromContext(ctx)
+		assert.Equal(t, "acme", tenantID)
+	})
+
+	t.Run("Tokens expired after the message was sent are still trusted", func(t *testing.T) {
+		metadata := publish(t, signTestToken(t, userClaims(time.Now().Add(time.Hour))))
+		// The message was sent 30 seconds ago with a token that expired since.
+		metadata[auth.MetadataSentAt] = time.Now().Add(-30 * time.Second).UTC().Format(time.RFC3339Nano)
+		metadata[auth.MetadataActorToken] = signTestToken(t, userClaims(time.Now().Add(-10*time.Second)))
+
+		_, err := options.contextFromMetadata(context.Background(), metadata)
+
+		require.NoError(t, err)
+	})
+
+	t.Run("Tokens expired before the message was sent are rejected", func(t *testing.T) {
+		metadata := publish(t, signTestToken(t, userClaims(time.Now().Add(time.Hour))))
+		metadata[auth.MetadataActorToken] = signTestToken(t, userClaims(time.Now().Add(-10*time.Second)))
+
+		_, err := options.contextFromMetadata(context.Background(), metadata)
+
+		assert.ErrorIs(t, err, auth.ErrUntrustedActor)
+		assert.ErrorIs(t, err, token.ErrInvalidToken)
+	})
+
+	t.Run("Tampered actors are rejected", func(t *testing.T) {
+		metadata := publish(t, signTestToken(t, userClaims(time.Now().Add(time.Hour))))
+		metadata[auth.MetadataActorID] = "11111111-1111-1111-1111-111111111111"
+
+		_, err := options.contextFromMetadata(context.Background(), metadata)
+
+		assert.ErrorIs(t, err, auth.ErrUntrustedActor)
+	})
+
+	t.Run("Tokens signed with another key are rejected", func(t *testing.T) {
+		metadata := publish(t, signTestToken(t, userClaims(time.Now().Add(time.Hour))))
+		forged, err := jwt.NewWithClaims(jwt.SigningMethodHS256, userClaims(time.Now().Add(time.Hour))).SignedString([]byte("another secret"))
+		require.NoError(t, err)
+		metadata[auth.MetadataActorToken] = forged
+
+		_, err = options.contextFromMetadata(context.Background(), metadata)
+
+		assert.ErrorIs(t, err, auth.ErrUntrustedActor)
+	})
+}
@@ -0,0 +1,34 @@
+package lock
+
+import (
+	"context"
+
+	"github.com/jperdior/chatbot-kit/application/lock"
+	"github.com/jperdior/chatbot-kit/application/tenant"
+)
+
+// TenantLock namespaces the keys of another lock with the tenant found in the context,
+// so tenants never contend for nor release each other's locks.
+type TenantLock struct {
+	lock lock.Lock
+}
+
+func NewTenantLock(lock lock.Lock) *TenantLock {
+	return &TenantLock{lock: lock}
+}
+
+func (t *TenantLock) Acquire(ctx context.Context, key string) (bool, error) {
+	return t.lock.Acquire(ctx, tenantKey(ctx, key))
+}
+
+func (t *TenantLock) Release(ctx context.Context, key string) error {
+	return t.lock.Release(ctx, tenantKey(ctx, key))
+}
+
+// tenantKey prefixes the key with the tenant, keys without a tenant in the context stay global.
+func tenantKey(ctx context.Context, key string) string {
+	if tenantID, ok := tenant.IDFromContext(ctx); ok {
+		return "tenant:" + tenantID + ":" + key
+	}
+	return key
+}
@@ -1,10 +1,16 @@
 package gorm
 
 import (
+	"context"
 	"database/sql/driver"
 	"fmt"
+	"sync"
+
 	"github.com/google/uuid"
 	"github.com/jperdior/chatbot-kit/domain"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
 )
 
 type Adapter interface {
@@ -12,34 +18,108 @@ type Adapter interface {
 	Value() (driver.Value, error)
 }
 
+// UUIDStorage is the representation used to store UUIDs in the database.
+type UUIDStorage int
+
+const (
+	// UUIDStorageBinary stores UUIDs as 16 raw bytes.
+	UUIDStorageBinary UUIDStorage = iota
+	// UUIDStorageString stores UUIDs as their 36 characters text form.
+	UUIDStorageString
+	// UUIDStorageNative stores UUIDs in the native UUID type of the database.
+	UUIDStorageNative
+)
+
+var (
+	uuidStoragesMu sync.RWMutex
+	uuidStorages   = map[string]UUIDStorage{
+		"mysql":     UUIDStorageBinary,
+		"postgres":  UUIDStorageNative,
+		"sqlserver": UUIDStorageNative,
+		"sqlite":    UUIDStorageString,
+	}
+)
+
+// SetUUIDStorage overrides the UUID representation used for the given dialect.
+func SetUUIDStorage(dialect string, storage UUIDStorage) {
+	uuidStoragesMu.Lock()
+	defer uuidStoragesMu.Unlock()
+	uuidStorages[dialect] = storage
+}
+
+// UUIDStorageFor returns the UUID representation used for the given dialect, binary by default.
+func UUIDStorageFor(dialect string) UUIDStorage {
+	uuidStoragesMu.RLock()
+	defer uuidStoragesMu.RUnlock()
+	storage, ok := uuidStorages[dialect]
+	if !ok {
+		return UUIDStorageBinary
+	}
+	return storage
+}
+
 type UUIDAdapter struct {
 	ValueObject domain.UUIDValueObjectInterface
 }
 
+// Scan accepts binary, text and native UUID representations.
 func (uidAdapter *UUIDAdapter) Scan(value interface{}) error {
 	if value == nil {
 		uidAdapter.ValueObject = domain.UUIDValueObject{} // If value is nil, set it to the zero value
 		return nil
 	}
 
-	bytes, ok := value.([]byte)
-	if !ok {
-		return fmt.Errorf("failed to scan UUID: expected []byte but got %T", value)
+	var parsedUUID uuid.UUID
+	var err error
+	switch v := value.(type) {
+	case []byte:
+		if len(v) == 16 {
+			parsedUUID, err = uuid.FromBytes(v)
+		} else {
+			parsedUUID, err = uuid.ParseBytes(v)
+		}
+	case string:
+		parsedUUID, err = uuid.Parse(v)
+	case [16]byte:
+		parsedUUID = v
+	case uuid.UUID:
+		parsedUUID = v
+	default:
+		return fmt.Errorf("failed to scan UUID: unsupported type %T", value)
 	}
-
-	parsedUUID, err := uuid.FromBytes(bytes)
 	if err != nil {
-		return fmt.Errorf("failed to parse UUID from bytes: %w", err)
+		return fmt.Errorf("failed to parse UUID: %w", err)
 	}
 
-	uidAdapter.ValueObject, _ = domain.NewUuidValueObject(parsedUUID.String())
+	valueObject, err := domain.NewUuidValueObject(parsedUUID.String())
+	if err != nil {
+		return fmt.Errorf("failed to build UUID value object: %w", err)
+	}
+	uidAdapter.ValueObject = valueObject
 	return nil
 }
 
+// Value returns the binary representation, used when the dialect is unknown.
 func (uidAdapter UUIDAdapter) Value() (driver.Value, error) {
+	return uidAdapter.valueFor(UUIDStorageBinary)
+}
+
+// GormValue implements the gorm.Valuer interface, using the representation of the dialect.
+func (uidAdapter UUIDAdapter) GormValue(_ context.Context, db *gorm.DB) clause.Expr {
+	value, err := uidAdapter.valueFor(UUIDStorageFor(db.Dialector.Name()))
+	if err != nil {
+		_ = db.AddError(err)
+	}
+	return clause.Expr{SQL: "?", Vars: []interface{}{value}}
+}
+
+func (uidAdapter UUIDAdapter) valueFor(storage UUIDStorage) (driver.Value, error) {
 	if uidAdapter.ValueObject == nil {
 		return nil, nil
 	}
+	if storage != UUIDStorageBinary {
+		return uidAdapter.ValueObject.String(), nil
+	}
 	bytes, err := uidAdapter.ValueObject.Value().MarshalBinary()
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal UUID to bytes: %w", err)
@@ -47,6 +127,31 @@ func (uidAdapter UUIDAdapter) Value() (driver.Value, error) {
 	return bytes, nil
 }
 
-func (uidAdapter *UUIDAdapter) GormDataType() string {
+func (uidAdapter UUIDAdapter) GormDataType() string {
 	return "uuid"
 }
+
+// GormDBDataType returns the column type matching the UUID representation of the dialect.
+func (uidAdapter UUIDAdapter) GormDBDataType(db *gorm.DB, _ *schema.Field) string {
+	dialect := db.Dialector.Name()
+	switch UUIDStorageFor(dialect) {
+	case UUIDStorageNative:
+		switch dialect {
+		case "postgres":
+			return "uuid"
+		case "sqlserver":
+			return "uniqueidentifier"
+		}
+		return "char(36)"
+	case UUIDStorageString:
+		if dialect == "sqlite" {
+			return "text"
+		}
+		return "char(36)"
+	default:
+		if dialect == "sqlite" {
+			return "blob"
+		}
+		return "binary(16)"
+	}
+}
@@ -0,0 +1,97 @@
+package gorm
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/jperdior/chatbot-kit/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testDevice struct {
+	ID    UUIDAdapter `gorm:"primaryKey"`
+	Owner UUIDAdapter
+}
+
+func TestUUIDAdapterStorage(t *testing.T) {
+	tests := []struct {
+		dialect    string
+		columnType string
+		stored     interface{}
+	}{
+		{dialect: "mysql", columnType: "binary(16)", stored: []byte{}},
+		{dialect: "postgres", columnType: "uuid", stored: ""},
+		{dialect: "sqlserver", columnType: "uniqueidentifier", stored: ""},
+		{dialect: "sqlite", columnType: "text", stored: ""},
+		{dialect: "clickhouse", columnType: "binary(16)", stored: []byte{}},
+	}
+
+	for _, tt := range tests {
+		t.Run("The "+tt.dialect+" dialect stores UUIDs as "+tt.columnType, func(t *testing.T) {
+			db := newTestDBAs(t, tt.dialect, &testDevice{})
+			id := domain.NewRandomUUIDValueObject()
+			adapter := UUIDAdapter{ValueObject: id}
+
+			assert.Equal(t, tt.columnType, adapter.GormDBDataType(db, nil))
+			value := adapter.GormValue(nil, db).Vars[0]
+			assert.IsType(t, tt.stored, value)
+
+			device := &testDevice{ID: adapter, Owner: UUIDAdapter{ValueObject: domain.NewRandomUUIDValueObject()}}
+			require.NoError(t, db.Create(device).Error)
+			var stored testDevice
+			require.NoError(t, db.Where("id = ?", adapter).Take(&stored).Error)
+			assert.Equal(t, id.String(), stored.ID.ValueObject.String())
+			assert.Equal(t, device.Owner.ValueObject.String(), stored.Owner.ValueObject.String())
+
+			var raw interface{}
+			require.NoError(t, db.Table("test_devices").Select("id").Row().Scan(&raw))
+			assert.IsType(t, tt.stored, raw)
+		})
+	}
+
+	t.Run("The storage of a dialect can be overridden", func(t *testing.T) {
+		SetUUIDStorage("sqlite", UUIDStorageBinary)
+		t.Cleanup(func() { SetUUIDStorage("sqlite", UUIDStorageString) })
+		db := newTestDB(t)
+
+		assert.Equal(t, "blob", UUIDAdapter{}.GormDBDataType(db, nil))
+		assert.IsType(t, []byte{}, UUIDAdapter{ValueObject: domain.NewRandomUUIDValueObject()}.GormValue(nil, db).Vars[0])
+	})
+}
+
+func TestUUIDAdapterScan(t *testing.T) {
+	id := uuid.New()
+	binary, err := id.MarshalBinary()
+	require.NoError(t, err)
+
+	for name, value := range map[string]interface{}{
+		"binary":    binary,
+		"text":      []byte(id.String()),
+		"string":    id.String(),
+		"array":     [16]byte(id),
+		"uuid.UUID": id,
+	} {
+		t.Run("Scans "+name+" values", func(t *testing.T) {
+			var adapter UUIDAdapter
+
+			require.NoError(t, adapter.Scan(value))
+
+			assert.Equal(t, id.String(), adapter.ValueObject.String())
+		})
+	}
+
+	t.Run("Rejects unsupported values", func(t *testing.T) {
+		var adapter UUIDAdapter
+
+		assert.Error(t, adapter.Scan(42))
+		assert.Error(t, adapter.Scan("not-a-uuid"))
+	})
+
+	t.Run("Nil values produce a nil value", func(t *testing.T) {
+		value, err := UUIDAdapter{}.valueFor(UUIDStorageBinary)
+
+		require.NoError(t, err)
+		assert.Nil(t, value)
+	})
+}
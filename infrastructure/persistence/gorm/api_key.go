@@ -0,0 +1,257 @@
+package gorm
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jperdior/chatbot-kit/application/auth"
+	"github.com/jperdior/chatbot-kit/application/tenant"
+	"github.com/jperdior/chatbot-kit/domain"
+	"gorm.io/gorm"
+)
+
+// ErrInvalidAPIKey is returned for unknown, malformed, revoked and expired API keys.
+var ErrInvalidAPIKey = domain.NewUnauthorizedError("invalid API key", "api_key.invalid")
+
+// APIKey is a stored API key. Only the SHA-256 hash of its secret is kept, the prefix
+// identifies the key in logs and lookups.
+type APIKey struct {
+	ID         uint64     `gorm:"primaryKey;autoIncrement" json:"id"`
+	Prefix     string     `gorm:"size:64;uniqueIndex;not null" json:"prefix"`
+	Hash       string     `gorm:"size:64;not null" json:"-"`
+	ClientID   string     `gorm:"size:255;index;not null" json:"client_id"`
+	Name       string     `gorm:"size:255" json:"name"`
+	Scopes     string     `gorm:"size:1024" json:"scopes"`
+	TenantID   string     `gorm:"size:255;index" json:"tenant_id"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+func (APIKey) TableName() string {
+	return "api_keys"
+}
+
+// ScopeList returns the space separated scopes as a slice.
+func (k *APIKey) ScopeList() []string {
+	return strings.Fields(k.Scopes)
+}
+
+func (k *APIKey) active(now time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || now.Before(*k.ExpiresAt))
+}
+
+// NewAPIKeyParams describes the key to create.
+type NewAPIKeyParams struct {
+	ClientID  string
+	Name      string
+	Scopes    []string
+	TenantID  string
+	ExpiresAt *time.Time
+}
+
+type apiKeyStoreOptions struct {
+	prefix           string
+	lastUsedInterval time.Duration
+}
+
+type APIKeyStoreOption func(*apiKeyStoreOptions)
+
+// WithAPIKeyPrefix sets the fixed part of the key prefixes, "ck" by default, e.g. to tell
+// live and test keys apart.
+func WithAPIKeyPrefix(prefix string) APIKeyStoreOption {
+	return func(o *apiKeyStoreOptions) {
+		o.prefix = prefix
+	}
+}
+
+// WithLastUsedInterval limits how often the last use of a key is written, every minute by default.
+func WithLastUsedInterval(interval time.Duration) APIKeyStoreOption {
+	return func(o *apiKeyStoreOptions) {
+		o.lastUsedInterval = interval
+	}
+}
+
+// APIKeyStore creates, authenticates, rotates and revokes API keys. Keys have the form
+// <prefix>.<secret>. Keys are authenticated before the tenant is known, so Verify and
+// Authenticate bypass tenant isolation. The other operations are isolated by the TenantPlugin:
+// they only reach the keys of the tenant in the context, and keys are created for it.
+type APIKeyStore struct {
+	db               *gorm.DB
+	prefix           string
+	lastUsedInterval time.Duration
+}
+
+func NewAPIKeyStore(db *gorm.DB, opts ...APIKeyStoreOption) *APIKeyStore {
+	options := &apiKeyStoreOptions{
+		prefix:           "ck",
+		lastUsedInterval: time.Minute,
+	}
+	for _, opt := range opts {
+		opt(options)
+	}
+	return &APIKeyStore{db: db, prefix: options.prefix, lastUsedInterval: options.lastUsedInterval}
+}
+
+// Create stores a new key and returns it in plain text, which cannot be retrieved afterwards.
+func (s *APIKeyStore) Create(ctx context.Context, params NewAPIKeyParams) (string, *APIKey, error) {
+	identifier, err := randomString(6)
+	if err != nil {
+		return "", nil, err
+	}
+	secret, err := randomString(32)
+	if err != nil {
+		return "", nil, err
+	}
+
+	key := &APIKey{
+		Prefix:    s.prefix + "_" + identifier,
+		Hash:      hashAPIKeySecret(secret),
+		ClientID:  params.ClientID,
+		Name:      params.Name,
+		Scopes:    strings.Join(params.Scopes, " "),
+		TenantID:  params.TenantID,
+		ExpiresAt: params.ExpiresAt,
+	}
+	if err := s.conn(ctx).Create(key).Error; err != nil {
+		return "", nil, err
+	}
+	return key.Prefix + "." + secret, key, nil
+}
+
+// Authenticate returns the security context of the client owning an active key.
+func (s *APIKeyStore) Authenticate(ctx context.Context, plainKey string) (*auth.ClientSecurityContext, error) {
+	key, err := s.Verify(ctx, plainKey)
+	if err != nil {
+		return nil, err
+	}
+	securityContext := auth.NewClientSecurityContext(key.ClientID, key.Name)
+	securityContext.TenantID = key.TenantID
+	securityContext.Scopes = key.ScopeList()
+	return securityContext, nil
+}
+
+// Verify returns the active key matching the plain text key and records its use.
+func (s *APIKeyStore) Verify(ctx context.Context, plainKey string) (*APIKey, error) {
+	prefix, secret, found := strings.Cut(plainKey, ".")
+	if !found || prefix == "" || secret == "" {
+		return nil, newInvalidAPIKeyError()
+	}
+
+	var key APIKey
+	err := s.unisolated(ctx).Where("prefix = ?", prefix).First(&key).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, newInvalidAPIKeyError()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if subtle.ConstantTimeCompare([]byte(key.Hash), []byte(hashAPIKeySecret(secret))) != 1 || !key.active(now) {
+		return nil, newInvalidAPIKeyError()
+	}
+
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= s.lastUsedInterval {
+		key.LastUsedAt = &now
+		if err := s.unisolated(ctx).Model(&key).UpdateColumn("last_used_at", now).Error; err != nil {
+			return nil, err
+		}
+	}
+	return &key, nil
+}
+
+// Rotate creates a replacement of the key with the same client, scopes and expiry. The old key
+// keeps working during the grace period so that clients can switch without downtime.
+func (s *APIKeyStore) Rotate(ctx context.Context, prefix string, gracePeriod time.Duration) (string, *APIKey, error) {
+	var plainKey string
+	var replacement *APIKey
+	err := NewUnitOfWork(s.db).Do(ctx, func(ctx context.Context) error {
+		var key APIKey
+		if err := s.conn(ctx).Where("prefix = ?", prefix).First(&key).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return domain.NewNotFoundError("api key", prefix)
+			}
+			return err
+		}
+		if !key.active(time.Now()) {
+			return newInvalidAPIKeyError()
+		}
+
+		var err error
+		plainKey, replacement, err = s.Create(ctx, NewAPIKeyParams{
+			ClientID:  key.ClientID,
+			Name:      key.Name,
+			Scopes:    key.ScopeList(),
+			TenantID:  key.TenantID,
+			ExpiresAt: key.ExpiresAt,
+		})
+		if err != nil {
+			return err
+		}
+
+		graceEnd := time.Now().Add(gracePeriod)
+		if key.ExpiresAt != nil && key.ExpiresAt.Before(graceEnd) {
+			return nil
+		}
+		return s.conn(ctx).Model(&key).UpdateColumn("expires_at", graceEnd).Error
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	return plainKey, replacement, nil
+}
+
+// Revoke disables the key immediately. Keys of other tenants are not found.
+func (s *APIKeyStore) Revoke(ctx context.Context, prefix string) error {
+	result := s.conn(ctx).Model(&APIKey{}).Where("prefix = ? AND revoked_at IS NULL", prefix).
+		UpdateColumn("revoked_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return domain.NewNotFoundError("api key", prefix)
+	}
+	return nil
+}
+
+// List returns the keys of a client within the tenant, without their secrets.
+func (s *APIKeyStore) List(ctx context.Context, clientID string) ([]APIKey, error) {
+	keys := make([]APIKey, 0)
+	err := s.conn(ctx).Where("client_id = ?", clientID).Order("created_at desc").Find(&keys).Error
+	return keys, err
+}
+
+func (s *APIKeyStore) conn(ctx context.Context) *gorm.DB {
+	return Conn(ctx, s.db)
+}
+
+// unisolated reaches the keys of every tenant, only to authenticate them.
+func (s *APIKeyStore) unisolated(ctx context.Context) *gorm.DB {
+	return s.conn(tenant.WithoutIsolation(ctx))
+}
+
+func newInvalidAPIKeyError() error {
+	return domain.NewUnauthorizedError(ErrInvalidAPIKey.Message, ErrInvalidAPIKey.Key)
+}
+
+func hashAPIKeySecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomString(size int) (string, error) {
+	bytes := make([]byte, size)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(bytes), nil
+}
@@ -0,0 +1,125 @@
+package gorm
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jperdior/chatbot-kit/application/tenant"
+	"github.com/jperdior/chatbot-kit/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestAPIKeyStore(t *testing.T) *APIKeyStore {
+	t.Helper()
+	db := newTestDB(t, &APIKey{})
+	require.NoError(t, db.Use(NewTenantPlugin()))
+	return NewAPIKeyStore(db, WithAPIKeyPrefix("test"), WithLastUsedInterval(0))
+}
+
+func TestAPIKeyStore(t *testing.T) {
+	anonymous := context.Background()
+	acme := tenant.WithID(anonymous, "acme")
+	globex := tenant.WithID(anonymous, "globex")
+
+	t.Run("Keys authenticate their client before the tenant is known", func(t *testing.T) {
+		store := newTestAPIKeyStore(t)
+		plainKey, key, err := store.Create(acme, NewAPIKeyParams{ClientID: "crm", Name: "CRM", Scopes: []string{"chats:read", "chats:write"}})
+		require.NoError(t, err)
+
+		securityContext, err := store.Authenticate(anonymous, plainKey)
+
+		require.NoError(t, err)
+		assert.Regexp(t, `^test_[\w-]+\.[\w-]+$`, plainKey)
+		assert.Equal(t, "acme", key.TenantID)
+		assert.Equal(t, "crm", securityContext.GetIdentifier())
+		assert.Equal(t, "acme", securityContext.GetTenantID())
+		assert.Equal(t, []string{"chats:read", "chats:write"}, securityContext.Scopes)
+	})
+
+	t.Run("Invalid keys are rejected", func(t *testing.T) {
+		store := newTestAPIKeyStore(t)
+		plainKey, key, err := store.Create(acme, NewAPIKeyParams{ClientID: "crm"})
+		require.NoError(t, err)
+		past := time.Now().Add(-time.Minute)
+		expiredKey, _, err := store.Create(acme, NewAPIKeyParams{ClientID: "crm", ExpiresAt: &past})
+		require.NoError(t, err)
+		revokedKey, revoked, err := store.Create(acme, NewAPIKeyParams{ClientID: "crm"})
+		require.NoError(t, err)
+		require.NoError(t, store.Revoke(acme, revoked.Prefix))
+
+		for _, invalid := range []string{"", "malformed", key.Prefix + ".wrong", "test_unknown.secret", expiredKey, revokedKey} {
+			_, err := store.Verify(anonymous, invalid)
+
+			assert.ErrorIs(t, err, domain.ErrUnauthorized, invalid)
+		}
+		_, err = store.Verify(anonymous, plainKey)
+		assert.NoError(t, err)
+	})
+
+	t.Run("Verifying records the last use", func(t *testing.T) {
+		store := newTestAPIKeyStore(t)
+		plainKey, _, err := store.Create(acme, NewAPIKeyParams{ClientID: "crm"})
+		require.NoError(t, err)
+
+		_, err = store.Verify(anonymous, plainKey)
+		require.NoError(t, err)
+		keys, err := store.List(acme, "crm")
+		require.NoError(t, err)
+
+		require.Len(t, keys, 1)
+		assert.NotNil(t, keys[0].LastUsedAt)
+	})
+
+	t.Run("Keys are listed within the tenant", func(t *testing.T) {
+		store := newTestAPIKeyStore(t)
+		_, _, err := store.Create(acme, NewAPIKeyParams{ClientID: "crm"})
+		require.NoError(t, err)
+		_, _, err = store.Create(globex, NewAPIKeyParams{ClientID: "crm"})
+		require.NoError(t, err)
+
+		keys, err := store.List(acme, "crm")
+		require.NoError(t, err)
+		_, err = store.List(anonymous, "crm")
+
+		require.Len(t, keys, 1)
+		assert.Equal(t, "acme", keys[0].TenantID)
+		assert.ErrorIs(t, err, tenant.ErrMissingTenant)
+	})
+
+	t.Run("Keys of another tenant cannot be revoked or rotated", func(t *testing.T) {
+		store := newTestAPIKeyStore(t)
+		plainKey, key, err := store.Create(globex, NewAPIKeyParams{ClientID: "crm"})
+		require.NoError(t, err)
+
+		revokeErr := store.Revoke(acme, key.Prefix)
+		_, _, rotateErr := store.Rotate(acme, key.Prefix, time.Hour)
+
+		assert.ErrorIs(t, revokeErr, domain.ErrNotFound)
+		assert.ErrorIs(t, rotateErr, domain.ErrNotFound)
+		_, err = store.Verify(anonymous, plainKey)
+		assert.NoError(t, err)
+	})
+
+	t.Run("Rotated keys keep working during the grace period", func(t *testing.T) {
+		store := newTestAPIKeyStore(t)
+		oldKey, key, err := store.Create(acme, NewAPIKeyParams{ClientID: "crm", Scopes: []string{"chats:read"}})
+		require.NoError(t, err)
+
+		newKey, replacement, err := store.Rotate(acme, key.Prefix, time.Hour)
+		require.NoError(t, err)
+		_, oldErr := store.Verify(anonymous, oldKey)
+		_, newErr := store.Verify(anonymous, newKey)
+
+		assert.NoError(t, oldErr)
+		assert.NoError(t, newErr)
+		assert.Equal(t, "chats:read", replacement.Scopes)
+		assert.Equal(t, "acme", replacement.TenantID)
+
+		_, _, err = store.Rotate(acme, replacement.Prefix, 0)
+		require.NoError(t, err)
+		_, err = store.Verify(anonymous, newKey)
+		assert.ErrorIs(t, err, domain.ErrUnauthorized)
+	})
+}
@@ -0,0 +1,476 @@
+package gorm
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jperdior/chatbot-kit/application/auth"
+	"github.com/jperdior/chatbot-kit/application/correlation"
+	"github.com/jperdior/chatbot-kit/application/tenant"
+	"github.com/jperdior/chatbot-kit/domain"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+const (
+	AuditActionCreate = "create"
+	AuditActionUpdate = "update"
+	AuditActionDelete = "delete"
+
+	auditLogBeforeSetting = "chatbot-kit:audit_log_before"
+)
+
+// AuditLogEntry is a row of the audit log, Changes holds a JSON object mapping every changed
+// column to its before and after values. Entries belong to the tenant of the changed row, or of
+// the statement context, so that the TenantPlugin isolates them like the rows they describe.
+type AuditLogEntry struct {
+	ID uint64 `gorm:"primaryKey;autoIncrement" json:"id"`
+	TenantScoped
+	Entity        string    `gorm:"size:255;index" json:"entity"`
+	EntityID      string    `gorm:"size:255;index" json:"entity_id"`
+	Action        string    `gorm:"size:16" json:"action"`
+	Actor         string    `gorm:"size:255;index" json:"actor"`
+	CorrelationID string    `gorm:"size:255;index" json:"correlation_id"`
+	Changes       string    `gorm:"type:text" json:"changes"`
+	OccurredOn    time.Time `gorm:"index" json:"occurred_on"`
+}
+
+func (AuditLogEntry) TableName() string {
+	return "audit_log"
+}
+
+// AuditChange holds the value of a column before and after a change.
+type AuditChange struct {
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// AuditLogPlugin records every create, update and delete performed through GORM in the audit log,
+// within the same transaction as the change.
+type AuditLogPlugin struct {
+	securityProvider auth.SecurityProvider
+}
+
+func NewAuditLogPlugin(securityProvider auth.SecurityProvider) *AuditLogPlugin {
+	return &AuditLogPlugin{securityProvider: securityProvider}
+}
+
+// Name implements the gorm.Plugin interface.
+func (p *AuditLogPlugin) Name() string {
+	return "chatbot-kit:audit_log"
+}
+
+// Initialize implements the gorm.Plugin interface.
+func (p *AuditLogPlugin) Initialize(db *gorm.DB) error {
+	callbacks := db.Callback()
+	if err := callbacks.Create().Before("gorm:create").Register("chatbot-kit:audit_log_before_create", p.captureBeforeUpsert); err != nil {
+		return err
+	}
+	if err := callbacks.Create().After("gorm:create").Register("chatbot-kit:audit_log_create", p.afterCreate); err != nil {
+		return err
+	}
+	if err := callbacks.Update().Before("gorm:update").Register("chatbot-kit:audit_log_before_update", p.captureBefore); err != nil {
+		return err
+	}
+	if err := callbacks.Update().After("gorm:update").Register("chatbot-kit:audit_log_update", p.afterUpdate); err != nil {
+		return err
+	}
+	if err := callbacks.Delete().Before("gorm:delete").Register("chatbot-kit:audit_log_before_delete", p.captureBefore); err != nil {
+		return err
+	}
+	return callbacks.Delete().After("gorm:delete").Register("chatbot-kit:audit_log_delete", p.afterDelete)
+}
+
+func (p *AuditLogPlugin) audited(db *gorm.DB) bool {
+	return db.Error == nil && db.Statement.Schema != nil && db.Statement.Table != (AuditLogEntry{}).TableName()
+}
+
+// captureBeforeUpsert snapshots the rows an upsert may update, so that afterCreate tells the
+// created rows from the updated ones.
+func (p *AuditLogPlugin) captureBeforeUpsert(db *gorm.DB) {
+	if _, ok := db.Statement.Clauses["ON CONFLICT"]; !ok || !p.audited(db) || db.DryRun {
+		return
+	}
+	rows, err := p.snapshot(db, statementConditions(db.Statement), db.Statement.Unscoped)
+	if err != nil {
+		_ = db.AddError(err)
+		return
+	}
+	if rows == nil {
+		rows = []map[string]interface{}{}
+	}
+	db.Statement.Settings.Store(auditLogBeforeSetting, rows)
+}
+
+func (p *AuditLogPlugin) afterCreate(db *gorm.DB) {
+	value, upsert := db.Statement.Settings.LoadAndDelete(auditLogBeforeSetting)
+	if !p.audited(db) || db.DryRun || db.RowsAffected == 0 {
+		return
+	}
+	existing := make(map[string]map[string]interface{})
+	if upsert {
+		before, _ := value.([]map[string]interface{})
+		for _, row := range before {
+			existing[rowID(db.Statement.Schema, row)] = row
+		}
+	}
+	var updated []map[string]interface{}
+	if len(existing) > 0 && !onConflictDoesNothing(db.Statement) {
+		after, err := p.snapshot(db, primaryKeyConditions(db.Statement, mapValues(existing)), true)
+		if err != nil {
+			_ = db.AddError(err)
+			return
+		}
+		updated = after
+	}
+
+	var entries []AuditLogEntry
+	for _, row := range modelRows(db.Statement) {
+		if _, ok := existing[rowID(db.Statement.Schema, row)]; !ok {
+			entries = append(entries, p.entry(db, AuditActionCreate, nil, row))
+		}
+	}
+	for _, row := range updated {
+		entry := p.entry(db, AuditActionUpdate, existing[rowID(db.Statement.Schema, row)], row)
+		if entry.Changes != "{}" {
+			entries = append(entries, entry)
+		}
+	}
+	p.record(db, entries)
+}
+
+func (p *AuditLogPlugin) captureBefore(db *gorm.DB) {
+	if !p.audited(db) || db.DryRun {
+		return
+	}
+	rows, err := p.snapshot(db, statementConditions(db.Statement), db.Statement.Unscoped)
+	if err != nil {
+		_ = db.AddError(err)
+		return
+	}
+	db.Statement.Settings.Store(auditLogBeforeSetting, rows)
+}
+
+func (p *AuditLogPlugin) afterUpdate(db *gorm.DB) {
+	before, ok := p.before(db)
+	if !ok {
+		return
+	}
+	after, err := p.snapshot(db, primaryKeyConditions(db.Statement, before), true)
+	if err != nil {
+		_ = db.AddError(err)
+		return
+	}
+	afterByID := make(map[string]map[string]interface{}, len(after))
+	for _, row := range after {
+		afterByID[rowID(db.Statement.Schema, row)] = row
+	}
+
+	var entries []AuditLogEntry
+	for _, row := range before {
+		entry := p.entry(db, AuditActionUpdate, row, afterByID[rowID(db.Statement.Schema, row)])
+		if entry.Changes != "{}" {
+			entries = append(entries, entry)
+		}
+	}
+	p.record(db, entries)
+}
+
+func (p *AuditLogPlugin) afterDelete(db *gorm.DB) {
+	before, ok := p.before(db)
+	if !ok {
+		return
+	}
+	var entries []AuditLogEntry
+	for _, row := range before {
+		entries = append(entries, p.entry(db, AuditActionDelete, row, nil))
+	}
+	p.record(db, entries)
+}
+
+// before returns the snapshot taken by captureBefore, removing it from the settings that later
+// statements may share.
+func (p *AuditLogPlugin) before(db *gorm.DB) ([]map[string]interface{}, bool) {
+	value, ok := db.Statement.Settings.LoadAndDelete(auditLogBeforeSetting)
+	if !ok || !p.audited(db) || db.DryRun || db.RowsAffected == 0 {
+		return nil, false
+	}
+	rows, ok := value.([]map[string]interface{})
+	return rows, ok && len(rows) > 0
+}
+
+// snapshot reads the rows matching the conditions through the statement model, so that the
+// callbacks scoping its queries, such as the TenantPlugin, apply to it as well.
+func (p *AuditLogPlugin) snapshot(db *gorm.DB, conditions []clause.Expression, unscoped bool) ([]map[string]interface{}, error) {
+	if len(conditions) == 0 {
+		return nil, nil
+	}
+	query := db.Session(&gorm.Session{NewDB: true, SkipHooks: true}).
+		Model(reflect.New(db.Statement.Schema.ModelType).Interface()).
+		Table(db.Statement.Table)
+	if unscoped {
+		query = query.Unscoped()
+	}
+	var rows []map[string]interface{}
+	err := query.Clauses(clause.Where{Exprs: conditions}).Find(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		for column, value := range row {
+			row[column] = normalizeAuditValue(value)
+		}
+	}
+	return rows, nil
+}
+
+func (p *AuditLogPlugin) entry(db *gorm.DB, action string, before, after map[string]interface{}) AuditLogEntry {
+	row := after
+	if row == nil {
+		row = before
+	}
+	changes, _ := json.Marshal(diff(before, after))
+	return AuditLogEntry{
+		TenantScoped:  TenantScoped{TenantID: rowTenant(db.Statement, row)},
+		Entity:        db.Statement.Table,
+		EntityID:      rowID(db.Statement.Schema, row),
+		Action:        action,
+		Actor:         p.actor(db.Statement.Context),
+		CorrelationID: correlation.IDFromContext(db.Statement.Context),
+		Changes:       string(changes),
+		OccurredOn:    db.NowFunc(),
+	}
+}
+
+func (p *AuditLogPlugin) actor(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	securityContext := p.securityProvider.GetSecurityContext(ctx)
+	if securityContext == nil {
+		return ""
+	}
+	return securityContext.GetIdentifier()
+}
+
+// record creates the entries, already stamped with their tenant. Changes made without a tenant in
+// the context, to tables not isolated, are recorded without one.
+func (p *AuditLogPlugin) record(db *gorm.DB, entries []AuditLogEntry) {
+	if len(entries) == 0 {
+		return
+	}
+	ctx := db.Statement.Context
+	if _, ok := tenant.IDFromContext(ctx); !ok {
+		ctx = tenant.WithoutIsolation(ctx)
+	}
+	err := db.Session(&gorm.Session{NewDB: true, SkipHooks: true, Context: ctx}).Create(&entries).Error
+	_ = db.AddError(err)
+}
+
+// AuditLogRepository queries the audit log, from the replicas given with WithReplicas if any.
+type AuditLogRepository struct {
+	connections *Connections
+}
+
+func NewAuditLogRepository(db *gorm.DB, opts ...RepositoryOption) *AuditLogRepository {
+	options := &repositoryOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	return &AuditLogRepository{connections: NewConnections(db, options.replicas...)}
+}
+
+// NewAuditLogCriteria builds the criteria to search the audit log. Empty entity or actor and a nil
+// date range are not filtered on.
+func NewAuditLogCriteria(entity, entityID, actor string, dateRange *domain.DateRangeValueObject, page, pageSize int) *domain.Criteria {
+	var filters []domain.FilterInterface
+	if entity != "" {
+		filters = append(filters, domain.NewFilter("entity", "=", entity))
+	}
+	if entityID != "" {
+		filters = append(filters, domain.NewFilter("entity_id", "=", entityID))
+	}
+	if actor != "" {
+		filters = append(filters, domain.NewFilter("actor", "=", actor))
+	}
+	if dateRange != nil {
+		filters = append(filters,
+			domain.NewFilter("occurred_on", ">=", dateRange.Start()),
+			domain.NewFilter("occurred_on", "<=", dateRange.End()),
+		)
+	}
+	return domain.NewCriteria(filters, "occurred_on", "desc", page, pageSize)
+}
+
+// Search returns the audit log entries matching the criteria.
+func (r *AuditLogRepository) Search(ctx context.Context, criteria domain.CriteriaInterface) ([]AuditLogEntry, error) {
+	query, err := ApplyCriteria(r.connections.Reader(ctx).Model(&AuditLogEntry{}), criteria)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]AuditLogEntry, 0)
+	if err := query.Find(&entries).Error; err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// Paginate returns a page of audit log entries matching the criteria.
+func (r *AuditLogRepository) Paginate(ctx context.Context, criteria domain.CriteriaInterface, opts ...PaginateOption) (*Page[AuditLogEntry], error) {
+	return Paginate[AuditLogEntry](r.connections.Reader(ctx), criteria, opts...)
+}
+
+// statementConditions returns the conditions selecting the rows affected by the statement.
+func statementConditions(stmt *gorm.Statement) []clause.Expression {
+	var conditions []clause.Expression
+	if where, ok := stmt.Clauses["WHERE"].Expression.(clause.Where); ok {
+		conditions = append(conditions, where.Exprs...)
+	}
+	for _, value := range []reflect.Value{stmt.ReflectValue, reflect.ValueOf(stmt.Model)} {
+		if !value.IsValid() || reflect.Indirect(value).Kind() != reflect.Struct && reflect.Indirect(value).Kind() != reflect.Slice {
+			continue
+		}
+		_, queryValues := schema.GetIdentityFieldValuesMap(stmt.Context, reflect.Indirect(value), stmt.Schema.PrimaryFields)
+		column, values := schema.ToQueryValues(stmt.Table, stmt.Schema.PrimaryFieldDBNames, queryValues)
+		if len(values) > 0 {
+			conditions = append(conditions, clause.IN{Column: column, Values: values})
+			break
+		}
+	}
+	return conditions
+}
+
+// primaryKeyConditions selects the given snapshot rows again by primary key.
+func primaryKeyConditions(stmt *gorm.Statement, rows []map[string]interface{}) []clause.Expression {
+	field := stmt.Schema.PrioritizedPrimaryField
+	if field == nil {
+		return nil
+	}
+	values := make([]interface{}, 0, len(rows))
+	for _, row := range rows {
+		value := row[field.DBName]
+		if id, ok := value.(string); ok && field.FieldType == reflect.TypeOf(UUIDAdapter{}) {
+			valueObject, err := domain.NewUuidValueObject(id)
+			if err == nil {
+				value = UUIDAdapter{ValueObject: valueObject}
+			}
+		}
+		values = append(values, value)
+	}
+	return []clause.Expression{clause.IN{Column: clause.Column{Table: stmt.Table, Name: field.DBName}, Values: values}}
+}
+
+func onConflictDoesNothing(stmt *gorm.Statement) bool {
+	onConflict, ok := stmt.Clauses["ON CONFLICT"].Expression.(clause.OnConflict)
+	return ok && onConflict.DoNothing
+}
+
+func mapValues(rows map[string]map[string]interface{}) []map[string]interface{} {
+	values := make([]map[string]interface{}, 0, len(rows))
+	for _, row := range rows {
+		values = append(values, row)
+	}
+	return values
+}
+
+// modelRows converts the created models into column maps.
+func modelRows(stmt *gorm.Statement) []map[string]interface{} {
+	var values []reflect.Value
+	value := reflect.Indirect(stmt.ReflectValue)
+	switch value.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < value.Len(); i++ {
+			values = append(values, reflect.Indirect(value.Index(i)))
+		}
+	case reflect.Struct:
+		values = append(values, value)
+	}
+
+	rows := make([]map[string]interface{}, 0, len(values))
+	for _, v := range values {
+		row := make(map[string]interface{}, len(stmt.Schema.DBNames))
+		for _, field := range stmt.Schema.Fields {
+			if field.DBName == "" {
+				continue
+			}
+			fieldValue, _ := field.ValueOf(stmt.Context, v)
+			row[field.DBName] = normalizeAuditValue(fieldValue)
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// rowTenant returns the tenant of a tenant scoped row, or the one of the statement context.
+func rowTenant(stmt *gorm.Statement, row map[string]interface{}) string {
+	if field := stmt.Schema.LookUpField("TenantID"); field != nil {
+		if tenantID, ok := row[field.DBName].(string); ok && tenantID != "" {
+			return tenantID
+		}
+	}
+	tenantID, _ := tenant.IDFromContext(stmt.Context)
+	return tenantID
+}
+
+func rowID(s *schema.Schema, row map[string]interface{}) string {
+	if s.PrioritizedPrimaryField == nil || row == nil {
+		return ""
+	}
+	return fmt.Sprint(row[s.PrioritizedPrimaryField.DBName])
+}
+
+// normalizeAuditValue turns driver values into JSON friendly ones, binary UUIDs become strings.
+func normalizeAuditValue(value interface{}) interface{} {
+	for v := reflect.ValueOf(value); v.Kind() == reflect.Ptr; v = v.Elem() {
+		if v.IsNil() {
+			return nil
+		}
+		if _, ok := value.(driver.Valuer); ok {
+			break
+		}
+		value = v.Elem().Interface()
+	}
+	if valuer, ok := value.(driver.Valuer); ok {
+		if v := reflect.ValueOf(valuer); v.Kind() == reflect.Ptr && v.IsNil() {
+			return nil
+		}
+		driverValue, err := valuer.Value()
+		if err != nil {
+			return nil
+		}
+		value = driverValue
+	}
+	if bytes, ok := value.([]byte); ok {
+		if len(bytes) == 16 {
+			if id, err := uuid.FromBytes(bytes); err == nil {
+				return id.String()
+			}
+		}
+		return string(bytes)
+	}
+	if t, ok := value.(time.Time); ok {
+		return t.UTC().Format(time.RFC3339Nano)
+	}
+	return value
+}
+
+func diff(before, after map[string]interface{}) map[string]AuditChange {
+	changes := make(map[string]AuditChange)
+	for column, value := range after {
+		if previous, ok := before[column]; !ok || fmt.Sprint(previous) != fmt.Sprint(value) {
+			changes[column] = AuditChange{Before: before[column], After: value}
+		}
+	}
+	for column, value := range before {
+		if _, ok := after[column]; !ok {
+			changes[column] = AuditChange{Before: value}
+		}
+	}
+	return changes
+}
@@ -0,0 +1,215 @@
+package gorm
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/jperdior/chatbot-kit/application/correlation"
+	"github.com/jperdior/chatbot-kit/application/tenant"
+	"github.com/jperdior/chatbot-kit/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+func newAuditLogTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db := newTestDB(t, &testDocument{}, &AuditLogEntry{})
+	require.NoError(t, db.Use(NewAuditPlugin(testSecurityProvider{})))
+	require.NoError(t, db.Use(NewAuditLogPlugin(testSecurityProvider{})))
+	return db
+}
+
+func auditLog(t *testing.T, db *gorm.DB) []AuditLogEntry {
+	t.Helper()
+	var entries []AuditLogEntry
+	require.NoError(t, db.WithContext(tenant.WithoutIsolation(context.Background())).Order("id").Find(&entries).Error)
+	return entries
+}
+
+func auditChanges(t *testing.T, entry AuditLogEntry) map[string]AuditChange {
+	t.Helper()
+	var changes map[string]AuditChange
+	require.NoError(t, json.Unmarshal([]byte(entry.Changes), &changes))
+	return changes
+}
+
+func TestAuditLogPlugin(t *testing.T) {
+	ctx := correlation.WithID(withClient(context.Background(), "editor"), "correlation-1")
+
+	t.Run("Every change is logged with its actor and correlation", func(t *testing.T) {
+		db := newAuditLogTestDB(t)
+		document := newTestDocument(t, "draft")
+
+		require.NoError(t, db.WithContext(ctx).Create(document).Error)
+		require.NoError(t, db.WithContext(ctx).Model(document).Update("title", "final").Error)
+		require.NoError(t, db.WithContext(ctx).Delete(document).Error)
+
+		entries := auditLog(t, db)
+		require.Len(t, entries, 3)
+		for i, action := range []string{AuditActionCreate, AuditActionUpdate, AuditActionDelete} {
+			assert.Equal(t, action, entries[i].Action)
+			assert.Equal(t, "test_documents", entries[i].Entity)
+			assert.Equal(t, document.ID.ValueObject.String(), entries[i].EntityID)
+			assert.Equal(t, "editor", entries[i].Actor)
+			assert.Equal(t, "correlation-1", entries[i].CorrelationID)
+		}
+		assert.Equal(t, AuditChange{Before: nil, After: "draft"}, auditChanges(t, entries[0])["title"])
+		assert.Equal(t, AuditChange{Before: "draft", After: "final"}, auditChanges(t, entries[1])["title"])
+		assert.Equal(t, AuditChange{Before: "final", After: nil}, auditChanges(t, entries[2])["title"])
+	})
+
+	t.Run("Updates changing nothing are not logged", func(t *testing.T) {
+		db := newAuditLogTestDB(t)
+		document := newTestDocument(t, "draft")
+		require.NoError(t, db.WithContext(ctx).Create(document).Error)
+
+		require.NoError(t, db.WithContext(ctx).Model(&testDocument{}).Where("title = ?", "missing").Update("title", "final").Error)
+		require.NoError(t, db.WithContext(ctx).Session(&gorm.Session{SkipHooks: true}).Model(document).UpdateColumn("title", "draft").Error)
+
+		assert.Len(t, auditLog(t, db), 1)
+	})
+
+	t.Run("Changes rolled back are not logged", func(t *testing.T) {
+		db := newAuditLogTestDB(t)
+
+		_ = db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			require.NoError(t, tx.Create(newTestDocument(t, "draft")).Error)
+			return assert.AnError
+		})
+
+		assert.Empty(t, auditLog(t, db))
+	})
+
+	t.Run("The snapshot does not leak into later statements", func(t *testing.T) {
+		db := newAuditLogTestDB(t)
+		document := newTestDocument(t, "draft")
+		require.NoError(t, db.WithContext(ctx).Create(document).Error)
+
+		query := db.WithContext(ctx).Model(&testDocument{}).Where("title = ?", "draft")
+		require.NoError(t, query.Update("title", "final").Error)
+		_, leaked := query.Statement.Settings.Load(auditLogBeforeSetting)
+
+		assert.False(t, leaked)
+	})
+}
+
+// testContact is saved by the Repository with an upsert, not being versioned.
+type testContact struct {
+	ID   UUIDAdapter `gorm:"primaryKey"`
+	Name string
+}
+
+func TestAuditLogPluginUpserts(t *testing.T) {
+	ctx := withClient(context.Background(), "editor")
+
+	t.Run("Saving an existing unversioned entity logs an update", func(t *testing.T) {
+		db := newTestDB(t, &testContact{}, &AuditLogEntry{})
+		require.NoError(t, db.Use(NewAuditLogPlugin(testSecurityProvider{})))
+		repository := NewRepository[testContact, *domain.UUIDValueObject](db)
+		contact := &testContact{ID: UUIDAdapter{ValueObject: domain.NewRandomUUIDValueObject()}, Name: "Ada"}
+
+		require.NoError(t, repository.Save(ctx, contact))
+		contact.Name = "Ada Lovelace"
+		require.NoError(t, repository.Save(ctx, contact))
+		require.NoError(t, repository.Save(ctx, contact))
+
+		entries := auditLog(t, db)
+		require.Len(t, entries, 2)
+		assert.Equal(t, AuditActionCreate, entries[0].Action)
+		assert.Equal(t, AuditActionUpdate, entries[1].Action)
+		assert.Equal(t, contact.ID.ValueObject.String(), entries[1].EntityID)
+		assert.Equal(t, map[string]AuditChange{"name": {Before: "Ada", After: "Ada Lovelace"}}, auditChanges(t, entries[1]))
+	})
+
+	t.Run("Upserts doing nothing are not logged", func(t *testing.T) {
+		db := newAuditLogTestDB(t)
+		document := newTestDocument(t, "draft")
+		require.NoError(t, db.WithContext(ctx).Create(document).Error)
+
+		require.NoError(t, db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(document).Error)
+
+		assert.Len(t, auditLog(t, db), 1)
+	})
+}
+
+func TestAuditLogPluginTenants(t *testing.T) {
+	acme := withClient(tenant.WithID(context.Background(), "acme"), "acme-editor")
+	globex := withClient(tenant.WithID(context.Background(), "globex"), "globex-editor")
+	db := newTestDB(t, &testNote{}, &testDocument{}, &AuditLogEntry{})
+	// The audit log plugin comes first, its snapshots running before the tenant scopes the statement.
+	require.NoError(t, db.Use(NewAuditLogPlugin(testSecurityProvider{})))
+	require.NoError(t, db.Use(NewTenantPlugin()))
+	require.NoError(t, db.WithContext(acme).Create(&testNote{ID: "1", Body: "secret plan"}).Error)
+	require.NoError(t, db.WithContext(globex).Create(&testNote{ID: "2", Body: "secret draft"}).Error)
+	require.NoError(t, db.WithContext(globex).Create(&testNote{ID: "3", Body: "public"}).Error)
+
+	require.NoError(t, db.WithContext(globex).Where("body LIKE ?", "secret%").Delete(&testNote{}).Error)
+	require.NoError(t, db.WithContext(globex).Model(&testNote{}).Where("1 = 1").Update("body", "changed").Error)
+
+	entries := auditLog(t, db)
+	require.Len(t, entries, 5)
+	for _, entry := range entries[3:] {
+		assert.Equal(t, "globex-editor", entry.Actor)
+	}
+	assert.Equal(t, []string{AuditActionDelete, AuditActionUpdate}, []string{entries[3].Action, entries[4].Action})
+	assert.Equal(t, []string{"2", "3"}, []string{entries[3].EntityID, entries[4].EntityID})
+
+	t.Run("Entries belong to the tenant of their row", func(t *testing.T) {
+		var tenants []string
+		for _, entry := range entries {
+			tenants = append(tenants, entry.TenantID)
+		}
+
+		assert.Equal(t, []string{"acme", "globex", "globex", "globex", "globex"}, tenants)
+	})
+
+	t.Run("Entries are only searched within the tenant", func(t *testing.T) {
+		repository := NewAuditLogRepository(db)
+
+		found, err := repository.Search(acme, NewAuditLogCriteria("test_notes", "", "", nil, 1, 10))
+		require.NoError(t, err)
+		page, err := repository.Paginate(acme, NewAuditLogCriteria("test_notes", "", "", nil, 1, 10))
+		require.NoError(t, err)
+		_, missingErr := repository.Search(context.Background(), NewAuditLogCriteria("", "", "", nil, 1, 10))
+
+		require.Len(t, found, 1)
+		assert.Equal(t, "1", found[0].EntityID)
+		assert.EqualValues(t, 1, page.TotalRows)
+		assert.ErrorIs(t, missingErr, tenant.ErrMissingTenant)
+	})
+
+	t.Run("Changes without tenant are logged without one", func(t *testing.T) {
+		require.NoError(t, db.WithContext(context.Background()).Create(newTestDocument(t, "global")).Error)
+
+		var entry AuditLogEntry
+		require.NoError(t, db.WithContext(tenant.WithoutIsolation(context.Background())).Where("entity = ?", "test_documents").Take(&entry).Error)
+		assert.Empty(t, entry.TenantID)
+	})
+}
+
+func TestAuditLogRepository(t *testing.T) {
+	db := newAuditLogTestDB(t)
+	first, second := newTestDocument(t, "first"), newTestDocument(t, "second")
+	require.NoError(t, db.WithContext(withClient(context.Background(), "alice")).Create(first).Error)
+	require.NoError(t, db.WithContext(withClient(context.Background(), "bob")).Create(second).Error)
+	repository := NewAuditLogRepository(db)
+
+	t.Run("Entries can be searched by actor", func(t *testing.T) {
+		entries, err := repository.Search(context.Background(), NewAuditLogCriteria("", "", "bob", nil, 1, 10))
+
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+		assert.Equal(t, second.ID.ValueObject.String(), entries[0].EntityID)
+	})
+
+	t.Run("Entries can be paginated by entity", func(t *testing.T) {
+		page, err := repository.Paginate(context.Background(), NewAuditLogCriteria("test_documents", "", "", nil, 1, 1))
+
+		require.NoError(t, err)
+		assert.Len(t, page.Items, 1)
+		assert.EqualValues(t, 2, page.TotalRows)
+	})
+}
@@ -0,0 +1,160 @@
+package gorm
+
+import (
+	"reflect"
+
+	"github.com/jperdior/chatbot-kit/application/auth"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+const deletedBySetting = "chatbot-kit:deleted_by"
+
+// AuditedBase extends Base with soft delete and the actors behind each change.
+// The actor columns are filled by the AuditPlugin.
+type AuditedBase struct {
+	Base
+	DeletedAt DeletedAt `gorm:"index" json:"deleted_at"`
+	CreatedBy string    `gorm:"size:255" json:"created_by"`
+	UpdatedBy string    `gorm:"size:255" json:"updated_by"`
+	DeletedBy string    `gorm:"size:255" json:"deleted_by"`
+}
+
+// DeletedAt behaves like gorm.DeletedAt and also stores DeletedBy on soft delete.
+type DeletedAt struct {
+	gorm.DeletedAt
+}
+
+func (DeletedAt) DeleteClauses(f *schema.Field) []clause.Interface {
+	return []clause.Interface{auditedDeleteClause{field: f}}
+}
+
+type auditedDeleteClause struct {
+	field *schema.Field
+}
+
+func (c auditedDeleteClause) Name() string {
+	return ""
+}
+
+func (c auditedDeleteClause) Build(clause.Builder) {
+}
+
+func (c auditedDeleteClause) MergeClause(*clause.Clause) {
+}
+
+// ModifyStatement turns the delete into an update of the soft delete columns,
+// mirroring gorm.SoftDeleteDeleteClause.
+func (c auditedDeleteClause) ModifyStatement(stmt *gorm.Statement) {
+	// The actor only applies to this statement, later statements sharing the settings must
+	// not inherit it.
+	actor, hasActor := stmt.Settings.LoadAndDelete(deletedBySetting)
+	if stmt.SQL.Len() > 0 || stmt.Unscoped {
+		return
+	}
+
+	curTime := stmt.DB.NowFunc()
+	set := clause.Set{{Column: clause.Column{Name: c.field.DBName}, Value: curTime}}
+	stmt.SetColumn(c.field.DBName, curTime, true)
+	if hasActor {
+		if field := stmt.Schema.LookUpField("DeletedBy"); field != nil {
+			set = append(set, clause.Assignment{Column: clause.Column{Name: field.DBName}, Value: actor})
+			stmt.SetColumn(field.DBName, actor, true)
+		}
+	}
+	stmt.AddClause(set)
+
+	if stmt.Schema != nil {
+		_, queryValues := schema.GetIdentityFieldValuesMap(stmt.Context, stmt.ReflectValue, stmt.Schema.PrimaryFields)
+		column, values := schema.ToQueryValues(stmt.Table, stmt.Schema.PrimaryFieldDBNames, queryValues)
+		if len(values) > 0 {
+			stmt.AddClause(clause.Where{Exprs: []clause.Expression{clause.IN{Column: column, Values: values}}})
+		}
+
+		if stmt.ReflectValue.CanAddr() && stmt.Dest != stmt.Model && stmt.Model != nil {
+			_, queryValues = schema.GetIdentityFieldValuesMap(stmt.Context, reflect.ValueOf(stmt.Model), stmt.Schema.PrimaryFields)
+			column, values = schema.ToQueryValues(stmt.Table, stmt.Schema.PrimaryFieldDBNames, queryValues)
+			if len(values) > 0 {
+				stmt.AddClause(clause.Where{Exprs: []clause.Expression{clause.IN{Column: column, Values: values}}})
+			}
+		}
+	}
+
+	for _, queryClause := range (gorm.DeletedAt{}).QueryClauses(c.field) {
+		if modifier, ok := queryClause.(gorm.StatementModifier); ok {
+			modifier.ModifyStatement(stmt)
+		}
+	}
+	stmt.AddClauseIfNotExists(clause.Update{})
+	stmt.Build(stmt.DB.Callback().Update().Clauses...)
+}
+
+// AuditPlugin fills the CreatedBy, UpdatedBy and DeletedBy columns of the models that have them
+// with the identifier of the security context found in the statement context.
+type AuditPlugin struct {
+	securityProvider auth.SecurityProvider
+}
+
+func NewAuditPlugin(securityProvider auth.SecurityProvider) *AuditPlugin {
+	return &AuditPlugin{securityProvider: securityProvider}
+}
+
+// Name implements the gorm.Plugin interface.
+func (p *AuditPlugin) Name() string {
+	return "chatbot-kit:audit"
+}
+
+// Initialize implements the gorm.Plugin interface.
+func (p *AuditPlugin) Initialize(db *gorm.DB) error {
+	if err := db.Callback().Create().Before("gorm:create").Register("chatbot-kit:audit_create", p.beforeCreate); err != nil {
+		return err
+	}
+	if err := db.Callback().Update().Before("gorm:update").Register("chatbot-kit:audit_update", p.beforeUpdate); err != nil {
+		return err
+	}
+	return db.Callback().Delete().Before("gorm:delete").Register("chatbot-kit:audit_delete", p.beforeDelete)
+}
+
+func (p *AuditPlugin) actor(db *gorm.DB) (string, bool) {
+	if db.Statement.Schema == nil || db.Statement.Context == nil {
+		return "", false
+	}
+	securityContext := p.securityProvider.GetSecurityContext(db.Statement.Context)
+	if securityContext == nil {
+		return "", false
+	}
+	return securityContext.GetIdentifier(), true
+}
+
+func (p *AuditPlugin) beforeCreate(db *gorm.DB) {
+	actor, ok := p.actor(db)
+	if !ok {
+		return
+	}
+	if db.Statement.Schema.LookUpField("CreatedBy") != nil {
+		db.Statement.SetColumn("CreatedBy", actor, true)
+	}
+	if db.Statement.Schema.LookUpField("UpdatedBy") != nil {
+		db.Statement.SetColumn("UpdatedBy", actor, true)
+	}
+}
+
+func (p *AuditPlugin) beforeUpdate(db *gorm.DB) {
+	actor, ok := p.actor(db)
+	if !ok {
+		return
+	}
+	if db.Statement.Schema.LookUpField("UpdatedBy") != nil {
+		db.Statement.SetColumn("UpdatedBy", actor, true)
+	}
+}
+
+func (p *AuditPlugin) beforeDelete(db *gorm.DB) {
+	actor, ok := p.actor(db)
+	if !ok {
+		db.Statement.Settings.Delete(deletedBySetting)
+		return
+	}
+	db.Statement.Settings.Store(deletedBySetting, actor)
+}
@@ -0,0 +1,94 @@
+package gorm
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jperdior/chatbot-kit/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+type testDocument struct {
+	AuditedBase
+	Title string
+}
+
+func newTestDocument(t *testing.T, title string) *testDocument {
+	t.Helper()
+	base, err := NewBase(domain.NewRandomUUIDValueObject())
+	require.NoError(t, err)
+	return &testDocument{AuditedBase: AuditedBase{Base: *base}, Title: title}
+}
+
+func newAuditedTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db := newTestDB(t, &testDocument{})
+	require.NoError(t, db.Use(NewAuditPlugin(testSecurityProvider{})))
+	return db
+}
+
+func findDocument(t *testing.T, db *gorm.DB, id UUIDAdapter) testDocument {
+	t.Helper()
+	var document testDocument
+	require.NoError(t, db.Unscoped().Where("id = ?", id).Take(&document).Error)
+	return document
+}
+
+func TestAuditPlugin(t *testing.T) {
+	t.Run("Creates and updates record their actor", func(t *testing.T) {
+		db := newAuditedTestDB(t)
+		document := newTestDocument(t, "draft")
+
+		require.NoError(t, db.WithContext(withClient(context.Background(), "writer")).Create(document).Error)
+		require.NoError(t, db.WithContext(withClient(context.Background(), "editor")).Model(document).Update("title", "final").Error)
+
+		stored := findDocument(t, db, document.ID)
+		assert.Equal(t, "writer", stored.CreatedBy)
+		assert.Equal(t, "editor", stored.UpdatedBy)
+	})
+
+	t.Run("Soft deletes record their actor", func(t *testing.T) {
+		db := newAuditedTestDB(t)
+		document := newTestDocument(t, "draft")
+		require.NoError(t, db.Create(document).Error)
+
+		require.NoError(t, db.WithContext(withClient(context.Background(), "remover")).Delete(document).Error)
+
+		stored := findDocument(t, db, document.ID)
+		assert.True(t, stored.DeletedAt.Valid)
+		assert.Equal(t, "remover", stored.DeletedBy)
+		assert.ErrorIs(t, db.Where("id = ?", document.ID).Take(&testDocument{}).Error, gorm.ErrRecordNotFound)
+	})
+
+	t.Run("The deleting actor does not leak into later statements", func(t *testing.T) {
+		db := newAuditedTestDB(t)
+		first, second := newTestDocument(t, "first"), newTestDocument(t, "second")
+		require.NoError(t, db.Create([]*testDocument{first, second}).Error)
+
+		query := db.WithContext(withClient(context.Background(), "remover")).Where("title = ?", "first")
+		require.NoError(t, query.Delete(&testDocument{}).Error)
+		_, leaked := query.Statement.Settings.Load(deletedBySetting)
+		require.NoError(t, db.Set(deletedBySetting, "stale").Delete(second).Error)
+
+		assert.False(t, leaked)
+		assert.Equal(t, "remover", findDocument(t, db, first.ID).DeletedBy)
+		assert.Empty(t, findDocument(t, db, second.ID).DeletedBy)
+	})
+
+	t.Run("Unscoped deletes remove the row", func(t *testing.T) {
+		db := newAuditedTestDB(t)
+		document := newTestDocument(t, "draft")
+		require.NoError(t, db.Create(document).Error)
+
+		query := db.WithContext(withClient(context.Background(), "remover")).Unscoped().Where("title = ?", "draft")
+		require.NoError(t, query.Delete(&testDocument{}).Error)
+		_, leaked := query.Statement.Settings.Load(deletedBySetting)
+
+		assert.False(t, leaked)
+		var count int64
+		require.NoError(t, db.Unscoped().Model(&testDocument{}).Count(&count).Error)
+		assert.Zero(t, count)
+	})
+}
@@ -8,9 +8,10 @@ import (
 )
 
 type Base struct {
-	ID        UUIDAdapter `gorm:"type:binary(16);primary_key"`
+	ID        UUIDAdapter `gorm:"primaryKey"`
 	CreatedAt time.Time   `json:"created_at"`
 	UpdatedAt time.Time   `json:"updated_at"`
+	Version   int         `gorm:"not null;default:0" json:"version"`
 }
 
 func NewBase(id domain.UUIDValueObjectInterface) (*Base, error) {
@@ -22,6 +23,14 @@ func NewBase(id domain.UUIDValueObjectInterface) (*Base, error) {
 	}, nil
 }
 
+func (b *Base) GetVersion() int {
+	return b.Version
+}
+
+func (b *Base) SetVersion(version int) {
+	b.Version = version
+}
+
 type TransactionRepositoryInterface interface {
 	ExecuteTransaction(txFunc func(tx *gorm.DB) error) error
 }
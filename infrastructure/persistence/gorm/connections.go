@@ -0,0 +1,40 @@
+package gorm
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/jperdior/chatbot-kit/application/consistency"
+	"gorm.io/gorm"
+)
+
+// Connections routes writes to the primary database and reads to the replicas.
+// Reads go to the primary inside a transaction or when the context asks for read-your-writes.
+type Connections struct {
+	primary  *gorm.DB
+	replicas []*gorm.DB
+	next     uint64
+}
+
+func NewConnections(primary *gorm.DB, replicas ...*gorm.DB) *Connections {
+	return &Connections{primary: primary, replicas: replicas}
+}
+
+// Primary returns the primary connection.
+func (c *Connections) Primary() *gorm.DB {
+	return c.primary
+}
+
+// Writer returns the transaction carried by the context or the primary connection.
+func (c *Connections) Writer(ctx context.Context) *gorm.DB {
+	return Conn(ctx, c.primary)
+}
+
+// Reader returns the connection to read from, picking replicas in round robin.
+func (c *Connections) Reader(ctx context.Context) *gorm.DB {
+	if len(c.replicas) == 0 || transactionFor(ctx, c.primary) != nil || consistency.ReadYourWrites(ctx) {
+		return c.Writer(ctx)
+	}
+	replica := c.replicas[atomic.AddUint64(&c.next, 1)%uint64(len(c.replicas))]
+	return replica.WithContext(ctx)
+}
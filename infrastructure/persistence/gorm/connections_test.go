@@ -0,0 +1,100 @@
+package gorm
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jperdior/chatbot-kit/application/consistency"
+	"github.com/jperdior/chatbot-kit/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+type testMarker struct {
+	Name string `gorm:"primaryKey"`
+}
+
+// newMarkedTestDB opens a database identified by the name stored in its only marker.
+func newMarkedTestDB(t *testing.T, name string, models ...interface{}) *gorm.DB {
+	t.Helper()
+	db := newTestDB(t, append([]interface{}{&testMarker{}}, models...)...)
+	require.NoError(t, db.Create(&testMarker{Name: name}).Error)
+	return db
+}
+
+func marker(t *testing.T, db *gorm.DB) string {
+	t.Helper()
+	var found testMarker
+	require.NoError(t, db.Take(&found).Error)
+	return found.Name
+}
+
+func TestConnections(t *testing.T) {
+	primary := newMarkedTestDB(t, "primary")
+	connections := NewConnections(primary, newMarkedTestDB(t, "replica-1"), newMarkedTestDB(t, "replica-2"))
+	ctx := context.Background()
+
+	t.Run("Reads are spread over the replicas", func(t *testing.T) {
+		read := map[string]int{}
+		for i := 0; i < 4; i++ {
+			read[marker(t, connections.Reader(ctx))]++
+		}
+
+		assert.Equal(t, map[string]int{"replica-1": 2, "replica-2": 2}, read)
+	})
+
+	t.Run("Writes go to the primary", func(t *testing.T) {
+		assert.Equal(t, "primary", marker(t, connections.Writer(ctx)))
+	})
+
+	t.Run("Reads inside a transaction go to the primary", func(t *testing.T) {
+		err := NewUnitOfWork(primary).Do(ctx, func(ctx context.Context) error {
+			assert.Equal(t, "primary", marker(t, connections.Reader(ctx)))
+			return nil
+		})
+
+		require.NoError(t, err)
+	})
+
+	t.Run("Read-your-writes reads go to the primary", func(t *testing.T) {
+		assert.Equal(t, "primary", marker(t, connections.Reader(consistency.WithReadYourWrites(ctx))))
+	})
+
+	t.Run("Without replicas reads go to the primary", func(t *testing.T) {
+		assert.Equal(t, "primary", marker(t, NewConnections(primary).Reader(ctx)))
+	})
+}
+
+func TestReplicaRouting(t *testing.T) {
+	ctx := context.Background()
+	primary := newMarkedTestDB(t, "primary", &testOrder{}, &AuditLogEntry{})
+	replica := newMarkedTestDB(t, "replica", &testOrder{}, &AuditLogEntry{})
+	require.NoError(t, replica.Create(&AuditLogEntry{Entity: "orders", Action: AuditActionCreate}).Error)
+
+	t.Run("Repositories read from the replicas and write to the primary", func(t *testing.T) {
+		repository := NewRepository[testOrder, *domain.UUIDValueObject](primary, WithReplicas(replica))
+		order := newTestOrder(t)
+
+		require.NoError(t, repository.Save(ctx, order))
+		exists, err := repository.Exists(ctx, order.ID.ValueObject.(*domain.UUIDValueObject))
+		require.NoError(t, err)
+		existsOnPrimary, err := repository.Exists(consistency.WithReadYourWrites(ctx), order.ID.ValueObject.(*domain.UUIDValueObject))
+		require.NoError(t, err)
+
+		assert.False(t, exists)
+		assert.True(t, existsOnPrimary)
+	})
+
+	t.Run("The audit log is read from the replicas", func(t *testing.T) {
+		repository := NewAuditLogRepository(primary, WithReplicas(replica))
+
+		entries, err := repository.Search(ctx, NewAuditLogCriteria("orders", "", "", nil, 1, 10))
+		require.NoError(t, err)
+		page, err := repository.Paginate(ctx, NewAuditLogCriteria("orders", "", "", nil, 1, 10))
+		require.NoError(t, err)
+
+		assert.Len(t, entries, 1)
+		assert.EqualValues(t, 1, page.TotalRows)
+	})
+}
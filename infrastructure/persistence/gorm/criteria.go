@@ -6,10 +6,7 @@ import (
 )
 
 func ApplyCriteria(query *gorm.DB, criteria domain.CriteriaInterface) (*gorm.DB, error) {
-	for _, filter := range criteria.Filters() {
-		value := filter.Value()
-		query = query.Where(filter.Name()+" "+filter.Operation()+" ?", value)
-	}
+	query = applyFilters(query, criteria)
 
 	if criteria.Sort() != "" {
 		query = query.Order(criteria.Sort() + " " + criteria.SortDir())
@@ -25,13 +22,23 @@ func ApplyCriteria(query *gorm.DB, criteria domain.CriteriaInterface) (*gorm.DB,
 }
 
 func ApplyCriteriaWithoutPagination(query *gorm.DB, criteria domain.CriteriaInterface) (*gorm.DB, error) {
-	for _, filter := range criteria.Filters() {
-		value := filter.Value()
-		query = query.Where(filter.Name()+" "+filter.Operation()+" ?", value)
-	}
+	query = applyFilters(query, criteria)
 
 	if criteria.Sort() != "" {
 		query = query.Order(criteria.Sort() + " " + criteria.SortDir())
 	}
 	return query, nil
 }
+
+// applyFilters adds the criteria filters to the query. Soft-deleted rows are excluded
+// unless the criteria asks to include them.
+func applyFilters(query *gorm.DB, criteria domain.CriteriaInterface) *gorm.DB {
+	if c, ok := criteria.(domain.DeletedInclusionCriteria); ok && c.IncludeDeleted() {
+		query = query.Unscoped()
+	}
+	for _, filter := range criteria.Filters() {
+		value := filter.Value()
+		query = query.Where(filter.Name()+" "+filter.Operation()+" ?", value)
+	}
+	return query
+}
@@ -0,0 +1,61 @@
+package gorm
+
+import (
+	"context"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"github.com/jperdior/chatbot-kit/application/auth"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newTestDB opens an in-memory SQLite database holding the given models. A single connection
+// keeps every statement on the same database.
+func newTestDB(t *testing.T, models ...interface{}) *gorm.DB {
+	t.Helper()
+	return openTestDB(t, sqlite.Open(":memory:"), models...)
+}
+
+// renamedDialector runs on SQLite while reporting another dialect name, to exercise the code
+// paths depending on the dialect.
+type renamedDialector struct {
+	gorm.Dialector
+	name string
+}
+
+func (d renamedDialector) Name() string {
+	return d.name
+}
+
+func newTestDBAs(t *testing.T, dialect string, models ...interface{}) *gorm.DB {
+	t.Helper()
+	return openTestDB(t, renamedDialector{Dialector: sqlite.Open(":memory:"), name: dialect}, models...)
+}
+
+func openTestDB(t *testing.T, dialector gorm.Dialector, models ...interface{}) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(dialector, &gorm.Config{Logger: logger.Discard})
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+	if len(models) > 0 {
+		require.NoError(t, db.AutoMigrate(models...))
+	}
+	return db
+}
+
+// testSecurityProvider returns the security context stored with auth.WithSecurityContext.
+type testSecurityProvider struct{}
+
+func (testSecurityProvider) GetSecurityContext(ctx context.Context) auth.SecurityContext {
+	securityContext, _ := auth.FromContext(ctx)
+	return securityContext
+}
+
+func withClient(ctx context.Context, clientID string) context.Context {
+	return auth.WithSecurityContext(ctx, auth.NewClientSecurityContext(clientID, clientID))
+}
@@ -0,0 +1,514 @@
+package gorm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jperdior/chatbot-kit/application/lock"
+	"github.com/jperdior/chatbot-kit/application/tenant"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultMigrationsLockKey = "chatbot-kit:schema_migrations"
+	defaultMigrationsTable   = "schema_migrations"
+
+	// KitMigrationsTable records the kit migrations apart from the application ones, so that
+	// their versions never collide.
+	KitMigrationsTable = "chatbot_kit_migrations"
+)
+
+// Migration is a versioned schema change, written either as Go functions or as SQL.
+// When both are set the Go functions take precedence.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      func(tx *gorm.DB) error
+	Down    func(tx *gorm.DB) error
+	UpSQL   string
+	DownSQL string
+}
+
+// SQLMigration builds a migration from raw SQL statements.
+func SQLMigration(version int64, name, upSQL, downSQL string) Migration {
+	return Migration{Version: version, Name: name, UpSQL: upSQL, DownSQL: downSQL}
+}
+
+func (m Migration) up(tx *gorm.DB) error {
+	if m.Up != nil {
+		return m.Up(tx)
+	}
+	if m.UpSQL == "" {
+		return nil
+	}
+	return tx.Exec(m.UpSQL).Error
+}
+
+func (m Migration) down(tx *gorm.DB) error {
+	if m.Down != nil {
+		return m.Down(tx)
+	}
+	if m.DownSQL == "" {
+		return fmt.Errorf("migration %d_%s cannot be rolled back", m.Version, m.Name)
+	}
+	return tx.Exec(m.DownSQL).Error
+}
+
+// LoadSQLMigrations reads the <version>_<name>.up.sql and <version>_<name>.down.sql files of dir,
+// typically from an embed.FS.
+func LoadSQLMigrations(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		fileName := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(fileName, ".sql") {
+			continue
+		}
+		base := strings.TrimSuffix(fileName, ".sql")
+		direction := path.Ext(base)
+		if direction != ".up" && direction != ".down" {
+			return nil, fmt.Errorf("migration file %s must end with .up.sql or .down.sql", fileName)
+		}
+		versionText, name, found := strings.Cut(strings.TrimSuffix(base, direction), "_")
+		if !found {
+			return nil, fmt.Errorf("migration file %s must be named <version>_<name>", fileName)
+		}
+		version, err := strconv.ParseInt(versionText, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("migration file %s has an invalid version: %w", fileName, err)
+		}
+
+		content, err := fs.ReadFile(fsys, path.Join(dir, fileName))
+		if err != nil {
+			return nil, err
+		}
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: name}
+			byVersion[version] = migration
+		}
+		if direction == ".up" {
+			migration.UpSQL = string(content)
+		} else {
+			migration.DownSQL = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		migrations = append(migrations, *migration)
+	}
+	sortMigrations(migrations)
+	return migrations, nil
+}
+
+// KitMigrations returns the migrations creating the tables used by the kit itself. Run them with
+// NewKitMigrator, which records them in KitMigrationsTable. They describe the tables with
+// snapshots of the models taken when they were written, so that changing a model requires a new
+// migration.
+func KitMigrations() []Migration {
+	return []Migration{
+		{
+			Version: 1,
+			Name:    "create_audit_log",
+			Up: func(tx *gorm.DB) error {
+				return tx.Migrator().CreateTable(&auditLogEntryV1{})
+			},
+			Down: func(tx *gorm.DB) error {
+				return tx.Migrator().DropTable(&auditLogEntryV1{})
+			},
+		},
+		{
+			Version: 2,
+			Name:    "create_api_keys",
+			Up: func(tx *gorm.DB) error {
+				return tx.Migrator().CreateTable(&apiKeyV2{})
+			},
+			Down: func(tx *gorm.DB) error {
+				return tx.Migrator().DropTable(&apiKeyV2{})
+			},
+		},
+		{
+			Version: 3,
+			Name:    "create_rbac_roles",
+			Up: func(tx *gorm.DB) error {
+				return tx.Migrator().CreateTable(&roleRecordV3{})
+			},
+			Down: func(tx *gorm.DB) error {
+				return tx.Migrator().DropTable(&roleRecordV3{})
+			},
+		},
+		{
+			Version: 4,
+			Name:    "add_audit_log_tenant",
+			Up: func(tx *gorm.DB) error {
+				if err := tx.Migrator().AddColumn(&auditLogTenantV4{}, "TenantID"); err != nil {
+					return err
+				}
+				return tx.Migrator().CreateIndex(&auditLogTenantV4{}, "TenantID")
+			},
+			Down: func(tx *gorm.DB) error {
+				if err := tx.Migrator().DropIndex(&auditLogTenantV4{}, "TenantID"); err != nil {
+					return err
+				}
+				return tx.Migrator().DropColumn(&auditLogTenantV4{}, "TenantID")
+			},
+		},
+	}
+}
+
+// auditLogEntryV1 is the audit_log table as created by the kit migration 1.
+type auditLogEntryV1 struct {
+	ID            uint64    `gorm:"primaryKey;autoIncrement"`
+	Entity        string    `gorm:"size:255;index"`
+	EntityID      string    `gorm:"size:255;index"`
+	Action        string    `gorm:"size:16"`
+	Actor         string    `gorm:"size:255;index"`
+	CorrelationID string    `gorm:"size:255;index"`
+	Changes       string    `gorm:"type:text"`
+	OccurredOn    time.Time `gorm:"index"`
+}
+
+func (auditLogEntryV1) TableName() string {
+	return "audit_log"
+}
+
+// apiKeyV2 is the api_keys table as created by the kit migration 2.
+type apiKeyV2 struct {
+	ID         uint64 `gorm:"primaryKey;autoIncrement"`
+	Prefix     string `gorm:"size:64;uniqueIndex;not null"`
+	Hash       string `gorm:"size:64;not null"`
+	ClientID   string `gorm:"size:255;index;not null"`
+	Name       string `gorm:"size:255"`
+	Scopes     string `gorm:"size:1024"`
+	TenantID   string `gorm:"size:255;index"`
+	ExpiresAt  *time.Time
+	LastUsedAt *time.Time
+	RevokedAt  *time.Time
+	CreatedAt  time.Time
+}
+
+func (apiKeyV2) TableName() string {
+	return "api_keys"
+}
+
+// roleRecordV3 is the rbac_roles table as created by the kit migration 3.
+type roleRecordV3 struct {
+	Name        string `gorm:"primaryKey;size:255"`
+	Permissions string `gorm:"size:4096"`
+	Inherits    string `gorm:"size:1024"`
+	UpdatedAt   time.Time
+}
+
+func (roleRecordV3) TableName() string {
+	return "rbac_roles"
+}
+
+// auditLogTenantV4 is the tenant column added to audit_log by the kit migration 4, the existing
+// entries belonging to no tenant.
+type auditLogTenantV4 struct {
+	TenantID string `gorm:"size:255;index;not null;default:''"`
+}
+
+func (auditLogTenantV4) TableName() string {
+	return "audit_log"
+}
+
+// NewKitMigrator returns a migrator running KitMigrations and recording them in KitMigrationsTable.
+func NewKitMigrator(db *gorm.DB, lock lock.Lock, opts ...MigratorOption) (*Migrator, error) {
+	return NewMigrator(db, lock, KitMigrations(), append([]MigratorOption{WithMigrationsTable(KitMigrationsTable)}, opts...)...)
+}
+
+// SchemaMigration is a row of the migrations table.
+type SchemaMigration struct {
+	Version   int64     `gorm:"primaryKey;autoIncrement:false"`
+	Name      string    `gorm:"size:255"`
+	AppliedAt time.Time `gorm:"not null"`
+}
+
+func (SchemaMigration) TableName() string {
+	return defaultMigrationsTable
+}
+
+// MigrationStatus tells whether a migration has been applied.
+type MigrationStatus struct {
+	Version   int64
+	Name      string
+	Applied   bool
+	AppliedAt *time.Time
+}
+
+// ErrMigrationLocked is returned when another process holds the migrations lock.
+var ErrMigrationLocked = errors.New("migrations are being run by another process")
+
+type migratorOptions struct {
+	lockKey string
+	table   string
+	dryRun  bool
+	output  io.Writer
+}
+
+type MigratorOption func(*migratorOptions)
+
+// WithMigrationsLockKey sets the key of the lock preventing concurrent runs.
+func WithMigrationsLockKey(key string) MigratorOption {
+	return func(o *migratorOptions) {
+		o.lockKey = key
+	}
+}
+
+// WithMigrationsTable sets the table recording the applied migrations, schema_migrations by default.
+func WithMigrationsTable(table string) MigratorOption {
+	return func(o *migratorOptions) {
+		o.table = table
+	}
+}
+
+// WithDryRun only reports the migrations that would run.
+func WithDryRun() MigratorOption {
+	return func(o *migratorOptions) {
+		o.dryRun = true
+	}
+}
+
+// WithMigrationsOutput sets where progress is written, os.Stdout by default.
+func WithMigrationsOutput(output io.Writer) MigratorOption {
+	return func(o *migratorOptions) {
+		o.output = output
+	}
+}
+
+// Migrator applies and rolls back migrations, each one in its own transaction. Note that some
+// databases, MySQL among them, commit DDL statements implicitly. Migrations run without tenant
+// isolation, so that they may change the rows of every tenant.
+type Migrator struct {
+	db         *gorm.DB
+	lock       lock.Lock
+	migrations []Migration
+	lockKey    string
+	table      string
+	dryRun     bool
+	output     io.Writer
+}
+
+func NewMigrator(db *gorm.DB, lock lock.Lock, migrations []Migration, opts ...MigratorOption) (*Migrator, error) {
+	options := &migratorOptions{
+		lockKey: defaultMigrationsLockKey,
+		table:   defaultMigrationsTable,
+		output:  os.Stdout,
+	}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	sorted := append([]Migration(nil), migrations...)
+	sortMigrations(sorted)
+	for i := 1; i < len(sorted); i++ {
+		if sorted[i].Version == sorted[i-1].Version {
+			return nil, fmt.Errorf("duplicated migration version %d", sorted[i].Version)
+		}
+	}
+
+	return &Migrator{
+		db:         db,
+		lock:       lock,
+		migrations: sorted,
+		lockKey:    options.lockKey,
+		table:      options.table,
+		dryRun:     options.dryRun,
+		output:     options.output,
+	}, nil
+}
+
+// Up applies every pending migration in version order.
+func (m *Migrator) Up(ctx context.Context) error {
+	return m.locked(ctx, func() error {
+		applied, err := m.applied(ctx)
+		if err != nil {
+			return err
+		}
+		for _, migration := range m.migrations {
+			if _, ok := applied[migration.Version]; ok {
+				continue
+			}
+			if err := m.apply(ctx, migration); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Down rolls back the given number of applied migrations, latest first.
+func (m *Migrator) Down(ctx context.Context, steps int) error {
+	return m.locked(ctx, func() error {
+		applied, err := m.applied(ctx)
+		if err != nil {
+			return err
+		}
+		for i := len(m.migrations) - 1; i >= 0 && steps > 0; i-- {
+			migration := m.migrations[i]
+			if _, ok := applied[migration.Version]; !ok {
+				continue
+			}
+			if err := m.rollback(ctx, migration); err != nil {
+				return err
+			}
+			steps--
+		}
+		return nil
+	})
+}
+
+// Status returns every known migration with whether it has been applied.
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]MigrationStatus, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		status := MigrationStatus{Version: migration.Version, Name: migration.Name}
+		if record, ok := applied[migration.Version]; ok {
+			appliedAt := record.AppliedAt
+			status.Applied = true
+			status.AppliedAt = &appliedAt
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// PrintStatus writes the status of every migration as a table.
+func (m *Migrator) PrintStatus(ctx context.Context) error {
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return err
+	}
+	writer := tabwriter.NewWriter(m.output, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(writer, "VERSION\tNAME\tSTATUS\tAPPLIED AT")
+	for _, status := range statuses {
+		state, appliedAt := "pending", "-"
+		if status.Applied {
+			state, appliedAt = "applied", status.AppliedAt.Format(time.RFC3339)
+		}
+		_, _ = fmt.Fprintf(writer, "%d\t%s\t%s\t%s\n", status.Version, status.Name, state, appliedAt)
+	}
+	return writer.Flush()
+}
+
+func (m *Migrator) locked(ctx context.Context, fn func() error) error {
+	acquired, err := m.lock.Acquire(ctx, m.lockKey)
+	if err != nil {
+		return err
+	}
+	if !acquired {
+		return ErrMigrationLocked
+	}
+	defer func() {
+		_ = m.lock.Release(ctx, m.lockKey)
+	}()
+
+	if !m.dryRun {
+		if err := m.conn(ctx).Table(m.table).AutoMigrate(&SchemaMigration{}); err != nil {
+			return err
+		}
+	}
+	return fn()
+}
+
+func (m *Migrator) applied(ctx context.Context) (map[int64]SchemaMigration, error) {
+	applied := make(map[int64]SchemaMigration)
+	db := m.conn(ctx)
+	if !db.Migrator().HasTable(m.table) {
+		return applied, nil
+	}
+	var records []SchemaMigration
+	if err := db.Table(m.table).Find(&records).Error; err != nil {
+		return nil, err
+	}
+	for _, record := range records {
+		applied[record.Version] = record
+	}
+	return applied, nil
+}
+
+func (m *Migrator) apply(ctx context.Context, migration Migration) error {
+	m.report("apply", migration)
+	if m.dryRun {
+		return nil
+	}
+	err := m.conn(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := migration.up(tx); err != nil {
+			return err
+		}
+		return tx.Table(m.table).Create(&SchemaMigration{
+			Version:   migration.Version,
+			Name:      migration.Name,
+			AppliedAt: time.Now(),
+		}).Error
+	})
+	if err != nil {
+		return fmt.Errorf("migration %d_%s failed: %w", migration.Version, migration.Name, err)
+	}
+	return nil
+}
+
+func (m *Migrator) rollback(ctx context.Context, migration Migration) error {
+	m.report("rollback", migration)
+	if m.dryRun {
+		return nil
+	}
+	err := m.conn(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := migration.down(tx); err != nil {
+			return err
+		}
+		return tx.Table(m.table).Delete(&SchemaMigration{}, "version = ?", migration.Version).Error
+	})
+	if err != nil {
+		return fmt.Errorf("rollback of migration %d_%s failed: %w", migration.Version, migration.Name, err)
+	}
+	return nil
+}
+
+func (m *Migrator) conn(ctx context.Context) *gorm.DB {
+	return m.db.WithContext(tenant.WithoutIsolation(ctx))
+}
+
+func (m *Migrator) report(action string, migration Migration) {
+	prefix := ""
+	if m.dryRun {
+		prefix = "[dry-run] "
+	}
+	_, _ = fmt.Fprintf(m.output, "%s%s %d_%s\n", prefix, action, migration.Version, migration.Name)
+	if !m.dryRun {
+		return
+	}
+	statement := migration.UpSQL
+	if action == "rollback" {
+		statement = migration.DownSQL
+	}
+	if statement != "" {
+		_, _ = fmt.Fprintln(m.output, strings.TrimSpace(statement))
+	}
+}
+
+func sortMigrations(migrations []Migration) {
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+}
@@ -0,0 +1,232 @@
+package gorm
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"testing/fstest"
+
+	"github.com/jperdior/chatbot-kit/application/tenant"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// memoryLock is a process local lock.Lock.
+type memoryLock struct {
+	mu   sync.Mutex
+	held map[string]bool
+}
+
+func newMemoryLock() *memoryLock {
+	return &memoryLock{held: make(map[string]bool)}
+}
+
+func (l *memoryLock) Acquire(_ context.Context, key string) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.held[key] {
+		return false, nil
+	}
+	l.held[key] = true
+	return true, nil
+}
+
+func (l *memoryLock) Release(_ context.Context, key string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.held, key)
+	return nil
+}
+
+func testMigrations() []Migration {
+	return []Migration{
+		SQLMigration(2, "add_email", "ALTER TABLE people ADD COLUMN email TEXT", "ALTER TABLE people DROP COLUMN email"),
+		SQLMigration(1, "create_people", "CREATE TABLE people (id INTEGER PRIMARY KEY)", "DROP TABLE people"),
+	}
+}
+
+func newTestMigrator(t *testing.T, db *gorm.DB, migrations []Migration, opts ...MigratorOption) *Migrator {
+	t.Helper()
+	migrator, err := NewMigrator(db, newMemoryLock(), migrations, append([]MigratorOption{WithMigrationsOutput(&bytes.Buffer{})}, opts...)...)
+	require.NoError(t, err)
+	return migrator
+}
+
+func appliedVersions(t *testing.T, migrator *Migrator) []int64 {
+	t.Helper()
+	statuses, err := migrator.Status(context.Background())
+	require.NoError(t, err)
+	var versions []int64
+	for _, status := range statuses {
+		if status.Applied {
+			versions = append(versions, status.Version)
+		}
+	}
+	return versions
+}
+
+func TestMigrator(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Up applies the pending migrations in order", func(t *testing.T) {
+		db := newTestDB(t)
+		migrator := newTestMigrator(t, db, testMigrations())
+
+		require.NoError(t, migrator.Up(ctx))
+		require.NoError(t, migrator.Up(ctx))
+
+		assert.Equal(t, []int64{1, 2}, appliedVersions(t, migrator))
+		assert.True(t, db.Migrator().HasColumn("people", "email"))
+	})
+
+	t.Run("Down rolls back the latest migrations", func(t *testing.T) {
+		db := newTestDB(t)
+		migrator := newTestMigrator(t, db, testMigrations())
+		require.NoError(t, migrator.Up(ctx))
+
+		require.NoError(t, migrator.Down(ctx, 1))
+
+		assert.Equal(t, []int64{1}, appliedVersions(t, migrator))
+		assert.False(t, db.Migrator().HasColumn("people", "email"))
+	})
+
+	t.Run("A failing migration is not recorded", func(t *testing.T) {
+		db := newTestDB(t)
+		failure := errors.New("boom")
+		migrator := newTestMigrator(t, db, append(testMigrations(), Migration{
+			Version: 3,
+			Name:    "fail",
+			Up:      func(*gorm.DB) error { return failure },
+		}))
+
+		err := migrator.Up(ctx)
+
+		assert.ErrorIs(t, err, failure)
+		assert.Equal(t, []int64{1, 2}, appliedVersions(t, migrator))
+	})
+
+	t.Run("A dry run changes nothing", func(t *testing.T) {
+		db := newTestDB(t)
+		output := &bytes.Buffer{}
+		migrator := newTestMigrator(t, db, testMigrations(), WithDryRun(), WithMigrationsOutput(output))
+
+		require.NoError(t, migrator.Up(ctx))
+
+		assert.Contains(t, output.String(), "[dry-run] apply 1_create_people")
+		assert.False(t, db.Migrator().HasTable("people"))
+		assert.False(t, db.Migrator().HasTable("schema_migrations"))
+	})
+
+	t.Run("Migrations do not run while another process holds the lock", func(t *testing.T) {
+		db := newTestDB(t)
+		lock := newMemoryLock()
+		migrator, err := NewMigrator(db, lock, testMigrations(), WithMigrationsOutput(&bytes.Buffer{}))
+		require.NoError(t, err)
+		_, err = lock.Acquire(ctx, defaultMigrationsLockKey)
+		require.NoError(t, err)
+
+		assert.ErrorIs(t, migrator.Up(ctx), ErrMigrationLocked)
+		require.NoError(t, lock.Release(ctx, defaultMigrationsLockKey))
+		require.NoError(t, migrator.Up(ctx))
+		acquired, err := lock.Acquire(ctx, defaultMigrationsLockKey)
+		require.NoError(t, err)
+		assert.True(t, acquired)
+	})
+
+	t.Run("Duplicated versions are rejected", func(t *testing.T) {
+		_, err := NewMigrator(newTestDB(t), newMemoryLock(), append(testMigrations(), SQLMigration(1, "again", "", "")))
+
+		assert.Error(t, err)
+	})
+
+	t.Run("Kit migrations are recorded apart from the application ones", func(t *testing.T) {
+		db := newTestDB(t)
+		kit, err := NewKitMigrator(db, newMemoryLock(), WithMigrationsOutput(&bytes.Buffer{}))
+		require.NoError(t, err)
+		app := newTestMigrator(t, db, testMigrations())
+
+		require.NoError(t, kit.Up(ctx))
+		require.NoError(t, app.Up(ctx))
+
+		assert.Equal(t, []int64{1, 2, 3, 4}, appliedVersions(t, kit))
+		assert.Equal(t, []int64{1, 2}, appliedVersions(t, app))
+		assert.True(t, db.Migrator().HasTable(KitMigrationsTable))
+		assert.True(t, db.Migrator().HasTable(&AuditLogEntry{}))
+		assert.True(t, db.Migrator().HasTable("people"))
+	})
+
+	t.Run("Migrations change the rows of every tenant", func(t *testing.T) {
+		db := newTenantTestDB(t, "sqlite")
+		require.NoError(t, db.WithContext(tenant.WithID(ctx, "acme")).Create(&testNote{ID: "1", Body: "draft"}).Error)
+		require.NoError(t, db.WithContext(tenant.WithID(ctx, "globex")).Create(&testNote{ID: "2", Body: "draft"}).Error)
+		migrator := newTestMigrator(t, db, []Migration{{
+			Version: 1,
+			Name:    "publish_notes",
+			Up: func(tx *gorm.DB) error {
+				return tx.Model(&testNote{}).Where("body = ?", "draft").Update("body", "published").Error
+			},
+		}})
+
+		require.NoError(t, migrator.Up(ctx))
+
+		assert.Equal(t, "published", findNote(t, db, "1").Body)
+		assert.Equal(t, "published", findNote(t, db, "2").Body)
+	})
+
+	t.Run("Kit migrations create the tables of the kit models", func(t *testing.T) {
+		db := newTestDB(t)
+		kit, err := NewKitMigrator(db, newMemoryLock(), WithMigrationsOutput(&bytes.Buffer{}))
+		require.NoError(t, err)
+
+		require.NoError(t, kit.Up(ctx))
+
+		assert.NoError(t, db.Create(&APIKey{Prefix: "ck_1", Hash: "hash", ClientID: "bot"}).Error)
+		assert.NoError(t, db.Create(&RoleRecord{Name: "agent", Permissions: "chats:read"}).Error)
+		assert.NoError(t, db.Create(&AuditLogEntry{TenantScoped: TenantScoped{TenantID: "acme"}, Entity: "notes"}).Error)
+	})
+
+	t.Run("Kit migrations add the audit log tenant column", func(t *testing.T) {
+		db := newTestDB(t)
+		kit, err := NewKitMigrator(db, newMemoryLock(), WithMigrationsOutput(&bytes.Buffer{}))
+		require.NoError(t, err)
+
+		require.NoError(t, kit.Up(ctx))
+		added := db.Migrator().HasColumn(&AuditLogEntry{}, "tenant_id")
+		require.NoError(t, db.Create(&AuditLogEntry{Entity: "notes", Action: AuditActionCreate}).Error)
+		require.NoError(t, kit.Down(ctx, 1))
+
+		assert.True(t, added)
+		assert.False(t, db.Migrator().HasColumn(&AuditLogEntry{}, "tenant_id"))
+		assert.True(t, db.Migrator().HasTable(&AuditLogEntry{}))
+	})
+}
+
+func TestLoadSQLMigrations(t *testing.T) {
+	t.Run("Pairs the up and down files of each version", func(t *testing.T) {
+		fsys := fstest.MapFS{
+			"migrations/2_add_email.up.sql":       {Data: []byte("ALTER TABLE people ADD COLUMN email TEXT")},
+			"migrations/1_create_people.up.sql":   {Data: []byte("CREATE TABLE people (id INTEGER)")},
+			"migrations/1_create_people.down.sql": {Data: []byte("DROP TABLE people")},
+			"migrations/README.md":                {Data: []byte("ignored")},
+		}
+
+		migrations, err := LoadSQLMigrations(fsys, "migrations")
+
+		require.NoError(t, err)
+		require.Len(t, migrations, 2)
+		assert.Equal(t, SQLMigration(1, "create_people", "CREATE TABLE people (id INTEGER)", "DROP TABLE people"), migrations[0])
+		assert.Equal(t, "add_email", migrations[1].Name)
+		assert.Empty(t, migrations[1].DownSQL)
+	})
+
+	t.Run("Rejects badly named files", func(t *testing.T) {
+		for _, name := range []string{"migrations/1_create.sql", "migrations/create.up.sql", "migrations/x_create.up.sql"} {
+			_, err := LoadSQLMigrations(fstest.MapFS{name: {Data: []byte("SELECT 1")}}, "migrations")
+
+			assert.Error(t, err, name)
+		}
+	})
+}
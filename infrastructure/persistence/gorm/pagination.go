@@ -0,0 +1,133 @@
+package gorm
+
+import (
+	"github.com/jperdior/chatbot-kit/domain"
+	"github.com/jperdior/chatbot-kit/presentation"
+	"gorm.io/gorm"
+)
+
+// Page holds one page of rows together with the pagination metadata.
+// TotalRows is -1 when the count was skipped, HasNext is known either way.
+type Page[T any] struct {
+	Items     []T
+	Page      int
+	PageSize  int
+	TotalRows int64
+	HasNext   bool
+}
+
+// ToDTO maps the page to a PaginationDTO keeping the rows as they are.
+func (p *Page[T]) ToDTO() *presentation.PaginationDTO[T] {
+	return MapPage(p, func(item T) T { return item })
+}
+
+// MapPage maps the rows of a page to a PaginationDTO of another type.
+func MapPage[T, R any](page *Page[T], mapper func(T) R) *presentation.PaginationDTO[R] {
+	data := make([]R, len(page.Items))
+	for i, item := range page.Items {
+		data[i] = mapper(item)
+	}
+	dto := presentation.NewPaginationDTO(data, page.Page, page.PageSize, page.TotalRows)
+	dto.HasNext = page.HasNext
+	return dto
+}
+
+// CountEstimator returns an approximate row count for the filtered query.
+type CountEstimator func(query *gorm.DB) (int64, error)
+
+type paginateOptions struct {
+	skipCount     bool
+	estimator     CountEstimator
+	inTransaction bool
+}
+
+type PaginateOption func(*paginateOptions)
+
+// WithoutCount skips the count query, TotalRows and TotalPages are reported as -1.
+func WithoutCount() PaginateOption {
+	return func(o *paginateOptions) {
+		o.skipCount = true
+	}
+}
+
+// WithCountEstimator replaces the exact count with the given estimator, useful on huge tables.
+func WithCountEstimator(estimator CountEstimator) PaginateOption {
+	return func(o *paginateOptions) {
+		o.estimator = estimator
+	}
+}
+
+// WithTransaction runs the count and the select inside the same transaction.
+func WithTransaction() PaginateOption {
+	return func(o *paginateOptions) {
+		o.inTransaction = true
+	}
+}
+
+// Paginate counts the rows matching the criteria filters and fetches the requested page. Pages
+// start at 1, lower pages fetching the first one, and a page size of 0 or less fetches every row.
+func Paginate[T any](query *gorm.DB, criteria domain.CriteriaInterface, opts ...PaginateOption) (*Page[T], error) {
+	options := &paginateOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	if options.inTransaction {
+		var result *Page[T]
+		err := query.Transaction(func(tx *gorm.DB) error {
+			var err error
+			result, err = paginate[T](tx, criteria, options)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		return result, nil
+	}
+	return paginate[T](query, criteria, options)
+}
+
+func paginate[T any](query *gorm.DB, criteria domain.CriteriaInterface, options *paginateOptions) (*Page[T], error) {
+	query = query.Model(new(T))
+
+	totalRows := int64(-1)
+	if !options.skipCount {
+		countQuery := applyFilters(query.Session(&gorm.Session{}), criteria)
+		if options.estimator != nil {
+			estimated, err := options.estimator(countQuery)
+			if err != nil {
+				return nil, err
+			}
+			totalRows = estimated
+		} else if err := countQuery.Count(&totalRows).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	page := max(criteria.Page(), 1)
+	pageSize := criteria.PageSize()
+	rowsQuery, err := ApplyCriteriaWithoutPagination(query.Session(&gorm.Session{}), criteria)
+	if err != nil {
+		return nil, err
+	}
+	if pageSize > 0 {
+		// One more row than the page tells whether a next page exists without counting.
+		rowsQuery = rowsQuery.Offset((page - 1) * pageSize).Limit(pageSize + 1)
+	}
+	items := make([]T, 0)
+	if err := rowsQuery.Find(&items).Error; err != nil {
+		return nil, err
+	}
+	hasNext := pageSize > 0 && len(items) > pageSize
+	if hasNext {
+		items = items[:pageSize]
+	}
+
+	return &Page[T]{
+		Items:     items,
+		Page:      page,
+		PageSize:  pageSize,
+		TotalRows: totalRows,
+		HasNext:   hasNext,
+	}, nil
+}
@@ -0,0 +1,135 @@
+package gorm
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/jperdior/chatbot-kit/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+type testTicket struct {
+	ID       uint `gorm:"primaryKey"`
+	Position int
+	Status   string
+}
+
+func newTestTickets(t *testing.T, count int) *gorm.DB {
+	t.Helper()
+	db := newTestDB(t, &testTicket{})
+	for i := 1; i <= count; i++ {
+		require.NoError(t, db.Create(&testTicket{Position: i, Status: "open"}).Error)
+	}
+	require.NoError(t, db.Create(&testTicket{Position: count + 1, Status: "closed"}).Error)
+	return db
+}
+
+func openTickets(page, pageSize int) *domain.Criteria {
+	return domain.NewCriteria([]domain.FilterInterface{domain.NewFilter("status", "=", "open")}, "position", "asc", page, pageSize)
+}
+
+func positions(page *Page[testTicket]) []int {
+	result := make([]int, len(page.Items))
+	for i, ticket := range page.Items {
+		result[i] = ticket.Position
+	}
+	return result
+}
+
+func TestPaginate(t *testing.T) {
+	db := newTestTickets(t, 5)
+
+	tests := []struct {
+		name      string
+		criteria  *domain.Criteria
+		positions []int
+		page      int
+		hasNext   bool
+	}{
+		{"First page", openTickets(1, 2), []int{1, 2}, 1, true},
+		{"Last partial page", openTickets(3, 2), []int{5}, 3, false},
+		{"Last full page", openTickets(1, 5), []int{1, 2, 3, 4, 5}, 1, false},
+		{"Pages past the end are empty", openTickets(4, 2), []int{}, 4, false},
+		{"Pages below 1 fetch the first page", openTickets(0, 2), []int{1, 2}, 1, true},
+		{"Page sizes of 0 fetch every row", openTickets(1, 0), []int{1, 2, 3, 4, 5}, 1, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, err := Paginate[testTicket](db, tt.criteria)
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.positions, positions(page))
+			assert.Equal(t, tt.page, page.Page)
+			assert.Equal(t, int64(5), page.TotalRows)
+			assert.Equal(t, tt.hasNext, page.HasNext)
+		})
+	}
+
+	t.Run("WithoutCount still tells whether a next page exists", func(t *testing.T) {
+		first, err := Paginate[testTicket](db, openTickets(2, 2), WithoutCount())
+		require.NoError(t, err)
+		last, err := Paginate[testTicket](db, openTickets(3, 2), WithoutCount())
+		require.NoError(t, err)
+
+		assert.Equal(t, []int{3, 4}, positions(first))
+		assert.Equal(t, int64(-1), first.TotalRows)
+		assert.True(t, first.HasNext)
+		assert.False(t, last.HasNext)
+		assert.Equal(t, -1, first.ToDTO().TotalPages)
+		assert.True(t, first.ToDTO().HasNext)
+	})
+
+	t.Run("WithCountEstimator replaces the count", func(t *testing.T) {
+		var estimated int64
+		page, err := Paginate[testTicket](db, openTickets(1, 2), WithCountEstimator(func(query *gorm.DB) (int64, error) {
+			// The estimator receives the filtered query.
+			if err := query.Count(&estimated).Error; err != nil {
+				return 0, err
+			}
+			return 100, nil
+		}))
+
+		require.NoError(t, err)
+		assert.Equal(t, int64(5), estimated)
+		assert.Equal(t, int64(100), page.TotalRows)
+		assert.Equal(t, 50, page.ToDTO().TotalPages)
+	})
+
+	t.Run("Estimator errors fail the pagination", func(t *testing.T) {
+		failure := errors.New("no statistics")
+
+		_, err := Paginate[testTicket](db, openTickets(1, 2), WithCountEstimator(func(*gorm.DB) (int64, error) {
+			return 0, failure
+		}))
+
+		assert.ErrorIs(t, err, failure)
+	})
+
+	t.Run("WithTransaction returns the same page", func(t *testing.T) {
+		page, err := Paginate[testTicket](db, openTickets(2, 2), WithTransaction())
+
+		require.NoError(t, err)
+		assert.Equal(t, []int{3, 4}, positions(page))
+		assert.Equal(t, int64(5), page.TotalRows)
+	})
+}
+
+func TestMapPage(t *testing.T) {
+	page, err := Paginate[testTicket](newTestTickets(t, 5), openTickets(3, 2))
+	require.NoError(t, err)
+
+	dto := MapPage(page, func(ticket testTicket) string {
+		return "#" + strconv.Itoa(ticket.Position)
+	})
+
+	assert.Equal(t, []string{"#5"}, dto.Data)
+	assert.Equal(t, 3, dto.Page)
+	assert.Equal(t, 2, dto.PageSize)
+	assert.Equal(t, int64(5), dto.TotalRows)
+	assert.Equal(t, 3, dto.TotalPages)
+	assert.False(t, dto.HasNext)
+}
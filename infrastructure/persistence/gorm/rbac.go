@@ -0,0 +1,141 @@
+package gorm
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jperdior/chatbot-kit/application/auth"
+	"github.com/jperdior/chatbot-kit/application/tenant"
+	"github.com/jperdior/chatbot-kit/domain"
+	"gorm.io/gorm"
+)
+
+// RoleRecord is a stored role definition, permissions and parent roles being space separated.
+type RoleRecord struct {
+	Name        string    `gorm:"primaryKey;size:255" json:"name"`
+	Permissions string    `gorm:"size:4096" json:"permissions"`
+	Inherits    string    `gorm:"size:1024" json:"inherits"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+func (RoleRecord) TableName() string {
+	return "rbac_roles"
+}
+
+func (r *RoleRecord) Role() auth.Role {
+	return auth.Role{
+		Name:        r.Name,
+		Permissions: strings.Fields(r.Permissions),
+		Inherits:    strings.Fields(r.Inherits),
+	}
+}
+
+type roleRepositoryOptions struct {
+	rbac *auth.RBAC
+}
+
+type RoleRepositoryOption func(*roleRepositoryOptions)
+
+// WithRBACReload reloads rbac once the changes of the repository commit. Changes leaving the role
+// definitions invalid, e.g. through an inheritance cycle, are then rejected.
+func WithRBACReload(rbac *auth.RBAC) RoleRepositoryOption {
+	return func(o *roleRepositoryOptions) {
+		o.rbac = rbac
+	}
+}
+
+// RoleRepository stores the role definitions shared by every tenant. It implements
+// auth.RoleSource so that an auth.RBAC can be loaded from it.
+type RoleRepository struct {
+	db   *gorm.DB
+	rbac *auth.RBAC
+}
+
+func NewRoleRepository(db *gorm.DB, opts ...RoleRepositoryOption) *RoleRepository {
+	options := &roleRepositoryOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	return &RoleRepository{db: db, rbac: options.rbac}
+}
+
+func (r *RoleRepository) Roles(ctx context.Context) ([]auth.Role, error) {
+	var records []RoleRecord
+	if err := r.conn(ctx).Order("name").Find(&records).Error; err != nil {
+		return nil, err
+	}
+	roles := make([]auth.Role, 0, len(records))
+	for _, record := range records {
+		roles = append(roles, record.Role())
+	}
+	return roles, nil
+}
+
+// Save creates or replaces a role definition.
+func (r *RoleRepository) Save(ctx context.Context, role auth.Role) error {
+	record := &RoleRecord{
+		Name:        role.Name,
+		Permissions: strings.Join(role.Permissions, " "),
+		Inherits:    strings.Join(role.Inherits, " "),
+	}
+	return r.change(ctx, func(ctx context.Context) error {
+		return r.conn(ctx).Save(record).Error
+	})
+}
+
+func (r *RoleRepository) Delete(ctx context.Context, name string) error {
+	return r.change(ctx, func(ctx context.Context) error {
+		result := r.conn(ctx).Delete(&RoleRecord{}, "name = ?", name)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return domain.NewNotFoundError("role", name)
+		}
+		return nil
+	})
+}
+
+// change runs fn and, when an RBAC is to be reloaded, validates the resulting definitions
+// before reloading it with them after the commit.
+func (r *RoleRepository) change(ctx context.Context, fn func(ctx context.Context) error) error {
+	if r.rbac == nil {
+		return fn(ctx)
+	}
+	return NewUnitOfWork(r.db).Do(ctx, func(ctx context.Context) error {
+		if err := fn(ctx); err != nil {
+			return err
+		}
+		roles, err := r.Roles(ctx)
+		if err != nil {
+			return err
+		}
+		if _, err := auth.NewRBAC(roles); err != nil {
+			return domain.NewValidationError(err.Error(), "role.invalid").WithParam("reason", err.Error())
+		}
+		AfterCommit(ctx, func(context.Context) {
+			_ = r.rbac.Reload(roles)
+		})
+		return nil
+	})
+}
+
+func (r *RoleRepository) Find(ctx context.Context, name string) (*auth.Role, error) {
+	var record RoleRecord
+	err := r.conn(ctx).Where("name = ?", name).First(&record).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, domain.NewNotFoundError("role", name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	role := record.Role()
+	return &role, nil
+}
+
+func (r *RoleRepository) conn(ctx context.Context) *gorm.DB {
+	ctx = tenant.WithoutIsolation(ctx)
+	return Conn(ctx, r.db)
+}
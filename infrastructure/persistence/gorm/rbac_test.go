@@ -0,0 +1,86 @@
+package gorm
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jperdior/chatbot-kit/application/auth"
+	"github.com/jperdior/chatbot-kit/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoleRepository(t *testing.T) {
+	ctx := context.Background()
+	viewer := auth.Role{Name: "viewer", Permissions: []string{"chats:read"}, Inherits: []string{}}
+	agent := auth.Role{Name: "agent", Permissions: []string{"chats:write"}, Inherits: []string{"viewer"}}
+
+	newRepository := func(t *testing.T) (*RoleRepository, *auth.RBAC) {
+		t.Helper()
+		rbac, err := auth.NewRBAC(nil)
+		require.NoError(t, err)
+		return NewRoleRepository(newTestDB(t, &RoleRecord{}), WithRBACReload(rbac)), rbac
+	}
+
+	t.Run("Roles are stored and found", func(t *testing.T) {
+		repository := NewRoleRepository(newTestDB(t, &RoleRecord{}))
+
+		require.NoError(t, repository.Save(ctx, viewer))
+		require.NoError(t, repository.Save(ctx, agent))
+		found, err := repository.Find(ctx, "agent")
+		require.NoError(t, err)
+		roles, err := repository.Roles(ctx)
+		require.NoError(t, err)
+
+		assert.Equal(t, agent, *found)
+		assert.Equal(t, []auth.Role{agent, viewer}, roles)
+	})
+
+	t.Run("Saving and deleting roles reloads the RBAC", func(t *testing.T) {
+		repository, rbac := newRepository(t)
+
+		require.NoError(t, repository.Save(ctx, viewer))
+		require.NoError(t, repository.Save(ctx, agent))
+		assert.True(t, rbac.Can([]string{"agent"}, "chats:read"))
+
+		require.NoError(t, repository.Delete(ctx, "agent"))
+		assert.False(t, rbac.Can([]string{"agent"}, "chats:write"))
+	})
+
+	t.Run("The RBAC is reloaded once the transaction commits", func(t *testing.T) {
+		repository, rbac := newRepository(t)
+		failure := errors.New("boom")
+
+		err := NewUnitOfWork(repository.db).Do(ctx, func(ctx context.Context) error {
+			require.NoError(t, repository.Save(ctx, viewer))
+			assert.False(t, rbac.Can([]string{"viewer"}, "chats:read"))
+			return failure
+		})
+
+		assert.ErrorIs(t, err, failure)
+		assert.False(t, rbac.Can([]string{"viewer"}, "chats:read"))
+	})
+
+	t.Run("Changes leaving invalid definitions are rejected", func(t *testing.T) {
+		repository, rbac := newRepository(t)
+		require.NoError(t, repository.Save(ctx, viewer))
+		require.NoError(t, repository.Save(ctx, agent))
+
+		cycleErr := repository.Save(ctx, auth.Role{Name: "viewer", Inherits: []string{"agent"}})
+		deleteErr := repository.Delete(ctx, "viewer")
+
+		assert.ErrorIs(t, cycleErr, domain.ErrValidation)
+		assert.ErrorIs(t, deleteErr, domain.ErrValidation)
+		found, err := repository.Find(ctx, "viewer")
+		require.NoError(t, err)
+		assert.Equal(t, viewer, *found)
+		assert.True(t, rbac.Can([]string{"agent"}, "chats:read"))
+	})
+
+	t.Run("Deleting an unknown role is not found", func(t *testing.T) {
+		repository, _ := newRepository(t)
+
+		assert.ErrorIs(t, repository.Delete(ctx, "ghost"), domain.ErrNotFound)
+	})
+}
@@ -0,0 +1,225 @@
+package gorm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/jperdior/chatbot-kit/application/event"
+	"github.com/jperdior/chatbot-kit/domain"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// EventHandler receives the events pulled from an aggregate on Save. It runs inside the
+// save transaction, so an outbox implementation can persist the events with tx.
+type EventHandler func(ctx context.Context, tx *gorm.DB, events []event.Event) error
+
+type repositoryOptions struct {
+	entityName   string
+	eventHandler EventHandler
+	replicas     []*gorm.DB
+}
+
+type RepositoryOption func(*repositoryOptions)
+
+// WithEntityName sets the entity name used in not-found errors, defaults to the model type name.
+func WithEntityName(name string) RepositoryOption {
+	return func(o *repositoryOptions) {
+		o.entityName = name
+	}
+}
+
+// WithEventHandler sets the handler for the events recorded by saved aggregates.
+func WithEventHandler(handler EventHandler) RepositoryOption {
+	return func(o *repositoryOptions) {
+		o.eventHandler = handler
+	}
+}
+
+// WithReplicas serves the repository reads from the given replicas, see Connections.
+func WithReplicas(replicas ...*gorm.DB) RepositoryOption {
+	return func(o *repositoryOptions) {
+		o.replicas = replicas
+	}
+}
+
+// Repository is a generic repository for models embedding Base, identified by their "id" column.
+type Repository[T any, ID domain.UUIDValueObjectInterface] struct {
+	connections  *Connections
+	entityName   string
+	eventHandler EventHandler
+}
+
+func NewRepository[T any, ID domain.UUIDValueObjectInterface](db *gorm.DB, opts ...RepositoryOption) *Repository[T, ID] {
+	options := &repositoryOptions{
+		entityName: reflect.TypeOf((*T)(nil)).Elem().Name(),
+	}
+	for _, opt := range opts {
+		opt(options)
+	}
+	return &Repository[T, ID]{
+		connections:  NewConnections(db, options.replicas...),
+		entityName:   options.entityName,
+		eventHandler: options.eventHandler,
+	}
+}
+
+// DB returns the transaction carried by the context or the primary connection bound to it,
+// for queries not covered by the repository.
+func (r *Repository[T, ID]) DB(ctx context.Context) *gorm.DB {
+	return r.connections.Writer(ctx)
+}
+
+// ReadDB returns the connection reads are served from.
+func (r *Repository[T, ID]) ReadDB(ctx context.Context) *gorm.DB {
+	return r.connections.Reader(ctx)
+}
+
+// Save inserts the entity or updates all its columns if it already exists.
+// Entities implementing domain.Versioned are upserted when their version is 0, unless the stored
+// row already has a newer version, and otherwise updated only if the stored version still
+// matches. A version mismatch fails with a domain.ConcurrencyConflictError.
+// The events of a domain.AggregateRoot are only pulled when an event handler is configured and
+// are recorded back on the aggregate if the save fails, so that a retry publishes them.
+func (r *Repository[T, ID]) Save(ctx context.Context, entity *T) error {
+	aggregate, isAggregate := any(entity).(domain.AggregateRoot)
+	versioned, isVersioned := any(entity).(domain.Versioned)
+	var version int
+	if isVersioned {
+		version = versioned.GetVersion()
+	}
+	var events []event.Event
+	err := NewUnitOfWork(r.connections.Primary()).Do(ctx, func(ctx context.Context) error {
+		tx := r.DB(ctx)
+		if err := r.persist(tx, entity); err != nil {
+			return err
+		}
+		if !isAggregate || r.eventHandler == nil {
+			return nil
+		}
+		events = aggregate.PullEvents()
+		if len(events) == 0 {
+			return nil
+		}
+		return r.eventHandler(ctx, tx, events)
+	})
+	if err == nil {
+		return nil
+	}
+	if isVersioned {
+		versioned.SetVersion(version)
+	}
+	if len(events) > 0 {
+		recorded := aggregate.PullEvents()
+		for _, e := range append(events, recorded...) {
+			aggregate.Record(e)
+		}
+	}
+	return err
+}
+
+func (r *Repository[T, ID]) persist(tx *gorm.DB, entity *T) error {
+	versioned, ok := any(entity).(domain.Versioned)
+	if !ok {
+		return tx.Clauses(clause.OnConflict{UpdateAll: true}).Create(entity).Error
+	}
+
+	current := versioned.GetVersion()
+	versioned.SetVersion(current + 1)
+	query := tx.Model(entity).Where("version = ?", current).Select("*")
+	if current == 0 {
+		// Version 0 also covers rows saved before the model was versioned, so an existing row
+		// is updated as long as it has not been versioned since.
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(entity)
+		if result.Error != nil || result.RowsAffected > 0 {
+			return result.Error
+		}
+		query = query.Omit("created_at")
+	}
+
+	result := query.Updates(entity)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return domain.NewConcurrencyConflictError(r.entityName, r.entityID(tx, entity), current)
+	}
+	return nil
+}
+
+func (r *Repository[T, ID]) entityID(tx *gorm.DB, entity *T) string {
+	stmt := &gorm.Statement{DB: tx}
+	if err := stmt.Parse(entity); err != nil || stmt.Schema.PrioritizedPrimaryField == nil {
+		return ""
+	}
+	value, _ := stmt.Schema.PrioritizedPrimaryField.ValueOf(tx.Statement.Context, reflect.ValueOf(entity))
+	if adapter, ok := value.(UUIDAdapter); ok && adapter.ValueObject != nil {
+		return adapter.ValueObject.String()
+	}
+	return fmt.Sprint(value)
+}
+
+// FindByID returns the entity with the given ID or a domain.NotFoundError.
+func (r *Repository[T, ID]) FindByID(ctx context.Context, id ID) (*T, error) {
+	entity := new(T)
+	err := r.ReadDB(ctx).Where("id = ?", UUIDAdapter{ValueObject: id}).Take(entity).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, domain.NewNotFoundError(r.entityName, id.String())
+	}
+	if err != nil {
+		return nil, err
+	}
+	return entity, nil
+}
+
+// Delete removes the entity with the given ID or returns a domain.NotFoundError.
+func (r *Repository[T, ID]) Delete(ctx context.Context, id ID) error {
+	result := r.DB(ctx).Where("id = ?", UUIDAdapter{ValueObject: id}).Delete(new(T))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return domain.NewNotFoundError(r.entityName, id.String())
+	}
+	return nil
+}
+
+// Exists reports whether an entity with the given ID exists.
+func (r *Repository[T, ID]) Exists(ctx context.Context, id ID) (bool, error) {
+	var count int64
+	err := r.ReadDB(ctx).Model(new(T)).Where("id = ?", UUIDAdapter{ValueObject: id}).Limit(1).Count(&count).Error
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// Search returns the entities matching the criteria, sorted and paginated.
+func (r *Repository[T, ID]) Search(ctx context.Context, criteria domain.CriteriaInterface) ([]T, error) {
+	query, err := ApplyCriteria(r.ReadDB(ctx).Model(new(T)), criteria)
+	if err != nil {
+		return nil, err
+	}
+	entities := make([]T, 0)
+	if err := query.Find(&entities).Error; err != nil {
+		return nil, err
+	}
+	return entities, nil
+}
+
+// Count returns the number of entities matching the criteria filters.
+func (r *Repository[T, ID]) Count(ctx context.Context, criteria domain.CriteriaInterface) (int64, error) {
+	var count int64
+	err := applyFilters(r.ReadDB(ctx).Model(new(T)), criteria).Count(&count).Error
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// Paginate returns the page of entities matching the criteria together with the total count.
+func (r *Repository[T, ID]) Paginate(ctx context.Context, criteria domain.CriteriaInterface, opts ...PaginateOption) (*Page[T], error) {
+	return Paginate[T](r.ReadDB(ctx), criteria, opts...)
+}
@@ -0,0 +1,156 @@
+package gorm
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jperdior/chatbot-kit/application/event"
+	"github.com/jperdior/chatbot-kit/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+type testOrderPlaced struct {
+	*event.BaseEvent
+}
+
+func (testOrderPlaced) Type() event.Type {
+	return "order.placed"
+}
+
+type testOrder struct {
+	Base
+	Status string
+	events []event.Event
+}
+
+func (o *testOrder) PullEvents() []event.Event {
+	events := o.events
+	o.events = nil
+	return events
+}
+
+func (o *testOrder) Record(e event.Event) {
+	o.events = append(o.events, e)
+}
+
+func newTestOrder(t *testing.T) *testOrder {
+	t.Helper()
+	id := domain.NewRandomUUIDValueObject()
+	base, err := NewBase(id)
+	require.NoError(t, err)
+	order := &testOrder{Base: *base, Status: "placed"}
+	order.Record(testOrderPlaced{BaseEvent: event.NewBaseEvent(id.String())})
+	return order
+}
+
+func TestRepositorySaveEvents(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Events stay on the aggregate without an event handler", func(t *testing.T) {
+		repository := NewRepository[testOrder, *domain.UUIDValueObject](newTestDB(t, &testOrder{}))
+		order := newTestOrder(t)
+
+		require.NoError(t, repository.Save(ctx, order))
+
+		assert.Len(t, order.events, 1)
+	})
+
+	t.Run("Events are handed to the event handler", func(t *testing.T) {
+		var handled []event.Event
+		repository := NewRepository[testOrder, *domain.UUIDValueObject](newTestDB(t, &testOrder{}),
+			WithEventHandler(func(_ context.Context, _ *gorm.DB, events []event.Event) error {
+				handled = append(handled, events...)
+				return nil
+			}))
+		order := newTestOrder(t)
+
+		require.NoError(t, repository.Save(ctx, order))
+
+		assert.Len(t, handled, 1)
+		assert.Empty(t, order.events)
+	})
+
+	t.Run("Events are recorded back when the save fails", func(t *testing.T) {
+		db := newTestDB(t, &testOrder{})
+		failure := errors.New("outbox unavailable")
+		repository := NewRepository[testOrder, *domain.UUIDValueObject](db,
+			WithEventHandler(func(context.Context, *gorm.DB, []event.Event) error {
+				return failure
+			}))
+		order := newTestOrder(t)
+		recorded := order.events[0]
+
+		err := repository.Save(ctx, order)
+
+		assert.ErrorIs(t, err, failure)
+		assert.Equal(t, []event.Event{recorded}, order.events)
+		var count int64
+		require.NoError(t, db.Model(&testOrder{}).Count(&count).Error)
+		assert.Zero(t, count)
+	})
+}
+
+func TestRepositorySaveVersions(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Saving an existing row at version 0 updates it", func(t *testing.T) {
+		db := newTestDB(t, &testOrder{})
+		repository := NewRepository[testOrder, *domain.UUIDValueObject](db)
+		order := newTestOrder(t)
+		require.NoError(t, db.Create(order).Error)
+
+		unversioned := &testOrder{Base: Base{ID: order.ID}, Status: "shipped"}
+		require.NoError(t, repository.Save(ctx, unversioned))
+
+		stored, err := repository.FindByID(ctx, order.ID.ValueObject.(*domain.UUIDValueObject))
+		require.NoError(t, err)
+		assert.Equal(t, "shipped", stored.Status)
+		assert.Equal(t, 1, stored.Version)
+		assert.WithinDuration(t, order.CreatedAt, stored.CreatedAt, 0)
+	})
+
+	t.Run("Saving at version 0 a row versioned since is a conflict", func(t *testing.T) {
+		repository := NewRepository[testOrder, *domain.UUIDValueObject](newTestDB(t, &testOrder{}))
+		order := newTestOrder(t)
+		require.NoError(t, repository.Save(ctx, order))
+
+		stale := &testOrder{Base: Base{ID: order.ID}, Status: "shipped"}
+		err := repository.Save(ctx, stale)
+
+		var conflict *domain.ConcurrencyConflictError
+		assert.ErrorAs(t, err, &conflict)
+		assert.Zero(t, stale.Version)
+	})
+
+	t.Run("Updates require the stored version", func(t *testing.T) {
+		repository := NewRepository[testOrder, *domain.UUIDValueObject](newTestDB(t, &testOrder{}))
+		order := newTestOrder(t)
+		require.NoError(t, repository.Save(ctx, order))
+		stale := *order
+
+		order.Status = "shipped"
+		require.NoError(t, repository.Save(ctx, order))
+		stale.Status = "cancelled"
+		err := repository.Save(ctx, &stale)
+
+		var conflict *domain.ConcurrencyConflictError
+		assert.ErrorAs(t, err, &conflict)
+		assert.Equal(t, 2, order.Version)
+		assert.Equal(t, 1, stale.Version)
+	})
+
+	t.Run("The version is restored when the transaction rolls back", func(t *testing.T) {
+		repository := NewRepository[testOrder, *domain.UUIDValueObject](newTestDB(t, &testOrder{}),
+			WithEventHandler(func(context.Context, *gorm.DB, []event.Event) error {
+				return errors.New("outbox unavailable")
+			}))
+		order := newTestOrder(t)
+
+		require.Error(t, repository.Save(ctx, order))
+
+		assert.Zero(t, order.Version)
+	})
+}
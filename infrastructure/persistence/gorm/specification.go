@@ -0,0 +1,61 @@
+package gorm
+
+import (
+	"github.com/jperdior/chatbot-kit/domain"
+	"gorm.io/gorm"
+)
+
+// ApplySpecification adds the conditions expressed by the specification to the query.
+// And, Or and Not are translated into grouped conditions; leaves must be domain.FilterSpecification.
+func ApplySpecification[T any](query *gorm.DB, spec domain.Specification[T]) (*gorm.DB, error) {
+	condition, err := specificationCondition(query, spec)
+	if err != nil {
+		return nil, err
+	}
+	return query.Where(condition), nil
+}
+
+func specificationCondition[T any](query *gorm.DB, spec domain.Specification[T]) (*gorm.DB, error) {
+	group := query.Session(&gorm.Session{NewDB: true})
+	switch s := spec.(type) {
+	case *domain.AndSpecification[T]:
+		// Explicit so that empty composites keep their meaning when negated.
+		if len(s.Specifications()) == 0 {
+			group = group.Where("1 = 1")
+		}
+		for _, child := range s.Specifications() {
+			condition, err := specificationCondition(query, child)
+			if err != nil {
+				return nil, err
+			}
+			group = group.Where(condition)
+		}
+	case *domain.OrSpecification[T]:
+		if len(s.Specifications()) == 0 {
+			group = group.Where("1 = 0")
+		}
+		for _, child := range s.Specifications() {
+			condition, err := specificationCondition(query, child)
+			if err != nil {
+				return nil, err
+			}
+			group = group.Or(condition)
+		}
+	case *domain.NotSpecification[T]:
+		condition, err := specificationCondition(query, s.Specification())
+		if err != nil {
+			return nil, err
+		}
+		group = group.Not(condition)
+	case domain.FilterSpecification[T]:
+		if len(s.Filters()) == 0 {
+			return nil, domain.NewInternalError("specification has no filters", "specification.not_convertible")
+		}
+		for _, filter := range s.Filters() {
+			group = group.Where(filter.Name()+" "+filter.Operation()+" ?", filter.Value())
+		}
+	default:
+		return nil, domain.NewInternalError("specification cannot be converted to filters", "specification.not_convertible")
+	}
+	return group, nil
+}
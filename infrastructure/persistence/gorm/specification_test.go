@@ -0,0 +1,60 @@
+package gorm
+
+import (
+	"testing"
+
+	"github.com/jperdior/chatbot-kit/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type specPerson struct {
+	ID   int `gorm:"primaryKey"`
+	Name string
+	Age  int
+}
+
+func TestApplySpecification(t *testing.T) {
+	db := newTestDB(t, &specPerson{})
+	people := []specPerson{{ID: 1, Name: "ann", Age: 12}, {ID: 2, Name: "bob", Age: 30}, {ID: 3, Name: "eve", Age: 45}}
+	require.NoError(t, db.Create(&people).Error)
+
+	adult := domain.NewSpecification(func(p specPerson) bool { return p.Age >= 18 }, domain.NewFilter("age", ">=", 18))
+	bob := domain.NewSpecification(func(p specPerson) bool { return p.Name == "bob" }, domain.NewFilter("name", "=", "bob"))
+
+	specs := map[string]domain.Specification[specPerson]{
+		"leaf":            adult,
+		"and":             domain.And[specPerson](adult, bob),
+		"or":              domain.Or[specPerson](domain.Not[specPerson](adult), bob),
+		"empty and":       domain.And[specPerson](),
+		"empty or":        domain.Or[specPerson](),
+		"not empty and":   domain.Not[specPerson](domain.And[specPerson]()),
+		"not empty or":    domain.Not[specPerson](domain.Or[specPerson]()),
+		"and of empty or": domain.And[specPerson](adult, domain.Or[specPerson]()),
+		"or of empty and": domain.Or[specPerson](bob, domain.And[specPerson]()),
+	}
+
+	for name, spec := range specs {
+		t.Run(name+" matches the same rows in memory and in SQL", func(t *testing.T) {
+			expected := []int{}
+			for _, person := range people {
+				if spec.IsSatisfiedBy(person) {
+					expected = append(expected, person.ID)
+				}
+			}
+
+			query, err := ApplySpecification(db.Model(&specPerson{}), spec)
+			require.NoError(t, err)
+			var ids []int
+			require.NoError(t, query.Order("id").Pluck("id", &ids).Error)
+
+			assert.Equal(t, expected, ids)
+		})
+	}
+
+	t.Run("A leaf without filters cannot be translated", func(t *testing.T) {
+		_, err := ApplySpecification(db.Model(&specPerson{}), domain.Specification[specPerson](domain.NewSpecification(func(specPerson) bool { return true })))
+
+		assert.ErrorIs(t, err, domain.ErrInternal)
+	})
+}
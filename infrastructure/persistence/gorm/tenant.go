@@ -0,0 +1,202 @@
+package gorm
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/jperdior/chatbot-kit/application/tenant"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// TenantScoped marks a model as belonging to a tenant, the TenantPlugin filters and stamps it.
+type TenantScoped struct {
+	TenantID string `gorm:"size:255;index;not null" json:"tenant_id"`
+}
+
+// TenantPlugin isolates the models having a TenantID field: every query, update and delete is
+// filtered by the tenant found in the statement context and every insert is stamped with it.
+// Statements on such models fail with tenant.ErrMissingTenant when the context has no tenant,
+// unless it was created with tenant.WithoutIsolation, and with tenant.ErrOtherTenant when they
+// would create, upsert or move rows of another tenant.
+type TenantPlugin struct{}
+
+const tenantUpsertSetting = "chatbot-kit:tenant_upsert"
+
+func NewTenantPlugin() *TenantPlugin {
+	return &TenantPlugin{}
+}
+
+// Name implements the gorm.Plugin interface.
+func (p *TenantPlugin) Name() string {
+	return "chatbot-kit:tenant"
+}
+
+// Initialize implements the gorm.Plugin interface.
+func (p *TenantPlugin) Initialize(db *gorm.DB) error {
+	callbacks := db.Callback()
+	if err := callbacks.Create().Before("gorm:create").Register("chatbot-kit:tenant_create", p.stamp); err != nil {
+		return err
+	}
+	if err := callbacks.Create().After("gorm:create").Register("chatbot-kit:tenant_upserted", p.checkUpserted); err != nil {
+		return err
+	}
+	if err := callbacks.Query().Before("gorm:query").Register("chatbot-kit:tenant_query", p.scope); err != nil {
+		return err
+	}
+	if err := callbacks.Row().Before("gorm:row").Register("chatbot-kit:tenant_row", p.scope); err != nil {
+		return err
+	}
+	if err := callbacks.Update().Before("gorm:update").Register("chatbot-kit:tenant_update", p.scopeUpdate); err != nil {
+		return err
+	}
+	return callbacks.Delete().Before("gorm:delete").Register("chatbot-kit:tenant_delete", p.scope)
+}
+
+// tenantField returns the TenantID field of the statement model and the tenant to apply,
+// ok is false when the statement is not subject to isolation.
+func (p *TenantPlugin) tenantField(db *gorm.DB) (field *schema.Field, tenantID string, ok bool) {
+	if db.Error != nil || db.Statement.Schema == nil || db.Statement.Context == nil {
+		return nil, "", false
+	}
+	field = db.Statement.Schema.LookUpField("TenantID")
+	if field == nil || tenant.IsolationDisabled(db.Statement.Context) {
+		return nil, "", false
+	}
+	tenantID, found := tenant.IDFromContext(db.Statement.Context)
+	if !found {
+		_ = db.AddError(tenant.ErrMissingTenant)
+		return nil, "", false
+	}
+	return field, tenantID, true
+}
+
+func (p *TenantPlugin) scope(db *gorm.DB) {
+	field, tenantID, ok := p.tenantField(db)
+	if !ok {
+		return
+	}
+	db.Statement.AddClause(clause.Where{Exprs: []clause.Expression{
+		clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName}, Value: tenantID},
+	}})
+}
+
+// scopeUpdate scopes the update and keeps the rows in their tenant: assigning another tenant
+// fails, and a struct with an empty TenantID is stamped so that updating every column keeps it.
+func (p *TenantPlugin) scopeUpdate(db *gorm.DB) {
+	field, tenantID, ok := p.tenantField(db)
+	if !ok {
+		return
+	}
+	p.scope(db)
+
+	assigned, isAssigned := interface{}(nil), false
+	switch dest := db.Statement.Dest.(type) {
+	case map[string]interface{}:
+		if assigned, isAssigned = dest[field.DBName]; !isAssigned {
+			assigned, isAssigned = dest[field.Name]
+		}
+	default:
+		value := reflect.Indirect(reflect.ValueOf(dest))
+		if value.Kind() != reflect.Struct || value.Type() != db.Statement.Schema.ModelType {
+			break
+		}
+		var isZero bool
+		if assigned, isZero = field.ValueOf(db.Statement.Context, value); isZero {
+			if value.CanAddr() {
+				_ = db.AddError(field.Set(db.Statement.Context, value, tenantID))
+			}
+			return
+		}
+		isAssigned = true
+	}
+	if isAssigned && assigned != tenantID {
+		_ = db.AddError(fmt.Errorf("%w: cannot move a record to tenant %v from tenant %s", tenant.ErrOtherTenant, assigned, tenantID))
+	}
+}
+
+func (p *TenantPlugin) stamp(db *gorm.DB) {
+	field, tenantID, ok := p.tenantField(db)
+	if !ok {
+		return
+	}
+
+	stampValue := func(value reflect.Value) {
+		current, isZero := field.ValueOf(db.Statement.Context, value)
+		if !isZero && current != tenantID {
+			_ = db.AddError(fmt.Errorf("%w: cannot create a record of tenant %v from tenant %s", tenant.ErrOtherTenant, current, tenantID))
+			return
+		}
+		_ = db.AddError(field.Set(db.Statement.Context, value, tenantID))
+	}
+
+	// An upsert must not overwrite a row of another tenant sharing the same key. MySQL ignores
+	// the conditions of ON DUPLICATE KEY UPDATE, so the existing rows are checked instead, the
+	// other dialects skip them and checkUpserted reports it.
+	if c, ok := db.Statement.Clauses["ON CONFLICT"]; ok {
+		if onConflict, ok := c.Expression.(clause.OnConflict); ok && !onConflict.DoNothing {
+			if db.Dialector.Name() == "mysql" {
+				p.checkOwnership(db, field, tenantID)
+			} else {
+				onConflict.Where.Exprs = append(onConflict.Where.Exprs, clause.Eq{
+					Column: clause.Column{Table: db.Statement.Table, Name: field.DBName},
+					Value:  tenantID,
+				})
+				db.Statement.AddClause(onConflict)
+				db.Statement.Settings.Store(tenantUpsertSetting, true)
+			}
+		}
+	}
+
+	switch db.Statement.ReflectValue.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < db.Statement.ReflectValue.Len(); i++ {
+			stampValue(reflect.Indirect(db.Statement.ReflectValue.Index(i)))
+		}
+	case reflect.Struct:
+		stampValue(db.Statement.ReflectValue)
+	case reflect.Map:
+		db.Statement.SetColumn(field.DBName, tenantID, true)
+	}
+}
+
+// checkUpserted fails a scoped upsert that skipped rows, which then belong to another tenant.
+func (p *TenantPlugin) checkUpserted(db *gorm.DB) {
+	if _, ok := db.Statement.Settings.LoadAndDelete(tenantUpsertSetting); !ok || db.Error != nil || db.DryRun {
+		return
+	}
+	rows := int64(1)
+	if value := reflect.Indirect(db.Statement.ReflectValue); value.Kind() == reflect.Slice || value.Kind() == reflect.Array {
+		rows = int64(value.Len())
+	}
+	if db.RowsAffected < rows {
+		tenantID, _ := tenant.IDFromContext(db.Statement.Context)
+		_ = db.AddError(fmt.Errorf("%w: cannot overwrite a record of another tenant from tenant %s", tenant.ErrOtherTenant, tenantID))
+	}
+}
+
+// checkOwnership fails the statement when a row it would upsert by primary key belongs to
+// another tenant. Conflicts on other unique keys are not covered.
+func (p *TenantPlugin) checkOwnership(db *gorm.DB, field *schema.Field, tenantID string) {
+	stmt := db.Statement
+	_, queryValues := schema.GetIdentityFieldValuesMap(stmt.Context, stmt.ReflectValue, stmt.Schema.PrimaryFields)
+	column, values := schema.ToQueryValues(stmt.Table, stmt.Schema.PrimaryFieldDBNames, queryValues)
+	if len(values) == 0 {
+		return
+	}
+
+	var count int64
+	err := db.Session(&gorm.Session{NewDB: true, Context: tenant.WithoutIsolation(stmt.Context)}).
+		Table(stmt.Table).
+		Where(clause.IN{Column: column, Values: values}).
+		Where(clause.Neq{Column: clause.Column{Table: stmt.Table, Name: field.DBName}, Value: tenantID}).
+		Count(&count).Error
+	if err != nil {
+		_ = db.AddError(err)
+		return
+	}
+	if count > 0 {
+		_ = db.AddError(fmt.Errorf("%w: cannot overwrite a record of another tenant from tenant %s", tenant.ErrOtherTenant, tenantID))
+	}
+}
@@ -0,0 +1,145 @@
+package gorm
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jperdior/chatbot-kit/application/tenant"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type testNote struct {
+	ID string `gorm:"primaryKey"`
+	TenantScoped
+	Body string
+}
+
+func newTenantTestDB(t *testing.T, dialect string) *gorm.DB {
+	t.Helper()
+	db := newTestDBAs(t, dialect, &testNote{})
+	require.NoError(t, db.Use(NewTenantPlugin()))
+	return db
+}
+
+func findNote(t *testing.T, db *gorm.DB, id string) testNote {
+	t.Helper()
+	var note testNote
+	require.NoError(t, db.WithContext(tenant.WithoutIsolation(context.Background())).Where("id = ?", id).Take(&note).Error)
+	return note
+}
+
+func TestTenantPlugin(t *testing.T) {
+	acme := tenant.WithID(context.Background(), "acme")
+	globex := tenant.WithID(context.Background(), "globex")
+
+	t.Run("Creates are stamped with the tenant", func(t *testing.T) {
+		db := newTenantTestDB(t, "sqlite")
+
+		require.NoError(t, db.WithContext(acme).Create(&testNote{ID: "1", Body: "hello"}).Error)
+
+		assert.Equal(t, "acme", findNote(t, db, "1").TenantID)
+	})
+
+	t.Run("Records of another tenant cannot be created", func(t *testing.T) {
+		db := newTenantTestDB(t, "sqlite")
+
+		err := db.WithContext(acme).Create(&testNote{ID: "1", TenantScoped: TenantScoped{TenantID: "globex"}}).Error
+
+		assert.Error(t, err)
+	})
+
+	t.Run("Queries, updates and deletes only reach the tenant rows", func(t *testing.T) {
+		db := newTenantTestDB(t, "sqlite")
+		require.NoError(t, db.WithContext(acme).Create(&testNote{ID: "1", Body: "acme"}).Error)
+		require.NoError(t, db.WithContext(globex).Create(&testNote{ID: "2", Body: "globex"}).Error)
+
+		var notes []testNote
+		require.NoError(t, db.WithContext(acme).Find(&notes).Error)
+		require.NoError(t, db.WithContext(acme).Model(&testNote{}).Where("1 = 1").Update("body", "changed").Error)
+		require.NoError(t, db.WithContext(acme).Where("id = ?", "2").Delete(&testNote{}).Error)
+
+		require.Len(t, notes, 1)
+		assert.Equal(t, "1", notes[0].ID)
+		assert.Equal(t, "changed", findNote(t, db, "1").Body)
+		assert.Equal(t, "globex", findNote(t, db, "2").Body)
+	})
+
+	t.Run("Updates cannot move rows to another tenant", func(t *testing.T) {
+		db := newTenantTestDB(t, "sqlite")
+		note := &testNote{ID: "1", Body: "acme"}
+		require.NoError(t, db.WithContext(acme).Create(note).Error)
+
+		mapErr := db.WithContext(acme).Model(note).Updates(map[string]any{"tenant_id": "globex"}).Error
+		columnErr := db.WithContext(acme).Model(note).Update("TenantID", "globex").Error
+		note.TenantID = "globex"
+		structErr := db.WithContext(acme).Model(note).Updates(note).Error
+
+		assert.ErrorIs(t, mapErr, tenant.ErrOtherTenant)
+		assert.ErrorIs(t, columnErr, tenant.ErrOtherTenant)
+		assert.ErrorIs(t, structErr, tenant.ErrOtherTenant)
+		assert.Equal(t, "acme", findNote(t, db, "1").TenantID)
+	})
+
+	t.Run("Updating every column keeps the tenant", func(t *testing.T) {
+		db := newTenantTestDB(t, "sqlite")
+		require.NoError(t, db.WithContext(acme).Create(&testNote{ID: "1", Body: "draft"}).Error)
+
+		require.NoError(t, db.WithContext(acme).Model(&testNote{ID: "1"}).Select("*").Updates(&testNote{ID: "1", Body: "final"}).Error)
+		require.NoError(t, db.WithContext(acme).Model(&testNote{}).Where("id = ?", "1").Updates(map[string]any{"tenant_id": "acme", "body": "same tenant"}).Error)
+
+		note := findNote(t, db, "1")
+		assert.Equal(t, "acme", note.TenantID)
+		assert.Equal(t, "same tenant", note.Body)
+	})
+
+	t.Run("Statements without a tenant fail", func(t *testing.T) {
+		db := newTenantTestDB(t, "sqlite")
+
+		err := db.WithContext(context.Background()).Find(&[]testNote{}).Error
+
+		assert.ErrorIs(t, err, tenant.ErrMissingTenant)
+	})
+
+	t.Run("Isolation can be disabled explicitly", func(t *testing.T) {
+		db := newTenantTestDB(t, "sqlite")
+		require.NoError(t, db.WithContext(acme).Create(&testNote{ID: "1"}).Error)
+		require.NoError(t, db.WithContext(globex).Create(&testNote{ID: "2"}).Error)
+
+		var count int64
+		require.NoError(t, db.WithContext(tenant.WithoutIsolation(context.Background())).Model(&testNote{}).Count(&count).Error)
+
+		assert.EqualValues(t, 2, count)
+	})
+}
+
+func TestTenantPluginUpserts(t *testing.T) {
+	acme := tenant.WithID(context.Background(), "acme")
+	globex := tenant.WithID(context.Background(), "globex")
+	upsert := clause.OnConflict{UpdateAll: true}
+
+	for _, dialect := range []string{"sqlite", "postgres", "mysql"} {
+		t.Run("Upserts update the rows of the tenant on "+dialect, func(t *testing.T) {
+			db := newTenantTestDB(t, dialect)
+			require.NoError(t, db.WithContext(acme).Create(&testNote{ID: "1", Body: "draft"}).Error)
+
+			require.NoError(t, db.WithContext(acme).Clauses(upsert).Create(&testNote{ID: "1", Body: "final"}).Error)
+
+			assert.Equal(t, "final", findNote(t, db, "1").Body)
+		})
+
+		t.Run("Upserts cannot overwrite the rows of another tenant on "+dialect, func(t *testing.T) {
+			db := newTenantTestDB(t, dialect)
+			require.NoError(t, db.WithContext(acme).Create(&testNote{ID: "1", Body: "draft"}).Error)
+
+			err := db.WithContext(globex).Clauses(upsert).Create(&testNote{ID: "1", Body: "hijacked"}).Error
+
+			assert.ErrorIs(t, err, tenant.ErrOtherTenant)
+			note := findNote(t, db, "1")
+			assert.Equal(t, "acme", note.TenantID)
+			assert.Equal(t, "draft", note.Body)
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package gorm
+
+import (
+	"context"
+	"log"
+	"sync"
+
+	"github.com/jperdior/chatbot-kit/application/event"
+	"gorm.io/gorm"
+)
+
+// transactionKey carries the transaction of a connection pool, so a transaction of one database
+// is never used for another.
+type transactionKey struct {
+	pool gorm.ConnPool
+}
+
+// currentTransactionKey carries the innermost transaction, whatever its database.
+type currentTransactionKey struct{}
+
+type transaction struct {
+	db    *gorm.DB
+	mu    sync.Mutex
+	hooks []func(ctx context.Context)
+}
+
+func (t *transaction) addHooks(hooks ...func(ctx context.Context)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.hooks = append(t.hooks, hooks...)
+}
+
+func transactionFromContext(ctx context.Context) *transaction {
+	tx, _ := ctx.Value(currentTransactionKey{}).(*transaction)
+	return tx
+}
+
+func transactionFor(ctx context.Context, db *gorm.DB) *transaction {
+	tx, _ := ctx.Value(transactionKey{pool: db.ConnPool}).(*transaction)
+	return tx
+}
+
+func withTransaction(ctx context.Context, db *gorm.DB, tx *transaction) context.Context {
+	ctx = context.WithValue(ctx, transactionKey{pool: db.ConnPool}, tx)
+	return context.WithValue(ctx, currentTransactionKey{}, tx)
+}
+
+// Conn returns the transaction the context carries for db, or db otherwise, bound to the context.
+func Conn(ctx context.Context, db *gorm.DB) *gorm.DB {
+	if tx := transactionFor(ctx, db); tx != nil {
+		return tx.db.WithContext(ctx)
+	}
+	return db.WithContext(ctx)
+}
+
+// AfterCommit registers a hook to run once the outermost transaction of the innermost database
+// in the context commits.
+// Without an active transaction the hook runs immediately.
+func AfterCommit(ctx context.Context, hook func(ctx context.Context)) {
+	tx := transactionFromContext(ctx)
+	if tx == nil {
+		hook(ctx)
+		return
+	}
+	tx.addHooks(hook)
+}
+
+// UnitOfWork is a GORM implementation of the uow.UnitOfWork that propagates transactions
+// through the context. Nested calls use savepoints.
+type UnitOfWork struct {
+	db *gorm.DB
+}
+
+func NewUnitOfWork(db *gorm.DB) *UnitOfWork {
+	return &UnitOfWork{db: db}
+}
+
+// Do implements the uow.UnitOfWork interface.
+func (u *UnitOfWork) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	parent := transactionFor(ctx, u.db)
+	current := &transaction{}
+	err := Conn(ctx, u.db).Transaction(func(tx *gorm.DB) error {
+		current.db = tx
+		return fn(withTransaction(ctx, u.db, current))
+	})
+	if err != nil {
+		return err
+	}
+
+	if parent != nil {
+		// Hooks of a released savepoint wait for the outermost commit.
+		parent.addHooks(current.hooks...)
+		return nil
+	}
+	for _, hook := range current.hooks {
+		hook(ctx)
+	}
+	return nil
+}
+
+// AfterCommit implements the uow.UnitOfWork interface.
+func (u *UnitOfWork) AfterCommit(ctx context.Context, hook func(ctx context.Context)) {
+	AfterCommit(ctx, hook)
+}
+
+// PublishAfterCommit returns a repository EventHandler that publishes the events on the bus
+// once the surrounding transaction commits.
+func PublishAfterCommit(bus event.Bus) EventHandler {
+	return func(ctx context.Context, _ *gorm.DB, events []event.Event) error {
+		AfterCommit(ctx, func(ctx context.Context) {
+			if err := bus.Publish(ctx, events); err != nil {
+				log.Printf("Failed to publish events after commit: %v", err)
+			}
+		})
+		return nil
+	}
+}
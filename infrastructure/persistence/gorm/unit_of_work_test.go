@@ -0,0 +1,186 @@
+package gorm
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jperdior/chatbot-kit/application/command"
+	"github.com/jperdior/chatbot-kit/application/uow"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+type testMemo struct {
+	ID    uint `gorm:"primaryKey"`
+	Title string
+}
+
+func memoTitles(t *testing.T, db *gorm.DB) []string {
+	t.Helper()
+	var titles []string
+	require.NoError(t, db.Model(&testMemo{}).Order("id").Pluck("title", &titles).Error)
+	return titles
+}
+
+func createMemo(ctx context.Context, db *gorm.DB, title string) error {
+	return Conn(ctx, db).Create(&testMemo{Title: title}).Error
+}
+
+func TestUnitOfWork(t *testing.T) {
+	failure := errors.New("boom")
+
+	t.Run("Writes commit with the transaction", func(t *testing.T) {
+		db := newTestDB(t, &testMemo{})
+
+		err := NewUnitOfWork(db).Do(context.Background(), func(ctx context.Context) error {
+			return createMemo(ctx, db, "kept")
+		})
+
+		require.NoError(t, err)
+		assert.Equal(t, []string{"kept"}, memoTitles(t, db))
+	})
+
+	t.Run("Errors roll the transaction back and discard its hooks", func(t *testing.T) {
+		db := newTestDB(t, &testMemo{})
+		hooked := false
+
+		err := NewUnitOfWork(db).Do(context.Background(), func(ctx context.Context) error {
+			AfterCommit(ctx, func(context.Context) { hooked = true })
+			if err := createMemo(ctx, db, "lost"); err != nil {
+				return err
+			}
+			return failure
+		})
+
+		assert.ErrorIs(t, err, failure)
+		assert.Empty(t, memoTitles(t, db))
+		assert.False(t, hooked)
+	})
+
+	t.Run("Nested failures roll back to their savepoint only", func(t *testing.T) {
+		db := newTestDB(t, &testMemo{})
+		unitOfWork := NewUnitOfWork(db)
+		var hooks []string
+
+		err := unitOfWork.Do(context.Background(), func(ctx context.Context) error {
+			unitOfWork.AfterCommit(ctx, func(context.Context) { hooks = append(hooks, "outer") })
+			if err := createMemo(ctx, db, "outer"); err != nil {
+				return err
+			}
+			nestedErr := unitOfWork.Do(ctx, func(ctx context.Context) error {
+				unitOfWork.AfterCommit(ctx, func(context.Context) { hooks = append(hooks, "failed") })
+				if err := createMemo(ctx, db, "failed"); err != nil {
+					return err
+				}
+				return failure
+			})
+			assert.ErrorIs(t, nestedErr, failure)
+			return unitOfWork.Do(ctx, func(ctx context.Context) error {
+				unitOfWork.AfterCommit(ctx, func(context.Context) { hooks = append(hooks, "released") })
+				return createMemo(ctx, db, "released")
+			})
+		})
+
+		require.NoError(t, err)
+		assert.Equal(t, []string{"outer", "released"}, memoTitles(t, db))
+		assert.Equal(t, []string{"outer", "released"}, hooks)
+	})
+
+	t.Run("Hooks wait for the outermost commit", func(t *testing.T) {
+		db := newTestDB(t, &testMemo{})
+		unitOfWork := NewUnitOfWork(db)
+		var committed []string
+
+		err := unitOfWork.Do(context.Background(), func(ctx context.Context) error {
+			err := unitOfWork.Do(ctx, func(ctx context.Context) error {
+				unitOfWork.AfterCommit(ctx, func(context.Context) {
+					committed = memoTitles(t, db)
+				})
+				return createMemo(ctx, db, "inner")
+			})
+			assert.Nil(t, committed, "the hook of a released savepoint ran before the commit")
+			if err != nil {
+				return err
+			}
+			return createMemo(ctx, db, "outer")
+		})
+
+		require.NoError(t, err)
+		assert.Equal(t, []string{"inner", "outer"}, committed)
+	})
+
+	t.Run("Other databases do not join the transaction", func(t *testing.T) {
+		db := newTestDB(t, &testMemo{})
+		other := newTestDB(t, &testMemo{})
+
+		err := NewUnitOfWork(db).Do(context.Background(), func(ctx context.Context) error {
+			if err := createMemo(ctx, db, "lost"); err != nil {
+				return err
+			}
+			if err := createMemo(ctx, other, "kept"); err != nil {
+				return err
+			}
+			return failure
+		})
+
+		assert.ErrorIs(t, err, failure)
+		assert.Empty(t, memoTitles(t, db))
+		assert.Equal(t, []string{"kept"}, memoTitles(t, other))
+	})
+
+	t.Run("Transactions are bound to the context of the caller", func(t *testing.T) {
+		db := newTestDB(t, &testMemo{})
+		type testKey struct{}
+
+		err := NewUnitOfWork(db).Do(context.Background(), func(ctx context.Context) error {
+			ctx = context.WithValue(ctx, testKey{}, "request")
+			conn := Conn(ctx, db)
+
+			assert.Equal(t, "request", conn.Statement.Context.Value(testKey{}))
+			return conn.Create(&testMemo{Title: "kept"}).Error
+		})
+
+		require.NoError(t, err)
+		assert.Equal(t, []string{"kept"}, memoTitles(t, db))
+	})
+
+	t.Run("Hooks run immediately without a transaction", func(t *testing.T) {
+		hooked := false
+
+		AfterCommit(context.Background(), func(context.Context) { hooked = true })
+
+		assert.True(t, hooked)
+	})
+}
+
+type testCreateMemo struct {
+	Title string
+}
+
+func (testCreateMemo) Type() command.Type { return "memo.create" }
+
+func TestUnitOfWorkCommandMiddleware(t *testing.T) {
+	db := newTestDB(t, &testMemo{})
+	var transactions []*gorm.DB
+	handler := command.WithMiddlewares(command.HandlerFunc(func(ctx context.Context, cmd command.Command) error {
+		transactions = append(transactions, Conn(ctx, db))
+		if err := createMemo(ctx, db, cmd.(testCreateMemo).Title); err != nil {
+			return err
+		}
+		if cmd.(testCreateMemo).Title == "invalid" {
+			return errors.New("invalid title")
+		}
+		return nil
+	}), uow.CommandMiddleware(NewUnitOfWork(db)))
+
+	require.NoError(t, handler.Handle(context.Background(), testCreateMemo{Title: "first"}))
+	assert.Error(t, handler.Handle(context.Background(), testCreateMemo{Title: "invalid"}))
+	require.NoError(t, handler.Handle(context.Background(), testCreateMemo{Title: "second"}))
+
+	assert.Equal(t, []string{"first", "second"}, memoTitles(t, db))
+	require.Len(t, transactions, 3)
+	assert.NotSame(t, transactions[0], transactions[1])
+	assert.NotSame(t, transactions[1], transactions[2])
+}
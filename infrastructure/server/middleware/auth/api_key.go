@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jperdior/chatbot-kit/application/auth"
+	"github.com/jperdior/chatbot-kit/application/tenant"
+	"github.com/jperdior/chatbot-kit/domain"
+	"github.com/jperdior/chatbot-kit/presentation"
+)
+
+const APIKeyHeader = "X-API-Key"
+
+// APIKeyAuthenticator resolves the client owning an API key, implemented by gorm.APIKeyStore.
+type APIKeyAuthenticator interface {
+	Authenticate(ctx context.Context, key string) (*auth.ClientSecurityContext, error)
+}
+
+type apiKeyOptions struct {
+	permissions auth.PermissionResolver
+}
+
+type APIKeyOption func(*apiKeyOptions)
+
+// WithAPIKeyPermissionResolver resolves the permissions of the scopes of the clients, e.g. with an
+// auth.RBAC. Without it clients are granted no permission.
+func WithAPIKeyPermissionResolver(resolver auth.PermissionResolver) APIKeyOption {
+	return func(o *apiKeyOptions) {
+		o.permissions = resolver
+	}
+}
+
+// APIKeyMiddleware authenticates the request with the API key of the X-API-Key header or of an
+// "Authorization: ApiKey <key>" header, setting the client security context like JWTMiddleware.
+func APIKeyMiddleware(authenticator APIKeyAuthenticator, opts ...APIKeyOption) gin.HandlerFunc {
+	options := apiKeyOptions{}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return func(c *gin.Context) {
+		key := c.GetHeader(APIKeyHeader)
+		if key == "" {
+			if scheme, credentials, found := strings.Cut(c.GetHeader("Authorization"), " "); found && strings.EqualFold(scheme, "ApiKey") {
+				key = strings.TrimSpace(credentials)
+			}
+		}
+		if key == "" {
+			presentation.AbortWithProblem(c, presentation.NewProblemDetails(http.StatusUnauthorized, "API key is required").WithKey("api_key.required", nil))
+			return
+		}
+
+		securityContext, err := authenticator.Authenticate(c.Request.Context(), key)
+		if err != nil {
+			if errors.Is(err, domain.ErrUnauthorized) {
+				presentation.AbortWithProblem(c, presentation.NewProblemDetails(http.StatusUnauthorized, "Invalid API key").WithKey("api_key.invalid", nil))
+				return
+			}
+			presentation.AbortWithError(c, err)
+			return
+		}
+
+		if options.permissions != nil {
+			resolved := *securityContext
+			resolved.Permissions = options.permissions
+			securityContext = &resolved
+		}
+
+		ctx := auth.WithSecurityContext(c.Request.Context(), securityContext)
+		if securityContext.TenantID != "" {
+			ctx = tenant.WithID(ctx, securityContext.TenantID)
+		}
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
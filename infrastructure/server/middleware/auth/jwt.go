@@ -2,19 +2,89 @@ package auth
 
 import (
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/jperdior/chatbot-kit/application/auth"
-	domain "github.com/jperdior/chatbot-kit/domain/user"
+	"github.com/jperdior/chatbot-kit/application/tenant"
+	"github.com/jperdior/chatbot-kit/infrastructure/token"
+	"github.com/jperdior/chatbot-kit/presentation"
 	"net/http"
+	"time"
 )
 
+type jwtOptions struct {
+	verifier []token.VerifierOption
+}
+
+type JWTOption func(*jwtOptions)
+
+// WithJWKS verifies asymmetrically signed tokens with the keys of a JWKS document.
+func WithJWKS(jwks *token.JWKS) JWTOption {
+	return func(o *jwtOptions) {
+		o.verifier = append(o.verifier, token.WithJWKS(jwks))
+	}
+}
+
+// WithRevocationStore rejects the tokens revoked by their jti or by the watermark of their subject.
+func WithRevocationStore(store token.RevocationStore) JWTOption {
+	return func(o *jwtOptions) {
+		o.verifier = append(o.verifier, token.WithRevocationCheck(store))
+	}
+}
+
+// WithIssuers only accepts the tokens whose iss claim is one of the given issuers.
+func WithIssuers(issuers ...string) JWTOption {
+	return func(o *jwtOptions) {
+		o.verifier = append(o.verifier, token.WithAcceptedIssuers(issuers...))
+	}
+}
+
+// WithAudiences only accepts the tokens whose aud claim contains one of the given audiences.
+func WithAudiences(audiences ...string) JWTOption {
+	return func(o *jwtOptions) {
+		o.verifier = append(o.verifier, token.WithAcceptedAudiences(audiences...))
+	}
+}
+
+// WithLeeway tolerates the given clock skew when validating exp, nbf and iat.
+func WithLeeway(leeway time.Duration) JWTOption {
+	return func(o *jwtOptions) {
+		o.verifier = append(o.verifier, token.WithLeeway(leeway))
+	}
+}
+
+// WithRequiredClaims rejects the tokens missing any of the named claims, such as exp or jti.
+func WithRequiredClaims(claims ...string) JWTOption {
+	return func(o *jwtOptions) {
+		o.verifier = append(o.verifier, token.WithRequiredClaims(claims...))
+	}
+}
+
+// WithPermissionResolver resolves the permissions of the roles of the users and of the scopes of
+// the clients, e.g. with an auth.RBAC. Without it no permission is granted.
+func WithPermissionResolver(resolver auth.PermissionResolver) JWTOption {
+	return func(o *jwtOptions) {
+		o.verifier = append(o.verifier, token.WithPermissionResolver(resolver))
+	}
+}
+
 // JWTMiddleware is a middleware that checks for a valid JWT token in the Authorization header
-func JWTMiddleware(secretKey string) gin.HandlerFunc {
+// with a token.Verifier. Tokens signed with HMAC are verified with secretKey, an empty one
+// rejecting them, and tokens signed with RS256, ES256 or EdDSA against the JWKS given with WithJWKS.
+//
+// The security context, the token and the tenant are set in the request context, see
+// auth.FromContext, auth.TokenFromContext and tenant.IDFromContext, and the raw claims under the
+// "claims" key of the gin context. The former "securityContext", "tenantID", "tokenType" and
+// "authToken" keys are no longer set.
+func JWTMiddleware(secretKey string, opts ...JWTOption) gin.HandlerFunc {
+	options := &jwtOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	verifier := token.NewVerifier(secretKey, options.verifier...)
+
 	return func(c *gin.Context) {
 		tokenString := c.Request.Header.Get("Authorization")
 		if tokenString == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header is required"})
-			c.Abort()
+			presentation.AbortWithProblem(c, presentation.NewProblemDetails(http.StatusUnauthorized, "Authorization header is required").WithKey("token.required", nil))
 			return
 		}
 		// Remove "Bearer " prefix if present
@@ -22,76 +92,18 @@ func JWTMiddleware(secretKey string) gin.HandlerFunc {
 			tokenString = tokenString[7:]
 		}
 
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			// Validate the signing method
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, jwt.ErrSignatureInvalid
-			}
-			return []byte(secretKey), nil
-		})
-
-		if err != nil || !token.Valid {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
-			c.Abort()
-			return
-		}
-
-		// Extract claims
-		claims, ok := token.Claims.(jwt.MapClaims)
-		if !ok {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
-			c.Abort()
+		claims, securityContext, err := verifier.VerifyClaims(c.Request.Context(), tokenString, time.Now())
+		if err != nil {
+			presentation.AbortWithError(c, err)
 			return
 		}
 
-		// Identify token type
-		tokenType, _ := claims["token_type"].(string)
-		c.Set("tokenType", tokenType)
-		// If it's a user token, extract user-specific claims
-		if tokenType == "user" {
-			userID, err := domain.NewUserID(claims["ID"].(string))
-			if err != nil {
-				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID"})
-				c.Abort()
-				return
-			}
-			rolesInterface, ok := claims["roles"].([]interface{})
-			if !ok {
-				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user roles"})
-				c.Abort()
-				return
-			}
-
-			roles := make([]string, len(rolesInterface))
-			for i, v := range rolesInterface {
-				role, ok := v.(string)
-				if !ok {
-					c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user role type"})
-					c.Abort()
-					return
-				}
-				roles[i] = role
-			}
-			userSecurityContext := auth.NewUserSecurityContext(
-				userID,
-				claims["email"].(string),
-				roles,
-			)
-			c.Set("securityContext", userSecurityContext)
-		} else if tokenType == "client" {
-			clientSecurityContext := auth.NewClientSecurityContext(
-				claims["client_id"].(string),
-				claims["client_name"].(string),
-			)
-			c.Set("securityContext", clientSecurityContext)
-		} else {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unknown token type"})
-			c.Abort()
-			return
+		ctx := auth.WithToken(auth.WithSecurityContext(c.Request.Context(), securityContext), tokenString)
+		if tenantID := securityContext.GetTenantID(); tenantID != "" {
+			ctx = tenant.WithID(ctx, tenantID)
 		}
-
+		c.Request = c.Request.WithContext(ctx)
 		c.Set("claims", claims)
-		c.Set("authToken", tokenString)
 		c.Next()
 	}
 }
@@ -1,10 +1,16 @@
 package auth
 
 import (
-	"chatbot-service/internal/platform/server/handler/status"
+	"context"
+	"encoding/json"
+	"errors"
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/jperdior/chatbot-kit/application/auth"
+	"github.com/jperdior/chatbot-kit/infrastructure/token"
+	"github.com/jperdior/chatbot-kit/infrastructure/token/jwkstest"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -13,11 +19,13 @@ import (
 
 func generateValidToken(secretKey string) (string, error) {
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"uid":   "123",
-		"roles": []string{"ROLE_USER", "ROLE_SUPER_ADMIN"},
-		"exp":   time.Now().Add(time.Hour * 1).Unix(), // Token expires in 1 hour
-		"iat":   time.Now().Unix(),                    // Issued at time
-		"iss":   "user-service",                       // Issuer
+		"token_type": "user",
+		"ID":         "0f8fad5b-d9cb-469f-a165-70867728950e",
+		"email":      "user@example.com",
+		"roles":      []string{"ROLE_USER", "ROLE_SUPER_ADMIN"},
+		"exp":        time.Now().Add(time.Hour * 1).Unix(), // Token expires in 1 hour
+		"iat":        time.Now().Unix(),                    // Issued at time
+		"iss":        "user-service",                       // Issuer
 	})
 	return token.SignedString([]byte(secretKey))
 }
@@ -29,7 +37,7 @@ func TestJWTMiddleware(t *testing.T) {
 	engine := gin.New()
 	engine.Use(JWTMiddleware(secretKey))
 
-	engine.GET("/status", status.StatusHandler())
+	engine.GET("/status", statusHandler())
 
 	t.Run("when the Authorization header is missing", func(t *testing.T) {
 
@@ -74,4 +82,288 @@ func TestJWTMiddleware(t *testing.T) {
 		// Asserting the response status code
 		assert.Equal(t, http.StatusOK, httpRecorder.Code)
 	})
+
+	t.Run("when the token is valid the identity is stored in the request context", func(t *testing.T) {
+
+		validToken, err := generateValidToken(secretKey)
+		assert.NoError(t, err)
+
+		var securityContext auth.SecurityContext
+		var authToken string
+		engine := gin.New()
+		engine.GET("/status", JWTMiddleware(secretKey), func(c *gin.Context) {
+			securityContext, _ = auth.FromContext(c.Request.Context())
+			authToken, _ = auth.TokenFromContext(c.Request.Context())
+			c.Status(http.StatusOK)
+		})
+
+		// Setting up the HTTP recorder and the request
+		httpRecorder := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/status", nil)
+		req.Header.Add("Authorization", "Bearer "+validToken)
+
+		// Performing the request
+		engine.ServeHTTP(httpRecorder, req)
+
+		// Asserting the identity reached plain context consumers
+		assert.Equal(t, http.StatusOK, httpRecorder.Code)
+		if assert.NotNil(t, securityContext) {
+			assert.Equal(t, "0f8fad5b-d9cb-469f-a165-70867728950e", securityContext.GetIdentifier())
+		}
+		assert.Equal(t, validToken, authToken)
+	})
+
+	t.Run("when the token is valid the security provider finds the identity through the gin context", func(t *testing.T) {
+
+		validToken, err := generateValidToken(secretKey)
+		assert.NoError(t, err)
+
+		var securityContext auth.SecurityContext
+		engine := gin.New()
+		engine.GET("/status", JWTMiddleware(secretKey), func(c *gin.Context) {
+			securityContext = auth.NewJWTSecurityProvider().GetSecurityContext(c)
+			c.Status(http.StatusOK)
+		})
+
+		httpRecorder := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/status", nil)
+		req.Header.Add("Authorization", "Bearer "+validToken)
+		engine.ServeHTTP(httpRecorder, req)
+
+		assert.Equal(t, http.StatusOK, httpRecorder.Code)
+		if assert.NotNil(t, securityContext) {
+			assert.Equal(t, "0f8fad5b-d9cb-469f-a165-70867728950e", securityContext.GetIdentifier())
+		}
+	})
+}
+
+func TestJWTMiddlewareWithJWKS(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	server := jwkstest.NewServer()
+	defer server.Close()
+	require.NoError(t, server.GenerateKey("rsa", "RS256"))
+	require.NoError(t, server.GenerateKey("ed", "EdDSA"))
+
+	jwks := token.NewJWKSFromURL(server.URL(), token.WithMinRefreshInterval(0))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, jwks.Start(ctx))
+	engine := gin.New()
+	engine.Use(JWTMiddleware("", WithJWKS(jwks)))
+	engine.GET("/status", statusHandler())
+
+	userClaims := jwt.MapClaims{
+		"token_type": "user",
+		"ID":         "0f8fad5b-d9cb-469f-a165-70867728950e",
+		"email":      "user@example.com",
+		"roles":      []string{"ROLE_USER"},
+		"exp":        time.Now().Add(time.Hour).Unix(),
+	}
+	request := func(signed string) int {
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/status", nil)
+		req.Header.Set("Authorization", "Bearer "+signed)
+		engine.ServeHTTP(recorder, req)
+		return recorder.Code
+	}
+
+	t.Run("Tokens signed by a published key are accepted", func(t *testing.T) {
+		for _, kid := range []string{"rsa", "ed"} {
+			signed, err := server.Sign(kid, userClaims)
+			require.NoError(t, err)
+
+			assert.Equal(t, http.StatusOK, request(signed), kid)
+		}
+	})
+
+	t.Run("Tokens signed by a rotated key are accepted", func(t *testing.T) {
+		require.NoError(t, server.GenerateKey("rsa-2", "RS256"))
+		signed, err := server.Sign("rsa-2", userClaims)
+		require.NoError(t, err)
+
+		assert.Equal(t, http.StatusOK, request(signed))
+	})
+
+	t.Run("Tokens signed by a removed key are rejected", func(t *testing.T) {
+		signed, err := server.Sign("ed", userClaims)
+		require.NoError(t, err)
+		server.RemoveKey("ed")
+		require.NoError(t, jwks.Refresh(ctx))
+
+		assert.Equal(t, http.StatusUnauthorized, request(signed))
+	})
+
+	t.Run("HMAC tokens are rejected without a secret key", func(t *testing.T) {
+		signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, userClaims).SignedString([]byte(""))
+		require.NoError(t, err)
+
+		assert.Equal(t, http.StatusUnauthorized, request(signed))
+	})
+}
+
+// failingRevocationStore cannot tell whether a token is revoked.
+type failingRevocationStore struct {
+	token.RevocationStore
+}
+
+func (failingRevocationStore) IsRevoked(context.Context, string) (bool, error) {
+	return false, errors.New("connection refused")
+}
+
+func testUserClaims() jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"token_type": "user",
+		"ID":         "0f8fad5b-d9cb-469f-a165-70867728950e",
+		"email":      "user@example.com",
+		"roles":      []string{"ROLE_USER"},
+		"iss":        "user-service",
+		"sub":        "0f8fad5b-d9cb-469f-a165-70867728950e",
+		"aud":        []string{"chat"},
+		"exp":        now.Add(time.Hour).Unix(),
+		"nbf":        now.Add(-time.Minute).Unix(),
+		"iat":        now.Add(-time.Minute).Unix(),
+		"jti":        "a2f6c3d4",
+	}
+}
+
+func testClientClaims() jwt.MapClaims {
+	return jwt.MapClaims{
+		"token_type":  "client",
+		"client_id":   "crm",
+		"client_name": "CRM",
+		"exp":         time.Now().Add(time.Hour).Unix(),
+	}
+}
+
+func withClaims(claims jwt.MapClaims, changes jwt.MapClaims) jwt.MapClaims {
+	for name, value := range changes {
+		if value == nil {
+			delete(claims, name)
+		} else {
+			claims[name] = value
+		}
+	}
+	return claims
+}
+
+// authenticate sends the claims signed with secretKey and returns the status and problem key.
+func authenticate(t *testing.T, middleware gin.HandlerFunc, secretKey string, claims jwt.MapClaims) (int, string) {
+	t.Helper()
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secretKey))
+	require.NoError(t, err)
+
+	engine := gin.New()
+	engine.GET("/status", middleware, statusHandler())
+	recorder := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/status", nil)
+	req.Header.Set("Authorization", "Bearer "+signed)
+	engine.ServeHTTP(recorder, req)
+
+	var body map[string]any
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &body))
+	key, _ := body["key"].(string)
+	return recorder.Code, key
+}
+
+func TestJWTMiddlewareValidation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	secretKey := "secret"
+	now := time.Now()
+
+	tests := []struct {
+		name     string
+		options  []JWTOption
+		claims   jwt.MapClaims
+		expected int
+		key      string
+	}{
+		{name: "Accepted issuers pass", options: []JWTOption{WithIssuers("auth-service", "user-service")}, claims: testUserClaims(), expected: http.StatusOK},
+		{name: "Other issuers are rejected", options: []JWTOption{WithIssuers("auth-service")}, claims: testUserClaims(), expected: http.StatusUnauthorized, key: "token.issuer_invalid"},
+		{name: "Missing issuers are rejected", options: []JWTOption{WithIssuers("user-service")}, claims: withClaims(testUserClaims(), jwt.MapClaims{"iss": nil}), expected: http.StatusUnauthorized, key: "token.issuer_invalid"},
+		{name: "Accepted audiences pass", options: []JWTOption{WithAudiences("crm", "chat")}, claims: testUserClaims(), expected: http.StatusOK},
+		{name: "Other audiences are rejected", options: []JWTOption{WithAudiences("crm")}, claims: testUserClaims(), expected: http.StatusUnauthorized, key: "token.audience_invalid"},
+		{name: "Missing audiences are rejected", options: []JWTOption{WithAudiences("chat")}, claims: withClaims(testUserClaims(), jwt.MapClaims{"aud": nil}), expected: http.StatusUnauthorized, key: "token.audience_invalid"},
+		{name: "Expired tokens are rejected", claims: withClaims(testUserClaims(), jwt.MapClaims{"exp": now.Add(-30 * time.Second).Unix()}), expected: http.StatusUnauthorized, key: "token.invalid"},
+		{name: "Tokens expired within the leeway pass", options: []JWTOption{WithLeeway(time.Minute)}, claims: withClaims(testUserClaims(), jwt.MapClaims{"exp": now.Add(-30 * time.Second).Unix()}), expected: http.StatusOK},
+		{name: "Tokens expired beyond the leeway are rejected", options: []JWTOption{WithLeeway(time.Minute)}, claims: withClaims(testUserClaims(), jwt.MapClaims{"exp": now.Add(-2 * time.Minute).Unix()}), expected: http.StatusUnauthorized, key: "token.invalid"},
+		{name: "Tokens not yet valid within the leeway pass", options: []JWTOption{WithLeeway(time.Minute)}, claims: withClaims(testUserClaims(), jwt.MapClaims{"nbf": now.Add(30 * time.Second).Unix()}), expected: http.StatusOK},
+		{name: "Tokens not yet valid beyond the leeway are rejected", options: []JWTOption{WithLeeway(time.Minute)}, claims: withClaims(testUserClaims(), jwt.MapClaims{"nbf": now.Add(2 * time.Minute).Unix()}), expected: http.StatusUnauthorized, key: "token.invalid"},
+		{name: "User tokens without ID are rejected", claims: withClaims(testUserClaims(), jwt.MapClaims{"ID": nil}), expected: http.StatusUnauthorized, key: "token.user_id_invalid"},
+		{name: "User tokens with an invalid ID are rejected", claims: withClaims(testUserClaims(), jwt.MapClaims{"ID": "42"}), expected: http.StatusUnauthorized, key: "token.user_id_invalid"},
+		{name: "User tokens without email are rejected", claims: withClaims(testUserClaims(), jwt.MapClaims{"email": nil}), expected: http.StatusUnauthorized, key: "token.email_invalid"},
+		{name: "User tokens without roles are rejected", claims: withClaims(testUserClaims(), jwt.MapClaims{"roles": nil}), expected: http.StatusUnauthorized, key: "token.roles_invalid"},
+		{name: "Client tokens pass", claims: testClientClaims(), expected: http.StatusOK},
+		{name: "Client tokens without client_id are rejected", claims: withClaims(testClientClaims(), jwt.MapClaims{"client_id": nil}), expected: http.StatusUnauthorized, key: "token.client_id_invalid"},
+		{name: "Tokens without type are rejected", claims: withClaims(testUserClaims(), jwt.MapClaims{"token_type": nil}), expected: http.StatusUnauthorized, key: "token.type_unknown"},
+		{name: "Refresh tokens are rejected", claims: withClaims(testUserClaims(), jwt.MapClaims{"token_type": "refresh"}), expected: http.StatusUnauthorized, key: "token.type_unknown"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, key := authenticate(t, JWTMiddleware(secretKey, tt.options...), secretKey, tt.claims)
+
+			assert.Equal(t, tt.expected, status)
+			assert.Equal(t, tt.key, key)
+		})
+	}
+
+	t.Run("Tokens signed with another secret are rejected", func(t *testing.T) {
+		status, key := authenticate(t, JWTMiddleware(secretKey), "other", testUserClaims())
+
+		assert.Equal(t, http.StatusUnauthorized, status)
+		assert.Equal(t, "token.invalid", key)
+	})
+
+	t.Run("Tokens missing a required claim are rejected", func(t *testing.T) {
+		claims := []string{"iss", "sub", "aud", "exp", "nbf", "iat", "jti", "tenant_id"}
+		middleware := JWTMiddleware(secretKey, WithRequiredClaims(claims...))
+		complete := func() jwt.MapClaims {
+			return withClaims(testUserClaims(), jwt.MapClaims{"tenant_id": "acme"})
+		}
+
+		status, _ := authenticate(t, middleware, secretKey, complete())
+		assert.Equal(t, http.StatusOK, status)
+		for _, name := range claims {
+			status, key := authenticate(t, middleware, secretKey, withClaims(complete(), jwt.MapClaims{name: nil}))
+
+			assert.Equal(t, http.StatusUnauthorized, status, name)
+			assert.Equal(t, "token.claim_missing", key, name)
+		}
+	})
+
+	t.Run("Revoked tokens are rejected", func(t *testing.T) {
+		store := token.NewInMemoryRevocationStore()
+		middleware := JWTMiddleware(secretKey, WithRevocationStore(store))
+		require.NoError(t, store.Revoke(context.Background(), "a2f6c3d4", now.Add(time.Hour)))
+
+		status, key := authenticate(t, middleware, secretKey, testUserClaims())
+		assert.Equal(t, http.StatusUnauthorized, status)
+		assert.Equal(t, "token.revoked", key)
+
+		status, _ = authenticate(t, middleware, secretKey, withClaims(testUserClaims(), jwt.MapClaims{"jti": "b7e1f0a9"}))
+		assert.Equal(t, http.StatusOK, status)
+	})
+
+	t.Run("Tokens issued before the revocation of their subject are rejected", func(t *testing.T) {
+		store := token.NewInMemoryRevocationStore()
+		middleware := JWTMiddleware(secretKey, WithRevocationStore(store))
+		require.NoError(t, store.RevokeIssuedBefore(context.Background(), "0f8fad5b-d9cb-469f-a165-70867728950e", now.Add(-2*time.Minute)))
+
+		status, key := authenticate(t, middleware, secretKey, withClaims(testUserClaims(), jwt.MapClaims{"iat": now.Add(-3 * time.Minute).Unix()}))
+		assert.Equal(t, http.StatusUnauthorized, status)
+		assert.Equal(t, "token.revoked", key)
+
+		status, _ = authenticate(t, middleware, secretKey, testUserClaims())
+		assert.Equal(t, http.StatusOK, status)
+	})
+
+	t.Run("Unavailable revocation stores fail closed", func(t *testing.T) {
+		middleware := JWTMiddleware(secretKey, WithRevocationStore(failingRevocationStore{}))
+
+		status, key := authenticate(t, middleware, secretKey, testUserClaims())
+
+		assert.Equal(t, http.StatusServiceUnavailable, status)
+		assert.Equal(t, "token.revocation_unavailable", key)
+	})
 }
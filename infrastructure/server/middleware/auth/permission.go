@@ -0,0 +1,30 @@
+package auth
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jperdior/chatbot-kit/application/auth"
+	"github.com/jperdior/chatbot-kit/presentation"
+)
+
+// RequirePermissions is a middleware that checks the authenticated user or client is granted
+// every permission, to be used after JWTMiddleware, given WithPermissionResolver, or
+// APIKeyMiddleware.
+func RequirePermissions(permissions ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		securityContext, err := auth.FromContext(c.Request.Context())
+		if err != nil {
+			presentation.AbortWithProblem(c, presentation.NewProblemDetails(http.StatusUnauthorized, "Authentication is required").WithKey("authentication.required", nil))
+			return
+		}
+
+		for _, permission := range permissions {
+			if err := auth.Authorize(securityContext, permission); err != nil {
+				presentation.AbortWithError(c, err)
+				return
+			}
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,173 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jperdior/chatbot-kit/application/auth"
+	"github.com/jperdior/chatbot-kit/domain"
+	"github.com/jperdior/chatbot-kit/domain/user"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequirePermissions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	rbac, err := auth.NewRBAC([]auth.Role{
+		{Name: "viewer", Permissions: []string{"chats:read"}},
+		{Name: "agent", Permissions: []string{"chats:write"}, Inherits: []string{"viewer"}},
+	})
+	require.NoError(t, err)
+	rbac.SetScopes(map[string][]string{"chats": {"chats:read", "chats:write"}})
+	newClient := func(scopes ...string) auth.SecurityContext {
+		client := auth.NewClientSecurityContext("crm", "CRM")
+		client.Scopes = scopes
+		return auth.WithPermissions(client, rbac)
+	}
+	newUser := func(roles ...string) auth.SecurityContext {
+		return auth.WithPermissions(auth.NewUserSecurityContext(user.NewRandomUserID(), "", roles), rbac)
+	}
+
+	tests := []struct {
+		name            string
+		securityContext auth.SecurityContext
+		permissions     []string
+		expected        int
+	}{
+		{name: "Inherited permissions pass", securityContext: newUser("agent"), permissions: []string{"chats:read", "chats:write"}, expected: http.StatusOK},
+		{name: "A missing permission is forbidden", securityContext: newUser("viewer"), permissions: []string{"chats:read", "chats:write"}, expected: http.StatusForbidden},
+		{name: "Clients are granted the permissions mapped to their scopes", securityContext: newClient("chats"), permissions: []string{"chats:write"}, expected: http.StatusOK},
+		{name: "Client scopes are not permissions", securityContext: newClient("chats:*"), permissions: []string{"chats:write"}, expected: http.StatusForbidden},
+		{name: "Anonymous requests are unauthorized", permissions: []string{"chats:read"}, expected: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine := gin.New()
+			engine.Use(setSecurityContextMiddleware(tt.securityContext))
+			engine.Use(RequirePermissions(tt.permissions...))
+			engine.GET("/status", statusHandler())
+
+			recorder := httptest.NewRecorder()
+			engine.ServeHTTP(recorder, httptest.NewRequest("GET", "/status", nil))
+
+			assert.Equal(t, tt.expected, recorder.Code)
+		})
+	}
+}
+
+func TestRequirePermissionsAfterJWTMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	rbac, err := auth.NewRBAC([]auth.Role{{Name: "ROLE_USER", Permissions: []string{"chats:read"}}})
+	require.NoError(t, err)
+	signed, err := generateValidToken("secret")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		options    []JWTOption
+		permission string
+		expected   int
+	}{
+		{name: "Permissions of the roles pass", options: []JWTOption{WithPermissionResolver(rbac)}, permission: "chats:read", expected: http.StatusOK},
+		{name: "Other permissions are forbidden", options: []JWTOption{WithPermissionResolver(rbac)}, permission: "chats:write", expected: http.StatusForbidden},
+		{name: "Nothing is granted without a permission resolver", permission: "chats:read", expected: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine := gin.New()
+			engine.GET("/status", JWTMiddleware("secret", tt.options...), RequirePermissions(tt.permission), statusHandler())
+
+			recorder := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", "/status", nil)
+			req.Header.Set("Authorization", "Bearer "+signed)
+			engine.ServeHTTP(recorder, req)
+
+			assert.Equal(t, tt.expected, recorder.Code)
+		})
+	}
+}
+
+func TestRequirePermissionsForClientTokens(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	rbac, err := auth.NewRBAC(nil)
+	require.NoError(t, err)
+	rbac.SetScopes(map[string][]string{"chats": {"chats:read"}})
+
+	tests := []struct {
+		name     string
+		scope    string
+		expected int
+	}{
+		{name: "Permissions mapped to the scopes pass", scope: "chats", expected: http.StatusOK},
+		{name: "Scopes named like the permission are forbidden", scope: "chats:read", expected: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, withClaims(testClientClaims(), jwt.MapClaims{"scope": tt.scope})).SignedString([]byte("secret"))
+			require.NoError(t, err)
+			engine := gin.New()
+			engine.GET("/status", JWTMiddleware("secret", WithPermissionResolver(rbac)), RequirePermissions("chats:read"), statusHandler())
+
+			recorder := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", "/status", nil)
+			req.Header.Set("Authorization", "Bearer "+signed)
+			engine.ServeHTTP(recorder, req)
+
+			assert.Equal(t, tt.expected, recorder.Code)
+		})
+	}
+}
+
+type testAPIKeyAuthenticator map[string]*auth.ClientSecurityContext
+
+func (a testAPIKeyAuthenticator) Authenticate(_ context.Context, key string) (*auth.ClientSecurityContext, error) {
+	client, ok := a[key]
+	if !ok {
+		return nil, domain.ErrUnauthorized
+	}
+	return client, nil
+}
+
+func TestRequirePermissionsAfterAPIKeyMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	rbac, err := auth.NewRBAC(nil)
+	require.NoError(t, err)
+	rbac.SetScopes(map[string][]string{"chats": {"chats:read"}})
+	client := auth.NewClientSecurityContext("crm", "CRM")
+	client.Scopes = []string{"chats"}
+	authenticator := testAPIKeyAuthenticator{"secret-key": client}
+
+	tests := []struct {
+		name       string
+		options    []APIKeyOption
+		permission string
+		expected   int
+	}{
+		{name: "Permissions of the scopes pass", options: []APIKeyOption{WithAPIKeyPermissionResolver(rbac)}, permission: "chats:read", expected: http.StatusOK},
+		{name: "Other permissions are forbidden", options: []APIKeyOption{WithAPIKeyPermissionResolver(rbac)}, permission: "chats:write", expected: http.StatusForbidden},
+		{name: "Nothing is granted without a permission resolver", permission: "chats:read", expected: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine := gin.New()
+			engine.GET("/status", APIKeyMiddleware(authenticator, tt.options...), RequirePermissions(tt.permission), statusHandler())
+
+			recorder := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", "/status", nil)
+			req.Header.Set(APIKeyHeader, "secret-key")
+			engine.ServeHTTP(recorder, req)
+
+			assert.Equal(t, tt.expected, recorder.Code)
+		})
+	}
+
+	assert.Nil(t, client.Permissions, "the authenticated client was modified")
+}
@@ -1,38 +1,31 @@
 package auth
 
 import (
-	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
 	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jperdior/chatbot-kit/application/auth"
+	"github.com/jperdior/chatbot-kit/presentation"
 )
 
-// RoleMiddleware is a middleware that checks if the user has the required roles
+// RoleMiddleware is a middleware that checks the authenticated user has any of the required roles,
+// to be used after JWTMiddleware. Given WithPermissionResolver an RBAC, inherited roles count too.
+// Prefer RequirePermissions, which does not tie routes to role names.
 func RoleMiddleware(requiredRoles []string) gin.HandlerFunc {
-	return func(context *gin.Context) {
-		claims, exists := context.Get("claims")
-		if !exists {
-			context.JSON(http.StatusForbidden, gin.H{"error": "Forbidden"})
-			context.Abort()
-			return
-		}
-
-		roleClaims, ok := claims.(jwt.MapClaims)["roles"].([]interface{})
-		if !ok {
-			context.JSON(http.StatusForbidden, gin.H{"error": "Forbidden"})
-			context.Abort()
+	return func(c *gin.Context) {
+		securityContext, err := auth.FromContext(c.Request.Context())
+		if err != nil {
+			presentation.AbortWithProblem(c, presentation.NewProblemDetails(http.StatusForbidden, "Forbidden").WithKey("role.forbidden", nil))
 			return
 		}
 
-		for _, userRole := range roleClaims {
-			for _, requiredRole := range requiredRoles {
-				if userRole == requiredRole {
-					context.Next()
-					return
-				}
+		for _, role := range requiredRoles {
+			if securityContext.HasRole(role) {
+				c.Next()
+				return
 			}
 		}
 
-		context.JSON(http.StatusForbidden, gin.H{"error": "Forbidden: insufficient permissions"})
-		context.Abort()
+		presentation.AbortWithProblem(c, presentation.NewProblemDetails(http.StatusForbidden, "Forbidden: insufficient permissions").WithKey("role.insufficient", nil))
 	}
 }
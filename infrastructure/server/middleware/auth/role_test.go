@@ -1,57 +1,74 @@
 package auth
 
 import (
-	"chatbot-service/internal/platform/server/handler/status"
-	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
-	"github.com/stretchr/testify/assert"
 	"net/http"
 	"net/http/httptest"
 	"testing"
-)
 
-func setClaimsMiddleware(claims jwt.MapClaims) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		c.Set("claims", claims)
-		c.Next()
-	}
-}
+	"github.com/gin-gonic/gin"
+	"github.com/jperdior/chatbot-kit/application/auth"
+	"github.com/jperdior/chatbot-kit/domain/user"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
 
 func TestRoleMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	rbac, err := auth.NewRBAC([]auth.Role{
+		{Name: "viewer", Permissions: []string{"chats:read"}},
+		{Name: "admin", Permissions: []string{"users:*"}, Inherits: []string{"viewer"}},
+	})
+	require.NoError(t, err)
+	newUser := func(roles ...string) *auth.UserSecurityContext {
+		return auth.NewUserSecurityContext(user.NewRandomUserID(), "user@example.com", roles)
+	}
 
-	t.Run("Token with required roles", func(t *testing.T) {
-		gin.SetMode(gin.TestMode)
-		engine := gin.New()
+	tests := []struct {
+		name            string
+		securityContext auth.SecurityContext
+		requiredRoles   []string
+		expected        int
+	}{
+		{name: "Users with any of the required roles pass", securityContext: newUser("ROLE_USER", "ROLE_SUPER_ADMIN"), requiredRoles: []string{"ROLE_ADMIN", "ROLE_SUPER_ADMIN"}, expected: http.StatusOK},
+		{name: "Users without the required roles are forbidden", securityContext: newUser("ROLE_USER"), requiredRoles: []string{"ROLE_SUPER_ADMIN"}, expected: http.StatusForbidden},
+		{name: "Inherited roles pass", securityContext: auth.WithPermissions(newUser("admin"), rbac), requiredRoles: []string{"viewer"}, expected: http.StatusOK},
+		{name: "Roles are not inherited without a role hierarchy", securityContext: newUser("admin"), requiredRoles: []string{"viewer"}, expected: http.StatusForbidden},
+		{name: "Parent roles do not have the roles inheriting from them", securityContext: auth.WithPermissions(newUser("viewer"), rbac), requiredRoles: []string{"admin"}, expected: http.StatusForbidden},
+		{name: "Clients have no roles", securityContext: auth.NewClientSecurityContext("crm", "CRM"), requiredRoles: []string{"viewer"}, expected: http.StatusForbidden},
+		{name: "Anonymous requests are forbidden", requiredRoles: []string{"viewer"}, expected: http.StatusForbidden},
+	}
 
-		claims := jwt.MapClaims{
-			"roles": []interface{}{"ROLE_SUPER_ADMIN"},
-		}
-		engine.Use(setClaimsMiddleware(claims))
-		engine.Use(RoleMiddleware([]string{"ROLE_SUPER_ADMIN"}))
-		engine.GET("/status", status.StatusHandler())
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine := gin.New()
+			engine.Use(setSecurityContextMiddleware(tt.securityContext))
+			engine.Use(RoleMiddleware(tt.requiredRoles))
+			engine.GET("/status", statusHandler())
 
-		recorder := httptest.NewRecorder()
-		req := httptest.NewRequest("GET", "/status", nil)
-		engine.ServeHTTP(recorder, req)
+			recorder := httptest.NewRecorder()
+			engine.ServeHTTP(recorder, httptest.NewRequest("GET", "/status", nil))
 
-		assert.Equal(t, http.StatusOK, recorder.Code)
-	})
+			assert.Equal(t, tt.expected, recorder.Code)
+		})
+	}
 
-	t.Run("Token without required roles", func(t *testing.T) {
-		gin.SetMode(gin.TestMode)
+	t.Run("Roles inherited through the JWT middleware pass", func(t *testing.T) {
+		rbac, err := auth.NewRBAC([]auth.Role{
+			{Name: "ROLE_USER"},
+			{Name: "ROLE_SUPER_ADMIN", Inherits: []string{"ROLE_ADMIN"}},
+			{Name: "ROLE_ADMIN"},
+		})
+		require.NoError(t, err)
+		signed, err := generateValidToken("secret")
+		require.NoError(t, err)
 		engine := gin.New()
-
-		claims := jwt.MapClaims{
-			"roles": []interface{}{"ROLE_USER"},
-		}
-		engine.Use(setClaimsMiddleware(claims))
-		engine.Use(RoleMiddleware([]string{"ROLE_SUPER_ADMIN"}))
-		engine.GET("/status", status.StatusHandler())
+		engine.GET("/status", JWTMiddleware("secret", WithPermissionResolver(rbac)), RoleMiddleware([]string{"ROLE_ADMIN"}), statusHandler())
 
 		recorder := httptest.NewRecorder()
 		req := httptest.NewRequest("GET", "/status", nil)
+		req.Header.Set("Authorization", "Bearer "+signed)
 		engine.ServeHTTP(recorder, req)
 
-		assert.Equal(t, http.StatusForbidden, recorder.Code)
+		assert.Equal(t, http.StatusOK, recorder.Code)
 	})
 }
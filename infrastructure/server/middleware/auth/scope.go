@@ -0,0 +1,44 @@
+package auth
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jperdior/chatbot-kit/application/auth"
+	"github.com/jperdior/chatbot-kit/presentation"
+)
+
+// ScopeMatch tells whether all or any of the required scopes must be granted.
+type ScopeMatch int
+
+const (
+	AllScopes ScopeMatch = iota
+	AnyScope
+)
+
+// RequireScopes is a middleware that checks the scopes granted to the authenticated user or
+// client, to be used after JWTMiddleware or APIKeyMiddleware. Without scopes it only requires
+// the request to be authenticated, whatever the match.
+func RequireScopes(match ScopeMatch, scopes ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		securityContext, err := auth.FromContext(c.Request.Context())
+		if err != nil {
+			presentation.AbortWithProblem(c, presentation.NewProblemDetails(http.StatusUnauthorized, "Authentication is required").WithKey("authentication.required", nil))
+			return
+		}
+
+		granted := securityContext.HasScopes(scopes)
+		if match == AnyScope && len(scopes) > 0 {
+			granted = slices.ContainsFunc(scopes, securityContext.HasScope)
+		}
+		if !granted {
+			problem := presentation.NewProblemDetails(http.StatusForbidden, "Forbidden: insufficient scopes").
+				WithKey("scope.insufficient", map[string]any{"scopes": strings.Join(scopes, ", ")})
+			presentation.AbortWithProblem(c, problem.WithExtension("required_scopes", scopes))
+			return
+		}
+		c.Next()
+	}
+}
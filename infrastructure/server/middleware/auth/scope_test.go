@@ -0,0 +1,85 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jperdior/chatbot-kit/application/auth"
+	"github.com/jperdior/chatbot-kit/application/i18n"
+	"github.com/jperdior/chatbot-kit/presentation"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setSecurityContextMiddleware(securityContext auth.SecurityContext) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if securityContext != nil {
+			c.Request = c.Request.WithContext(auth.WithSecurityContext(c.Request.Context(), securityContext))
+		}
+		c.Next()
+	}
+}
+
+func TestRequireScopes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	client := auth.NewClientSecurityContext("crm", "CRM")
+	client.Scopes = []string{"chats:read", "chats:write"}
+
+	tests := []struct {
+		name            string
+		securityContext auth.SecurityContext
+		match           ScopeMatch
+		scopes          []string
+		expected        int
+	}{
+		{name: "All granted scopes pass", securityContext: client, match: AllScopes, scopes: []string{"chats:read", "chats:write"}, expected: http.StatusOK},
+		{name: "A missing scope is forbidden", securityContext: client, match: AllScopes, scopes: []string{"chats:read", "chats:delete"}, expected: http.StatusForbidden},
+		{name: "Any granted scope passes", securityContext: client, match: AnyScope, scopes: []string{"chats:delete", "chats:write"}, expected: http.StatusOK},
+		{name: "No granted scope is forbidden", securityContext: client, match: AnyScope, scopes: []string{"chats:delete"}, expected: http.StatusForbidden},
+		{name: "No required scopes pass with all", securityContext: client, match: AllScopes, expected: http.StatusOK},
+		{name: "No required scopes pass with any", securityContext: client, match: AnyScope, expected: http.StatusOK},
+		{name: "Anonymous requests are unauthorized", match: AnyScope, expected: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine := gin.New()
+			engine.Use(setSecurityContextMiddleware(tt.securityContext))
+			engine.Use(RequireScopes(tt.match, tt.scopes...))
+			engine.GET("/status", statusHandler())
+
+			recorder := httptest.NewRecorder()
+			engine.ServeHTTP(recorder, httptest.NewRequest("GET", "/status", nil))
+
+			assert.Equal(t, tt.expected, recorder.Code)
+		})
+	}
+}
+
+func TestRequireScopesLocalization(t *testing.T) {
+	catalog, err := i18n.NewKitCatalog()
+	require.NoError(t, err)
+	presentation.SetMessageCatalog(catalog)
+	defer presentation.SetMessageCatalog(nil)
+
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.Use(setSecurityContextMiddleware(auth.NewClientSecurityContext("crm", "CRM")))
+	engine.Use(RequireScopes(AllScopes, "chats:read", "chats:write"))
+	engine.GET("/status", statusHandler())
+
+	recorder := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/status", nil)
+	req.Header.Set("Accept-Language", "es")
+	engine.ServeHTTP(recorder, req)
+
+	var body map[string]any
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &body))
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+	assert.Equal(t, "scope.insufficient", body["key"])
+	assert.Equal(t, "No tienes permiso para hacer esto, se requieren los scopes chats:read, chats:write", body["detail"])
+	assert.Equal(t, []any{"chats:read", "chats:write"}, body["required_scopes"])
+}
@@ -0,0 +1,42 @@
+package correlation
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jperdior/chatbot-kit/application/correlation"
+)
+
+const HeaderName = "X-Correlation-ID"
+
+// MaxIDLength is the length of the longest correlation ID accepted from the header.
+const MaxIDLength = 128
+
+// CorrelationMiddleware propagates the X-Correlation-ID header, generating one when missing or
+// invalid, into the request context and the response headers. Valid IDs have up to MaxIDLength
+// letters, digits, '-', '_', '.' or ':'.
+func CorrelationMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Request.Header.Get(HeaderName)
+		if !validID(id) {
+			id = uuid.New().String()
+		}
+		c.Request = c.Request.WithContext(correlation.WithID(c.Request.Context(), id))
+		c.Set("correlationID", id)
+		c.Header(HeaderName, id)
+		c.Next()
+	}
+}
+
+func validID(id string) bool {
+	if id == "" || len(id) > MaxIDLength {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.', r == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
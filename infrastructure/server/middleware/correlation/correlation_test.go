@@ -0,0 +1,56 @@
+package correlation
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jperdior/chatbot-kit/application/correlation"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCorrelationMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var propagated string
+	engine := gin.New()
+	engine.GET("/status", CorrelationMiddleware(), func(c *gin.Context) {
+		propagated = correlation.IDFromContext(c.Request.Context())
+		c.Status(http.StatusOK)
+	})
+
+	serve := func(header string) string {
+		propagated = ""
+		req := httptest.NewRequest(http.MethodGet, "/status", nil)
+		if header != "" {
+			req.Header.Set(HeaderName, header)
+		}
+		recorder := httptest.NewRecorder()
+		engine.ServeHTTP(recorder, req)
+		assert.Equal(t, propagated, recorder.Header().Get(HeaderName))
+		return propagated
+	}
+
+	t.Run("Valid IDs are propagated", func(t *testing.T) {
+		assert.Equal(t, "req-42_a.b:c", serve("req-42_a.b:c"))
+	})
+
+	tests := []struct {
+		name   string
+		header string
+	}{
+		{"Missing IDs", ""},
+		{"Too long IDs", strings.Repeat("a", MaxIDLength+1)},
+		{"IDs with other characters", "req 42\r\nX-Injected: 1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name+" are replaced by a generated one", func(t *testing.T) {
+			_, err := uuid.Parse(serve(tt.header))
+
+			assert.NoError(t, err)
+		})
+	}
+}
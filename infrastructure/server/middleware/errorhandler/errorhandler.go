@@ -0,0 +1,19 @@
+package errorhandler
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/jperdior/chatbot-kit/presentation"
+)
+
+// ErrorHandlerMiddleware renders the last error added with c.Error by the handlers as a
+// problem+json document when they did not write a response themselves.
+func ErrorHandlerMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		if len(c.Errors) == 0 || c.Writer.Written() {
+			return
+		}
+		presentation.AbortWithError(c, c.Errors.Last().Err)
+	}
+}
@@ -0,0 +1,98 @@
+package errorhandler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jperdior/chatbot-kit/application/i18n"
+	"github.com/jperdior/chatbot-kit/domain"
+	"github.com/jperdior/chatbot-kit/infrastructure/server/middleware/correlation"
+	"github.com/jperdior/chatbot-kit/presentation"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorHandlerMiddleware(t *testing.T) {
+	serve := func(err error) *httptest.ResponseRecorder {
+		gin.SetMode(gin.TestMode)
+		engine := gin.New()
+		engine.Use(correlation.CorrelationMiddleware(), ErrorHandlerMiddleware())
+		engine.GET("/test", func(c *gin.Context) {
+			_ = c.Error(err)
+		})
+
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/test", nil)
+		req.Header.Set(correlation.HeaderName, "correlation-id")
+		engine.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	t.Run("Validation error with fields", func(t *testing.T) {
+		err := domain.NewValidationError("invalid email", "email.invalid",
+			domain.FieldError{Field: "email", Message: "must be an email"})
+
+		recorder := serve(err)
+
+		assert.Equal(t, http.StatusBadRequest, recorder.Code)
+		assert.Equal(t, presentation.ProblemContentType, recorder.Header().Get("Content-Type"))
+		var body presentation.ProblemDetails
+		assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &body))
+		assert.Equal(t, "email.invalid", body.Key)
+		assert.Equal(t, "/test", body.Instance)
+		assert.Equal(t, "correlation-id", body.CorrelationID)
+		assert.Equal(t, "email", body.Errors[0].Field)
+	})
+
+	t.Run("Typed not found error", func(t *testing.T) {
+		recorder := serve(domain.NewNotFoundError("user", "42"))
+
+		assert.Equal(t, http.StatusNotFound, recorder.Code)
+	})
+
+	t.Run("Unknown error is not exposed", func(t *testing.T) {
+		recorder := serve(errors.New("connection refused"))
+
+		assert.Equal(t, http.StatusInternalServerError, recorder.Code)
+		assert.NotContains(t, recorder.Body.String(), "connection refused")
+	})
+}
+
+func TestErrorHandlerMiddlewareLocalization(t *testing.T) {
+	catalog, err := i18n.NewKitCatalog()
+	assert.NoError(t, err)
+	presentation.SetMessageCatalog(catalog)
+	defer presentation.SetMessageCatalog(nil)
+
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.Use(ErrorHandlerMiddleware())
+	engine.GET("/test", func(c *gin.Context) {
+		_, err := domain.NewPageSizeValueObject(500)
+		_ = c.Error(err)
+	})
+
+	recorder := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/test", nil)
+	req.Header.Set("Accept-Language", "fr-FR, es-ES;q=0.8, en;q=0.5")
+	engine.ServeHTTP(recorder, req)
+
+	var body presentation.ProblemDetails
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &body))
+	assert.Equal(t, "es", recorder.Header().Get("Content-Language"))
+	assert.Equal(t, "El tamaño de página debe ser menor o igual que 100", body.Detail)
+}
+
+func TestDomainErrorMatching(t *testing.T) {
+	cause := errors.New("timeout")
+	err := domain.NewUnavailableError("llm provider unavailable", "llm.unavailable").WithCause(cause)
+
+	assert.ErrorIs(t, err, domain.ErrUnavailable)
+	assert.ErrorIs(t, err, cause)
+	assert.NotErrorIs(t, err, domain.ErrNotFound)
+	assert.ErrorIs(t, domain.NewNotFoundError("user", "42"), domain.ErrNotFound)
+	assert.Equal(t, http.StatusServiceUnavailable, presentation.HTTPStatus(err))
+}
@@ -0,0 +1,28 @@
+package i18n
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/jperdior/chatbot-kit/application/i18n"
+)
+
+// LocaleResolver returns the preferred locale of the request, e.g. the one stored in the
+// profile of the authenticated user, or an empty string when unknown.
+type LocaleResolver func(c *gin.Context) string
+
+// LanguageMiddleware negotiates the language of the request among the ones of the catalog,
+// preferring the locales returned by the resolvers over the Accept-Language header, and stores
+// it in the request context.
+func LanguageMiddleware(catalog *i18n.Catalog, resolvers ...LocaleResolver) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		preferences := make([]string, 0, len(resolvers)+1)
+		for _, resolver := range resolvers {
+			preferences = append(preferences, resolver(c))
+		}
+		preferences = append(preferences, c.GetHeader("Accept-Language"))
+
+		lang := catalog.Match(preferences...)
+		c.Request = c.Request.WithContext(i18n.WithLanguage(c.Request.Context(), lang))
+		c.Set("language", lang)
+		c.Next()
+	}
+}
@@ -0,0 +1,81 @@
+package token
+
+import (
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	UserTokenType    = "user"
+	ClientTokenType  = "client"
+	RefreshTokenType = "refresh"
+)
+
+// Claims are the claims of the tokens issued by JWTTokenGenerator.
+type Claims struct {
+	jwt.RegisteredClaims
+	TokenType  string   `json:"token_type,omitempty"`
+	UserID     string   `json:"ID,omitempty"`
+	Email      string   `json:"email,omitempty"`
+	Roles      []string `json:"roles,omitempty"`
+	ClientID   string   `json:"client_id,omitempty"`
+	ClientName string   `json:"client_name,omitempty"`
+	TenantID   string   `json:"tenant_id,omitempty"`
+	// Scope holds the space separated scopes granted to the token, as in OAuth 2.0.
+	Scope string `json:"scope,omitempty"`
+}
+
+// Scopes returns the granted scopes as a slice.
+func (c *Claims) Scopes() []string {
+	return strings.Fields(c.Scope)
+}
+
+// SubjectID returns the sub claim, or the user or client ID of the tokens issued without it.
+func (c *Claims) SubjectID() string {
+	if c.Subject != "" {
+		return c.Subject
+	}
+	if c.UserID != "" {
+		return c.UserID
+	}
+	return c.ClientID
+}
+
+// Has reports whether the named claim is present, false for unknown claims.
+func (c *Claims) Has(name string) bool {
+	switch name {
+	case "iss":
+		return c.Issuer != ""
+	case "sub":
+		return c.Subject != ""
+	case "aud":
+		return len(c.Audience) > 0
+	case "exp":
+		return c.ExpiresAt != nil
+	case "nbf":
+		return c.NotBefore != nil
+	case "iat":
+		return c.IssuedAt != nil
+	case "jti":
+		return c.ID != ""
+	case "token_type":
+		return c.TokenType != ""
+	case "ID":
+		return c.UserID != ""
+	case "email":
+		return c.Email != ""
+	case "roles":
+		return c.Roles != nil
+	case "client_id":
+		return c.ClientID != ""
+	case "client_name":
+		return c.ClientName != ""
+	case "tenant_id":
+		return c.TenantID != ""
+	case "scope":
+		return c.Scope != ""
+	default:
+		return false
+	}
+}
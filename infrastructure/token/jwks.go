@@ -0,0 +1,364 @@
+package token
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrUnknownKeyID   = errors.New("unknown key id")
+	ErrKeyAlgorithm   = errors.New("signing method does not match the key")
+	ErrUnsupportedKey = errors.New("unsupported key type")
+	ErrMissingKeyID   = errors.New("token has no kid header")
+)
+
+// JSONWebKey is the public part of a key as published in a JWKS document (RFC 7517).
+type JSONWebKey struct {
+	KeyType string `json:"kty"`
+	KeyID   string `json:"kid"`
+	Use     string `json:"use,omitempty"`
+	Alg     string `json:"alg,omitempty"`
+	Curve   string `json:"crv,omitempty"`
+	N       string `json:"n,omitempty"`
+	E       string `json:"e,omitempty"`
+	X       string `json:"x,omitempty"`
+	Y       string `json:"y,omitempty"`
+}
+
+// JSONWebKeySet is a JWKS document.
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+// NewJSONWebKey describes an RSA, ECDSA or Ed25519 public key.
+func NewJSONWebKey(kid, alg string, key crypto.PublicKey) (JSONWebKey, error) {
+	jwk := JSONWebKey{KeyID: kid, Alg: alg, Use: "sig"}
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		jwk.KeyType = "RSA"
+		jwk.N = encodeSegment(k.N.Bytes())
+		jwk.E = encodeSegment(big.NewInt(int64(k.E)).Bytes())
+	case *ecdsa.PublicKey:
+		size := (k.Curve.Params().BitSize + 7) / 8
+		jwk.KeyType = "EC"
+		jwk.Curve = k.Curve.Params().Name
+		jwk.X = encodeSegment(k.X.FillBytes(make([]byte, size)))
+		jwk.Y = encodeSegment(k.Y.FillBytes(make([]byte, size)))
+	case ed25519.PublicKey:
+		jwk.KeyType = "OKP"
+		jwk.Curve = "Ed25519"
+		jwk.X = encodeSegment(k)
+	default:
+		return JSONWebKey{}, fmt.Errorf("%w: %T", ErrUnsupportedKey, key)
+	}
+	return jwk, nil
+}
+
+// PublicKey decodes the key described by the JWK.
+func (k JSONWebKey) PublicKey() (crypto.PublicKey, error) {
+	switch k.KeyType {
+	case "RSA":
+		n, err := decodeSegment(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeSegment(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Curve {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("%w: curve %s", ErrUnsupportedKey, k.Curve)
+		}
+		x, err := decodeSegment(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeSegment(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	case "OKP":
+		if k.Curve != "Ed25519" {
+			return nil, fmt.Errorf("%w: curve %s", ErrUnsupportedKey, k.Curve)
+		}
+		x, err := decodeSegment(k.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("%w: invalid Ed25519 key size", ErrUnsupportedKey)
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedKey, k.KeyType)
+	}
+}
+
+// JWKSHandler serves a JWKS document, for the issuer to publish its keys or as a local
+// stand-in of an identity provider.
+func JWKSHandler(keySet func() JSONWebKeySet) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(keySet())
+	})
+}
+
+type jwksKey struct {
+	key crypto.PublicKey
+	alg string
+}
+
+type jwksOptions struct {
+	refreshInterval    time.Duration
+	minRefreshInterval time.Duration
+	httpClient         *http.Client
+}
+
+type JWKSOption func(*jwksOptions)
+
+// WithRefreshInterval sets how often Start refreshes the keys, every hour by default.
+func WithRefreshInterval(interval time.Duration) JWKSOption {
+	return func(o *jwksOptions) {
+		o.refreshInterval = interval
+	}
+}
+
+// WithMinRefreshInterval limits the refreshes triggered by unknown key ids, 30 seconds by default.
+func WithMinRefreshInterval(interval time.Duration) JWKSOption {
+	return func(o *jwksOptions) {
+		o.minRefreshInterval = interval
+	}
+}
+
+// WithHTTPClient sets the client used to fetch a remote JWKS document.
+func WithHTTPClient(client *http.Client) JWKSOption {
+	return func(o *jwksOptions) {
+		o.httpClient = client
+	}
+}
+
+// JWKS caches the verification keys of a JWKS document. Keys are selected by the kid header of
+// the tokens. An unknown kid triggers a refresh, rate limited, so that a key published during a
+// rotation is picked up before the next periodic refresh.
+type JWKS struct {
+	fetch              func(ctx context.Context) ([]byte, error)
+	refreshInterval    time.Duration
+	minRefreshInterval time.Duration
+
+	mu   sync.RWMutex
+	keys map[string]jwksKey
+
+	// refreshMu serializes the refreshes so that concurrent unknown kids fetch the document once.
+	refreshMu   sync.Mutex
+	lastRefresh time.Time // last attempt, successful or not
+}
+
+func newJWKS(fetch func(ctx context.Context, options *jwksOptions) ([]byte, error), opts []JWKSOption) *JWKS {
+	options := &jwksOptions{
+		refreshInterval:    time.Hour,
+		minRefreshInterval: 30 * time.Second,
+		httpClient:         &http.Client{Timeout: 10 * time.Second},
+	}
+	for _, opt := range opts {
+		opt(options)
+	}
+	return &JWKS{
+		fetch: func(ctx context.Context) ([]byte, error) {
+			return fetch(ctx, options)
+		},
+		refreshInterval:    options.refreshInterval,
+		minRefreshInterval: options.minRefreshInterval,
+		keys:               make(map[string]jwksKey),
+	}
+}
+
+// NewJWKSFromURL returns a key set fetched from the JWKS endpoint of an identity provider.
+func NewJWKSFromURL(url string, opts ...JWKSOption) *JWKS {
+	return newJWKS(func(ctx context.Context, options *jwksOptions) ([]byte, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := options.httpClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("failed to fetch JWKS from %s: status %d", url, resp.StatusCode)
+		}
+		return io.ReadAll(resp.Body)
+	}, opts)
+}
+
+// NewJWKSFromFile returns a key set read from a local JWKS document.
+func NewJWKSFromFile(path string, opts ...JWKSOption) *JWKS {
+	return newJWKS(func(_ context.Context, _ *jwksOptions) ([]byte, error) {
+		return os.ReadFile(path)
+	}, opts)
+}
+
+// Refresh reloads the keys. Keys that cannot be decoded are skipped.
+func (j *JWKS) Refresh(ctx context.Context) error {
+	j.refreshMu.Lock()
+	defer j.refreshMu.Unlock()
+	return j.refresh(ctx)
+}
+
+// refresh reloads the keys, the caller holding refreshMu.
+func (j *JWKS) refresh(ctx context.Context) error {
+	j.lastRefresh = time.Now()
+
+	content, err := j.fetch(ctx)
+	if err != nil {
+		return err
+	}
+	var keySet JSONWebKeySet
+	if err := json.Unmarshal(content, &keySet); err != nil {
+		return fmt.Errorf("failed to parse JWKS: %w", err)
+	}
+
+	keys := make(map[string]jwksKey, len(keySet.Keys))
+	for _, jwk := range keySet.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.PublicKey()
+		if err != nil {
+			continue
+		}
+		keys[jwk.KeyID] = jwksKey{key: key, alg: jwk.Alg}
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.keys = keys
+	return nil
+}
+
+// Start refreshes the keys in the background until ctx is done. The first refresh is
+// synchronous so that its error is reported.
+func (j *JWKS) Start(ctx context.Context) error {
+	if err := j.Refresh(ctx); err != nil {
+		return err
+	}
+	go func() {
+		ticker := time.NewTicker(j.refreshInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				// On failure the cached keys are kept until the next tick.
+				_ = j.Refresh(ctx)
+			}
+		}
+	}()
+	return nil
+}
+
+// Key returns the verification key of the token, matching its kid header and algorithm.
+func (j *JWKS) Key(ctx context.Context, token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		return nil, ErrMissingKeyID
+	}
+
+	key, ok := j.cachedKey(kid)
+	if !ok {
+		var err error
+		if key, ok, err = j.refreshFor(ctx, kid); err != nil {
+			return nil, err
+		}
+	}
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKeyID, kid)
+	}
+
+	if key.alg != "" && key.alg != token.Method.Alg() {
+		return nil, ErrKeyAlgorithm
+	}
+	switch key.key.(type) {
+	case *rsa.PublicKey:
+		_, isRSA := token.Method.(*jwt.SigningMethodRSA)
+		_, isRSAPSS := token.Method.(*jwt.SigningMethodRSAPSS)
+		ok = isRSA || isRSAPSS
+	case *ecdsa.PublicKey:
+		_, ok = token.Method.(*jwt.SigningMethodECDSA)
+	case ed25519.PublicKey:
+		_, ok = token.Method.(*jwt.SigningMethodEd25519)
+	}
+	if !ok {
+		return nil, ErrKeyAlgorithm
+	}
+	return key.key, nil
+}
+
+// Keyfunc adapts Key to jwt.Parse.
+func (j *JWKS) Keyfunc(ctx context.Context) jwt.Keyfunc {
+	return func(token *jwt.Token) (interface{}, error) {
+		return j.Key(ctx, token)
+	}
+}
+
+func (j *JWKS) cachedKey(kid string) (jwksKey, bool) {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	key, ok := j.keys[kid]
+	return key, ok
+}
+
+// refreshFor refreshes the keys to find an unknown kid, unless a refresh waited for loaded it
+// meanwhile or the last one is more recent than the minimum refresh interval.
+func (j *JWKS) refreshFor(ctx context.Context, kid string) (jwksKey, bool, error) {
+	j.refreshMu.Lock()
+	defer j.refreshMu.Unlock()
+
+	if key, ok := j.cachedKey(kid); ok {
+		return key, true, nil
+	}
+	if time.Since(j.lastRefresh) < j.minRefreshInterval {
+		return jwksKey{}, false, nil
+	}
+	if err := j.refresh(ctx); err != nil {
+		return jwksKey{}, false, err
+	}
+	key, ok := j.cachedKey(kid)
+	return key, ok, nil
+}
+
+func encodeSegment(value []byte) string {
+	return base64.RawURLEncoding.EncodeToString(value)
+}
+
+func decodeSegment(value string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(value)
+}
@@ -0,0 +1,122 @@
+package token_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jperdior/chatbot-kit/infrastructure/token"
+	"github.com/jperdior/chatbot-kit/infrastructure/token/jwkstest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJWKS(t *testing.T) {
+	server := jwkstest.NewServer()
+	defer server.Close()
+	for kid, alg := range map[string]string{"rsa": "RS256", "ec": "ES256", "ed": "EdDSA"} {
+		assert.NoError(t, server.GenerateKey(kid, alg))
+	}
+
+	ctx := context.Background()
+	jwks := token.NewJWKSFromURL(server.URL(), token.WithMinRefreshInterval(0))
+	assert.NoError(t, jwks.Refresh(ctx))
+
+	parse := func(kid string) error {
+		signed, err := server.Sign(kid, jwt.MapClaims{"exp": time.Now().Add(time.Minute).Unix()})
+		assert.NoError(t, err)
+		_, err = jwt.Parse(signed, jwks.Keyfunc(ctx))
+		return err
+	}
+
+	t.Run("verifies every supported algorithm", func(t *testing.T) {
+		assert.NoError(t, parse("rsa"))
+		assert.NoError(t, parse("ec"))
+		assert.NoError(t, parse("ed"))
+	})
+
+	t.Run("picks up a rotated key", func(t *testing.T) {
+		assert.NoError(t, server.GenerateKey("rsa-2", "RS256"))
+		assert.NoError(t, parse("rsa-2"))
+	})
+
+	t.Run("rejects a token signed with another algorithm than the key", func(t *testing.T) {
+		signed, err := server.Sign("ec", jwt.MapClaims{})
+		assert.NoError(t, err)
+		parsed, _, err := jwt.NewParser().ParseUnverified(signed, jwt.MapClaims{})
+		assert.NoError(t, err)
+		parsed.Header["kid"] = "rsa"
+
+		_, err = jwks.Key(ctx, parsed)
+		assert.ErrorIs(t, err, token.ErrKeyAlgorithm)
+	})
+
+	t.Run("rejects a removed key", func(t *testing.T) {
+		signed, err := server.Sign("rsa", jwt.MapClaims{})
+		assert.NoError(t, err)
+		server.RemoveKey("rsa")
+		assert.NoError(t, jwks.Refresh(ctx))
+
+		_, err = jwt.Parse(signed, jwks.Keyfunc(ctx))
+		assert.ErrorIs(t, err, token.ErrUnknownKeyID)
+	})
+}
+
+func TestJWKSRefreshForUnknownKeys(t *testing.T) {
+	server := jwkstest.NewServer()
+	defer server.Close()
+	require.NoError(t, server.GenerateKey("rsa", "RS256"))
+	var fetches atomic.Int32
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		token.JWKSHandler(server.KeySet).ServeHTTP(w, r)
+	}))
+	defer endpoint.Close()
+
+	ctx := context.Background()
+	signed, err := server.Sign("rsa", jwt.MapClaims{"exp": time.Now().Add(time.Minute).Unix()})
+	require.NoError(t, err)
+
+	t.Run("Concurrent unknown kids fetch the keys once", func(t *testing.T) {
+		fetches.Store(0)
+		jwks := token.NewJWKSFromURL(endpoint.URL, token.WithMinRefreshInterval(0))
+
+		var wg sync.WaitGroup
+		errs := make([]error, 10)
+		for i := range errs {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, errs[i] = jwt.Parse(signed, jwks.Keyfunc(ctx))
+			}()
+		}
+		wg.Wait()
+
+		for _, err := range errs {
+			assert.NoError(t, err)
+		}
+		assert.Equal(t, int32(1), fetches.Load())
+	})
+
+	t.Run("Unknown kids refresh at most once per minimum interval", func(t *testing.T) {
+		fetches.Store(0)
+		jwks := token.NewJWKSFromURL(endpoint.URL, token.WithMinRefreshInterval(time.Hour))
+		require.NoError(t, jwks.Refresh(ctx))
+		require.NoError(t, server.GenerateKey("rsa-2", "RS256"))
+		rotated, err := server.Sign("rsa-2", jwt.MapClaims{"exp": time.Now().Add(time.Minute).Unix()})
+		require.NoError(t, err)
+
+		_, err = jwt.Parse(rotated, jwks.Keyfunc(ctx))
+		assert.ErrorIs(t, err, token.ErrUnknownKeyID)
+		assert.Equal(t, int32(1), fetches.Load())
+
+		require.NoError(t, jwks.Refresh(ctx))
+		_, err = jwt.Parse(rotated, jwks.Keyfunc(ctx))
+		assert.NoError(t, err)
+	})
+}
@@ -0,0 +1,117 @@
+// Package jwkstest provides a local identity provider stand-in publishing a JWKS document,
+// to test asymmetric token verification offline.
+package jwkstest
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
+	"net/http/httptest"
+	"sort"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jperdior/chatbot-kit/infrastructure/token"
+)
+
+type signingKey struct {
+	method  jwt.SigningMethod
+	private crypto.Signer
+}
+
+// Server serves the public keys of its signing keys at URL and signs tokens with them.
+// Keys can be added and removed at any time to simulate a rotation.
+type Server struct {
+	server *httptest.Server
+	mu     sync.RWMutex
+	keys   map[string]signingKey
+}
+
+func NewServer() *Server {
+	s := &Server{keys: make(map[string]signingKey)}
+	s.server = httptest.NewServer(token.JWKSHandler(s.KeySet))
+	return s
+}
+
+// URL returns the address of the JWKS document.
+func (s *Server) URL() string {
+	return s.server.URL
+}
+
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+// GenerateKey creates and publishes a key for the RS256, ES256 or EdDSA algorithm.
+func (s *Server) GenerateKey(kid, alg string) error {
+	var private crypto.Signer
+	var err error
+	switch alg {
+	case "RS256":
+		private, err = rsa.GenerateKey(rand.Reader, 2048)
+	case "ES256":
+		private, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case "EdDSA":
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return fmt.Errorf("unsupported algorithm %s", alg)
+	}
+	if err != nil {
+		return err
+	}
+	return s.AddKey(kid, alg, private)
+}
+
+// AddKey publishes the public part of a private key.
+func (s *Server) AddKey(kid, alg string, private crypto.Signer) error {
+	method := jwt.GetSigningMethod(alg)
+	if method == nil {
+		return fmt.Errorf("unsupported algorithm %s", alg)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys[kid] = signingKey{method: method, private: private}
+	return nil
+}
+
+// RemoveKey stops publishing a key.
+func (s *Server) RemoveKey(kid string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.keys, kid)
+}
+
+// KeySet returns the JWKS document served.
+func (s *Server) KeySet() token.JSONWebKeySet {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	keySet := token.JSONWebKeySet{Keys: []token.JSONWebKey{}}
+	for kid, key := range s.keys {
+		jwk, err := token.NewJSONWebKey(kid, key.method.Alg(), key.private.Public())
+		if err != nil {
+			continue
+		}
+		keySet.Keys = append(keySet.Keys, jwk)
+	}
+	sort.Slice(keySet.Keys, func(i, j int) bool {
+		return keySet.Keys[i].KeyID < keySet.Keys[j].KeyID
+	})
+	return keySet
+}
+
+// Sign returns a token with the given claims signed by the key kid.
+func (s *Server) Sign(kid string, claims jwt.Claims) (string, error) {
+	s.mu.RLock()
+	key, ok := s.keys[kid]
+	s.mu.RUnlock()
+	if !ok {
+		return "", fmt.Errorf("unknown key %s", kid)
+	}
+	t := jwt.NewWithClaims(key.method, claims)
+	t.Header["kid"] = kid
+	return t.SignedString(key.private)
+}
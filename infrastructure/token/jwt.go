@@ -1,30 +1,372 @@
 package token
 
 import (
-	"github.com/golang-jwt/jwt/v5"
+	"context"
+	"crypto"
+	"errors"
+	"fmt"
+	"strings"
 	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jperdior/chatbot-kit/domain"
+	"github.com/jperdior/chatbot-kit/domain/uuidgen"
 )
 
+// Errors returned by Refresh, to be matched with errors.Is.
+var (
+	ErrInvalidRefreshToken = domain.NewUnauthorizedError("invalid refresh token", "refresh_token.invalid")
+	ErrRefreshTokenReused  = domain.NewUnauthorizedError("refresh token already used", "refresh_token.reused")
+)
+
+func newInvalidRefreshTokenError(cause error) error {
+	err := domain.NewUnauthorizedError(ErrInvalidRefreshToken.Message, ErrInvalidRefreshToken.Key)
+	if cause != nil {
+		return err.WithCause(cause)
+	}
+	return err
+}
+
+// TokenPair is the response of a login or a refresh.
+type TokenPair struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+}
+
+// UserClaims are the user data carried by access tokens, as parsed by the JWT middleware.
+type UserClaims struct {
+	UserID   string
+	Email    string
+	Roles    []string
+	TenantID string
+}
+
+type signingKey struct {
+	kid    string
+	method jwt.SigningMethod
+	key    interface{}
+	public crypto.PublicKey
+}
+
+type generatorOptions struct {
+	issuer          string
+	audience        []string
+	accessTokenTTL  time.Duration
+	refreshTokenTTL time.Duration
+	signingKey      *signingKey
+	refreshStore    RefreshTokenStore
+	revocationStore RevocationStore
+}
+
+type GeneratorOption func(*generatorOptions)
+
+// WithIssuer sets the iss claim, user-service by default.
+func WithIssuer(issuer string) GeneratorOption {
+	return func(o *generatorOptions) {
+		o.issuer = issuer
+	}
+}
+
+// WithAudience sets the aud claim.
+func WithAudience(audience ...string) GeneratorOption {
+	return func(o *generatorOptions) {
+		o.audience = audience
+	}
+}
+
+// WithAccessTokenTTL sets the lifetime of user access tokens, 15 minutes by default.
+func WithAccessTokenTTL(ttl time.Duration) GeneratorOption {
+	return func(o *generatorOptions) {
+		o.accessTokenTTL = ttl
+	}
+}
+
+// WithRefreshTokenTTL sets the lifetime of refresh tokens, 30 days by default.
+func WithRefreshTokenTTL(ttl time.Duration) GeneratorOption {
+	return func(o *generatorOptions) {
+		o.refreshTokenTTL = ttl
+	}
+}
+
+// WithSigningKey signs the tokens with an asymmetric key, RS256, ES256 or EdDSA, instead of the
+// secret key. The kid header lets verifiers pick the key from the JWKS returned by KeySet.
+func WithSigningKey(kid, alg string, key crypto.Signer) GeneratorOption {
+	return func(o *generatorOptions) {
+		o.signingKey = &signingKey{kid: kid, method: jwt.GetSigningMethod(alg), key: key, public: key.Public()}
+	}
+}
+
+// WithRefreshTokenStore enables refresh tokens, the store tracking their rotation.
+func WithRefreshTokenStore(store RefreshTokenStore) GeneratorOption {
+	return func(o *generatorOptions) {
+		o.refreshStore = store
+	}
+}
+
+// WithRevocationStore enables the revocation of the issued tokens.
+func WithRevocationStore(store RevocationStore) GeneratorOption {
+	return func(o *generatorOptions) {
+		o.revocationStore = store
+	}
+}
+
 type JWTTokenGenerator struct {
-	secretKey  string
-	expiration int
+	secretKey       string
+	expiration      int
+	issuer          string
+	audience        []string
+	accessTokenTTL  time.Duration
+	refreshTokenTTL time.Duration
+	signingKey      *signingKey
+	refreshStore    RefreshTokenStore
+	revocationStore RevocationStore
 }
 
-func NewJWTTokenGenerator(secretKey string, expiration int) *JWTTokenGenerator {
-	return &JWTTokenGenerator{secretKey: secretKey, expiration: expiration}
+// NewJWTTokenGenerator returns a generator signing with the HMAC secret key unless an
+// asymmetric key is given. The expiration of client tokens is in days.
+func NewJWTTokenGenerator(secretKey string, expiration int, opts ...GeneratorOption) *JWTTokenGenerator {
+	options := &generatorOptions{
+		issuer:          "user-service",
+		accessTokenTTL:  15 * time.Minute,
+		refreshTokenTTL: 30 * 24 * time.Hour,
+	}
+	for _, opt := range opts {
+		opt(options)
+	}
+	return &JWTTokenGenerator{
+		secretKey:       secretKey,
+		expiration:      expiration,
+		issuer:          options.issuer,
+		audience:        options.audience,
+		accessTokenTTL:  options.accessTokenTTL,
+		refreshTokenTTL: options.refreshTokenTTL,
+		signingKey:      options.signingKey,
+		refreshStore:    options.refreshStore,
+		revocationStore: options.revocationStore,
+	}
 }
 
-// TODO this should be in an sso service and work with secrets
 func (j *JWTTokenGenerator) GenerateClientToken(clientID, clientName string) (string, error) {
+	return j.GenerateTenantClientToken(clientID, clientName, "")
+}
+
+// GenerateTenantClientToken generates a client token scoped to the given tenant.
+func (j *JWTTokenGenerator) GenerateTenantClientToken(clientID, clientName, tenantID string) (string, error) {
+	return j.GenerateScopedClientToken(clientID, clientName, tenantID, nil)
+}
+
+// GenerateScopedClientToken generates a client token granted the given scopes, in the scope claim.
+func (j *JWTTokenGenerator) GenerateScopedClientToken(clientID, clientName, tenantID string, scopes []string) (string, error) {
 	duration := time.Duration(j.expiration) * 24 * time.Hour
+	claims := j.registeredClaims(duration)
+	claims["sub"] = clientID
+	claims["client_id"] = clientID
+	claims["client_name"] = clientName
+	claims["token_type"] = ClientTokenType
+	if tenantID != "" {
+		claims["tenant_id"] = tenantID
+	}
+	if len(scopes) > 0 {
+		claims["scope"] = strings.Join(scopes, " ")
+	}
+	return j.sign(claims)
+}
+
+// GenerateUserToken generates a short-lived user access token.
+func (j *JWTTokenGenerator) GenerateUserToken(user UserClaims) (string, error) {
+	claims := j.registeredClaims(j.accessTokenTTL)
+	claims["sub"] = user.UserID
+	claims["ID"] = user.UserID
+	claims["email"] = user.Email
+	roles := user.Roles
+	if roles == nil {
+		roles = []string{}
+	}
+	claims["roles"] = roles
+	claims["token_type"] = UserTokenType
+	if user.TenantID != "" {
+		claims["tenant_id"] = user.TenantID
+	}
+	return j.sign(claims)
+}
+
+// GenerateUserTokenPair generates an access token and a refresh token starting a new rotation family.
+func (j *JWTTokenGenerator) GenerateUserTokenPair(ctx context.Context, user UserClaims) (*TokenPair, error) {
+	return j.generatePair(ctx, user, uuidgen.New().String())
+}
+
+// Refresh exchanges a refresh token for a new pair. Each refresh token can be used once: using it
+// again means it leaked, so its whole family is revoked and ErrRefreshTokenReused is returned.
+func (j *JWTTokenGenerator) Refresh(ctx context.Context, refreshToken string) (*TokenPair, error) {
+	if j.refreshStore == nil {
+		return nil, errors.New("refresh tokens are not enabled")
+	}
+
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(refreshToken, claims, func(token *jwt.Token) (interface{}, error) {
+		return j.verificationKey(), nil
+	}, jwt.WithValidMethods([]string{j.method().Alg()}), jwt.WithIssuer(j.issuer), jwt.WithExpirationRequired())
+	if err != nil {
+		return nil, newInvalidRefreshTokenError(err)
+	}
+	if tokenType, _ := claims["token_type"].(string); tokenType != RefreshTokenType {
+		return nil, newInvalidRefreshTokenError(nil)
+	}
+	jti, _ := claims["jti"].(string)
+	if j.revocationStore != nil {
+		subject, _ := claims.GetSubject()
+		issuedAt, _ := claims.GetIssuedAt()
+		if issuedAt == nil {
+			return nil, newInvalidRefreshTokenError(nil)
+		}
+		revoked, err := IsTokenRevoked(ctx, j.revocationStore, jti, subject, issuedAt.Time)
+		if err != nil {
+			return nil, err
+		}
+		if revoked {
+			return nil, newInvalidRefreshTokenError(nil)
+		}
+	}
+
+	stored, err := j.refreshStore.Find(ctx, jti)
+	if err != nil {
+		return nil, err
+	}
+	if stored == nil || stored.Revoked {
+		return nil, newInvalidRefreshTokenError(nil)
+	}
+	firstUse, err := j.refreshStore.MarkUsed(ctx, jti)
+	if err != nil {
+		return nil, err
+	}
+	if !firstUse {
+		if err := j.refreshStore.RevokeFamily(ctx, stored.FamilyID); err != nil {
+			return nil, err
+		}
+		return nil, domain.NewUnauthorizedError(ErrRefreshTokenReused.Message, ErrRefreshTokenReused.Key)
+	}
+
+	return j.generatePair(ctx, stored.User, stored.FamilyID)
+}
+
+// Revoke denies a token issued by this generator until it expires, e.g. on logout.
+func (j *JWTTokenGenerator) Revoke(ctx context.Context, tokenString string) error {
+	if j.revocationStore == nil {
+		return errors.New("token revocation is not enabled")
+	}
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return j.verificationKey(), nil
+	}, jwt.WithValidMethods([]string{j.method().Alg()}), jwt.WithExpirationRequired())
+	if err != nil {
+		return err
+	}
+	jti, _ := claims["jti"].(string)
+	if jti == "" {
+		return errors.New("token has no jti claim")
+	}
+	expiresAt, err := claims.GetExpirationTime()
+	if err != nil {
+		return err
+	}
+	return j.revocationStore.Revoke(ctx, jti, expiresAt.Time)
+}
+
+// RevokeSubject denies every token issued until now to a user or a client.
+func (j *JWTTokenGenerator) RevokeSubject(ctx context.Context, subject string) error {
+	if j.revocationStore == nil {
+		return errors.New("token revocation is not enabled")
+	}
+	return j.revocationStore.RevokeIssuedBefore(ctx, subject, time.Now())
+}
+
+// KeySet returns the JWKS document publishing the asymmetric signing key, empty when signing with HMAC.
+func (j *JWTTokenGenerator) KeySet() (JSONWebKeySet, error) {
+	keySet := JSONWebKeySet{Keys: []JSONWebKey{}}
+	if j.signingKey == nil {
+		return keySet, nil
+	}
+	jwk, err := NewJSONWebKey(j.signingKey.kid, j.method().Alg(), j.signingKey.public)
+	if err != nil {
+		return keySet, err
+	}
+	keySet.Keys = append(keySet.Keys, jwk)
+	return keySet, nil
+}
+
+func (j *JWTTokenGenerator) generatePair(ctx context.Context, user UserClaims, familyID string) (*TokenPair, error) {
+	if j.refreshStore == nil {
+		return nil, errors.New("refresh tokens are not enabled")
+	}
+	accessToken, err := j.GenerateUserToken(user)
+	if err != nil {
+		return nil, err
+	}
+
+	stored := RefreshToken{
+		ID:        uuidgen.New().String(),
+		FamilyID:  familyID,
+		User:      user,
+		ExpiresAt: time.Now().Add(j.refreshTokenTTL),
+	}
+	claims := j.registeredClaims(j.refreshTokenTTL)
+	claims["sub"] = user.UserID
+	claims["jti"] = stored.ID
+	claims["token_type"] = RefreshTokenType
+	refreshToken, err := j.sign(claims)
+	if err != nil {
+		return nil, err
+	}
+	if err := j.refreshStore.Save(ctx, stored); err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(j.accessTokenTTL.Seconds()),
+	}, nil
+}
+
+func (j *JWTTokenGenerator) registeredClaims(ttl time.Duration) jwt.MapClaims {
+	now := time.Now()
 	claims := jwt.MapClaims{
-		"client_id":   clientID,
-		"client_name": clientName,
-		"token_type":  "client",
-		"iss":         "user-service",
-		"iat":         time.Now().Unix(),
-		"exp":         time.Now().Add(duration).Unix(),
-	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(j.secretKey))
+		"jti": uuidgen.New().String(),
+		"iss": j.issuer,
+		"iat": now.Unix(),
+		"exp": now.Add(ttl).Unix(),
+	}
+	if len(j.audience) > 0 {
+		claims["aud"] = j.audience
+	}
+	return claims
+}
+
+func (j *JWTTokenGenerator) method() jwt.SigningMethod {
+	if j.signingKey != nil && j.signingKey.method != nil {
+		return j.signingKey.method
+	}
+	return jwt.SigningMethodHS256
+}
+
+func (j *JWTTokenGenerator) verificationKey() interface{} {
+	if j.signingKey != nil {
+		return j.signingKey.public
+	}
+	return []byte(j.secretKey)
+}
+
+func (j *JWTTokenGenerator) sign(claims jwt.MapClaims) (string, error) {
+	if j.signingKey == nil {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(j.secretKey))
+	}
+	if j.signingKey.method == nil {
+		return "", fmt.Errorf("unsupported signing algorithm for key %s", j.signingKey.kid)
+	}
+	token := jwt.NewWithClaims(j.signingKey.method, claims)
+	token.Header["kid"] = j.signingKey.kid
+	return token.SignedString(j.signingKey.key)
 }
@@ -0,0 +1,105 @@
+package token_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	userdomain "github.com/jperdior/chatbot-kit/domain/user"
+	"github.com/jperdior/chatbot-kit/infrastructure/token"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJWTTokenGeneratorRefresh(t *testing.T) {
+	ctx := context.Background()
+	generator := token.NewJWTTokenGenerator("secret", 1,
+		token.WithIssuer("auth-service"),
+		token.WithRefreshTokenStore(token.NewInMemoryRefreshTokenStore()))
+	user := token.UserClaims{UserID: "f47ac10b-58cc-4372-a567-0e02b2c3d479", Email: "jane@example.com", Roles: []string{"ROLE_USER"}}
+
+	pair, err := generator.GenerateUserTokenPair(ctx, user)
+	assert.NoError(t, err)
+
+	rotated, err := generator.Refresh(ctx, pair.RefreshToken)
+	assert.NoError(t, err)
+	assert.NotEqual(t, pair.RefreshToken, rotated.RefreshToken)
+
+	t.Run("reusing a rotated token revokes the family", func(t *testing.T) {
+		_, err := generator.Refresh(ctx, pair.RefreshToken)
+		assert.ErrorIs(t, err, token.ErrRefreshTokenReused)
+
+		_, err = generator.Refresh(ctx, rotated.RefreshToken)
+		assert.ErrorIs(t, err, token.ErrInvalidRefreshToken)
+	})
+
+	t.Run("an access token is not a refresh token", func(t *testing.T) {
+		_, err := generator.Refresh(ctx, pair.AccessToken)
+		assert.ErrorIs(t, err, token.ErrInvalidRefreshToken)
+	})
+}
+
+func TestJWTTokenGeneratorAsymmetricKey(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	generator := token.NewJWTTokenGenerator("", 1, token.WithSigningKey("key-1", "ES256", key), token.WithAudience("chatbot"))
+
+	signed, err := generator.GenerateUserToken(token.UserClaims{UserID: "42", Email: "jane@example.com", Roles: []string{}})
+	assert.NoError(t, err)
+
+	keySet, err := generator.KeySet()
+	assert.NoError(t, err)
+	publicKey, err := keySet.Keys[0].PublicKey()
+	assert.NoError(t, err)
+
+	parsed, err := jwt.Parse(signed, func(*jwt.Token) (interface{}, error) { return publicKey, nil }, jwt.WithAudience("chatbot"))
+	assert.NoError(t, err)
+	assert.Equal(t, "key-1", parsed.Header["kid"])
+	assert.Equal(t, "jane@example.com", parsed.Claims.(jwt.MapClaims)["email"])
+}
+
+func TestJWTTokenGeneratorRevocation(t *testing.T) {
+	ctx := context.Background()
+	store := token.NewInMemoryRevocationStore()
+	generator := token.NewJWTTokenGenerator("secret", 1,
+		token.WithRevocationStore(store),
+		token.WithRefreshTokenStore(token.NewInMemoryRefreshTokenStore()))
+	user := token.UserClaims{UserID: "f47ac10b-58cc-4372-a567-0e02b2c3d479", Email: "jane@example.com"}
+
+	isRevoked := func(signed string) bool {
+		claims := jwt.MapClaims{}
+		_, err := jwt.ParseWithClaims(signed, claims, func(*jwt.Token) (interface{}, error) { return []byte("secret"), nil })
+		assert.NoError(t, err)
+		issuedAt, _ := claims.GetIssuedAt()
+		subject, _ := claims.GetSubject()
+		revoked, err := token.IsTokenRevoked(ctx, store, claims["jti"].(string), subject, issuedAt.Time)
+		assert.NoError(t, err)
+		return revoked
+	}
+
+	t.Run("revokes a single token", func(t *testing.T) {
+		first, err := generator.GenerateUserToken(user)
+		assert.NoError(t, err)
+		second, err := generator.GenerateUserToken(user)
+		assert.NoError(t, err)
+
+		assert.NoError(t, generator.Revoke(ctx, first))
+
+		assert.True(t, isRevoked(first))
+		assert.False(t, isRevoked(second))
+	})
+
+	t.Run("revokes every token of a deleted user", func(t *testing.T) {
+		pair, err := generator.GenerateUserTokenPair(ctx, user)
+		assert.NoError(t, err)
+
+		handler := token.NewRevokeOnUserDeletedHandler(store)
+		assert.NoError(t, handler.Handle(ctx, userdomain.NewUserDeletedEvent(user.UserID)))
+
+		assert.True(t, isRevoked(pair.AccessToken))
+		_, err = generator.Refresh(ctx, pair.RefreshToken)
+		assert.ErrorIs(t, err, token.ErrInvalidRefreshToken)
+	})
+}
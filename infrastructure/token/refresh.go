@@ -0,0 +1,152 @@
+package token
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RefreshToken is the server side state of an issued refresh token. Tokens obtained by rotating
+// each other share the same family.
+type RefreshToken struct {
+	ID        string     `json:"id"`
+	FamilyID  string     `json:"family_id"`
+	User      UserClaims `json:"user"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	Revoked   bool       `json:"-"`
+}
+
+// RefreshTokenStore keeps track of the refresh tokens to detect their reuse.
+type RefreshTokenStore interface {
+	Save(ctx context.Context, token RefreshToken) error
+	// Find returns nil when the token is unknown or expired.
+	Find(ctx context.Context, id string) (*RefreshToken, error)
+	// MarkUsed returns false when the token had already been used.
+	MarkUsed(ctx context.Context, id string) (bool, error)
+	RevokeFamily(ctx context.Context, familyID string) error
+}
+
+type InMemoryRefreshTokenStore struct {
+	mu              sync.Mutex
+	tokens          map[string]RefreshToken
+	used            map[string]bool
+	revokedFamilies map[string]bool
+}
+
+func NewInMemoryRefreshTokenStore() *InMemoryRefreshTokenStore {
+	return &InMemoryRefreshTokenStore{
+		tokens:          make(map[string]RefreshToken),
+		used:            make(map[string]bool),
+		revokedFamilies: make(map[string]bool),
+	}
+}
+
+func (s *InMemoryRefreshTokenStore) Save(_ context.Context, token RefreshToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens[token.ID] = token
+	return nil
+}
+
+func (s *InMemoryRefreshTokenStore) Find(_ context.Context, id string) (*RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	token, ok := s.tokens[id]
+	if !ok || time.Now().After(token.ExpiresAt) {
+		return nil, nil
+	}
+	token.Revoked = s.revokedFamilies[token.FamilyID]
+	return &token, nil
+}
+
+func (s *InMemoryRefreshTokenStore) MarkUsed(_ context.Context, id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.used[id] {
+		return false, nil
+	}
+	s.used[id] = true
+	return true, nil
+}
+
+func (s *InMemoryRefreshTokenStore) RevokeFamily(_ context.Context, familyID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.revokedFamilies[familyID] = true
+	return nil
+}
+
+const (
+	refreshTokenKeyPrefix  = "refresh_token:"
+	refreshFamilyKeyPrefix = "refresh_token_family:"
+	refreshFamilyRevoked   = "revoked"
+)
+
+// RedisRefreshTokenStore stores the refresh tokens until they expire. The state of a family
+// lives as long as its latest token.
+type RedisRefreshTokenStore struct {
+	client *redis.Client
+}
+
+func NewRedisRefreshTokenStore(client *redis.Client) *RedisRefreshTokenStore {
+	return &RedisRefreshTokenStore{client: client}
+}
+
+func (s *RedisRefreshTokenStore) Save(ctx context.Context, token RefreshToken) error {
+	ttl := time.Until(token.ExpiresAt)
+	if ttl <= 0 {
+		return nil
+	}
+	content, err := json.Marshal(token)
+	if err != nil {
+		return err
+	}
+	familyKey := refreshFamilyKeyPrefix + token.FamilyID
+	pipe := s.client.TxPipeline()
+	pipe.Set(ctx, refreshTokenKeyPrefix+token.ID, content, ttl)
+	// Extends the family without reactivating it when it was revoked meanwhile.
+	pipe.SetNX(ctx, familyKey, "active", ttl)
+	pipe.Expire(ctx, familyKey, ttl)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+func (s *RedisRefreshTokenStore) Find(ctx context.Context, id string) (*RefreshToken, error) {
+	content, err := s.client.Get(ctx, refreshTokenKeyPrefix+id).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var token RefreshToken
+	if err := json.Unmarshal(content, &token); err != nil {
+		return nil, err
+	}
+
+	state, err := s.client.Get(ctx, refreshFamilyKeyPrefix+token.FamilyID).Result()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return nil, err
+	}
+	token.Revoked = state == refreshFamilyRevoked
+	return &token, nil
+}
+
+func (s *RedisRefreshTokenStore) MarkUsed(ctx context.Context, id string) (bool, error) {
+	ttl, err := s.client.TTL(ctx, refreshTokenKeyPrefix+id).Result()
+	if err != nil {
+		return false, err
+	}
+	if ttl <= 0 {
+		ttl = time.Minute
+	}
+	return s.client.SetNX(ctx, refreshTokenKeyPrefix+id+":used", "1", ttl).Result()
+}
+
+func (s *RedisRefreshTokenStore) RevokeFamily(ctx context.Context, familyID string) error {
+	return s.client.SetArgs(ctx, refreshFamilyKeyPrefix+familyID, refreshFamilyRevoked, redis.SetArgs{KeepTTL: true}).Err()
+}
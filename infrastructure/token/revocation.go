@@ -0,0 +1,171 @@
+package token
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jperdior/chatbot-kit/application/event"
+	"github.com/jperdior/chatbot-kit/domain/user"
+	"github.com/redis/go-redis/v9"
+)
+
+// RevocationStore is a denylist of tokens. Single tokens are revoked by their jti claim and all
+// the tokens of a subject, a user or a client, by a "tokens issued before" watermark.
+type RevocationStore interface {
+	// Revoke denies the token until it expires.
+	Revoke(ctx context.Context, jti string, expiresAt time.Time) error
+	IsRevoked(ctx context.Context, jti string) (bool, error)
+	// RevokeIssuedBefore denies the tokens of the subject issued up to the given time.
+	RevokeIssuedBefore(ctx context.Context, subject string, before time.Time) error
+	// IssuedBefore returns the watermark of the subject, zero when none.
+	IssuedBefore(ctx context.Context, subject string) (time.Time, error)
+}
+
+// IsTokenRevoked checks both the jti and the watermark of the subject of a token.
+func IsTokenRevoked(ctx context.Context, store RevocationStore, jti, subject string, issuedAt time.Time) (bool, error) {
+	if jti != "" {
+		revoked, err := store.IsRevoked(ctx, jti)
+		if err != nil || revoked {
+			return revoked, err
+		}
+	}
+	if subject == "" {
+		return false, nil
+	}
+	watermark, err := store.IssuedBefore(ctx, subject)
+	if err != nil || watermark.IsZero() {
+		return false, err
+	}
+	// iat has a precision of a second
+	return !issuedAt.After(watermark.Truncate(time.Second)), nil
+}
+
+type InMemoryRevocationStore struct {
+	mu         sync.RWMutex
+	tokens     map[string]time.Time
+	watermarks map[string]time.Time
+}
+
+func NewInMemoryRevocationStore() *InMemoryRevocationStore {
+	return &InMemoryRevocationStore{
+		tokens:     make(map[string]time.Time),
+		watermarks: make(map[string]time.Time),
+	}
+}
+
+func (s *InMemoryRevocationStore) Revoke(_ context.Context, jti string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for id, expiration := range s.tokens {
+		if now.After(expiration) {
+			delete(s.tokens, id)
+		}
+	}
+	s.tokens[jti] = expiresAt
+	return nil
+}
+
+func (s *InMemoryRevocationStore) IsRevoked(_ context.Context, jti string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	expiresAt, ok := s.tokens[jti]
+	return ok && time.Now().Before(expiresAt), nil
+}
+
+func (s *InMemoryRevocationStore) RevokeIssuedBefore(_ context.Context, subject string, before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if before.After(s.watermarks[subject]) {
+		s.watermarks[subject] = before
+	}
+	return nil
+}
+
+func (s *InMemoryRevocationStore) IssuedBefore(_ context.Context, subject string) (time.Time, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.watermarks[subject], nil
+}
+
+const (
+	revokedTokenKeyPrefix   = "revoked_token:"
+	revokedSubjectKeyPrefix = "revoked_subject:"
+)
+
+// RedisRevocationStore keeps revoked tokens until they expire and watermarks for watermarkTTL,
+// which must exceed the lifetime of the longest-lived token.
+type RedisRevocationStore struct {
+	client       *redis.Client
+	watermarkTTL time.Duration
+}
+
+func NewRedisRevocationStore(client *redis.Client, watermarkTTL time.Duration) *RedisRevocationStore {
+	return &RedisRevocationStore{client: client, watermarkTTL: watermarkTTL}
+}
+
+func (s *RedisRevocationStore) Revoke(ctx context.Context, jti string, expiresAt time.Time) error {
+	ttl := time.Until(expiresAt)
+	if ttl <= 0 {
+		return nil
+	}
+	return s.client.Set(ctx, revokedTokenKeyPrefix+jti, "1", ttl).Err()
+}
+
+func (s *RedisRevocationStore) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	count, err := s.client.Exists(ctx, revokedTokenKeyPrefix+jti).Result()
+	return count > 0, err
+}
+
+// raiseWatermarkScript sets the watermark only when it is later than the current one. The
+// nanoseconds are compared as decimal strings since Lua numbers cannot hold them exactly.
+var raiseWatermarkScript = redis.NewScript(`
+local current = redis.call("GET", KEYS[1])
+if current and (#current > #ARGV[1] or (#current == #ARGV[1] and current >= ARGV[1])) then
+	return 0
+end
+if tonumber(ARGV[2]) > 0 then
+	redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[2])
+else
+	redis.call("SET", KEYS[1], ARGV[1])
+end
+return 1
+`)
+
+func (s *RedisRevocationStore) RevokeIssuedBefore(ctx context.Context, subject string, before time.Time) error {
+	key := revokedSubjectKeyPrefix + subject
+	value := strconv.FormatInt(before.UnixNano(), 10)
+	return raiseWatermarkScript.Run(ctx, s.client, []string{key}, value, s.watermarkTTL.Milliseconds()).Err()
+}
+
+func (s *RedisRevocationStore) IssuedBefore(ctx context.Context, subject string) (time.Time, error) {
+	value, err := s.client.Get(ctx, revokedSubjectKeyPrefix+subject).Int64()
+	if errors.Is(err, redis.Nil) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(0, value), nil
+}
+
+// RevokeOnUserDeletedHandler revokes every token issued to a user when it is deleted.
+type RevokeOnUserDeletedHandler struct {
+	store RevocationStore
+}
+
+func NewRevokeOnUserDeletedHandler(store RevocationStore) *RevokeOnUserDeletedHandler {
+	return &RevokeOnUserDeletedHandler{store: store}
+}
+
+// Handle implements the event.Handler interface for user.UserDeletedType events.
+func (h *RevokeOnUserDeletedHandler) Handle(ctx context.Context, evt event.Event) error {
+	deleted, ok := evt.(*user.UserDeletedEvent)
+	if !ok {
+		return nil
+	}
+	return h.store.RevokeIssuedBefore(ctx, deleted.GetAggregateID(), time.Now())
+}
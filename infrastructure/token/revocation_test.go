@@ -0,0 +1,113 @@
+package token_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/jperdior/chatbot-kit/infrastructure/token"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestRedisRevocationStore(t *testing.T, watermarkTTL time.Duration) (*token.RedisRevocationStore, *miniredis.Miniredis) {
+	t.Helper()
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+	return token.NewRedisRevocationStore(client, watermarkTTL), server
+}
+
+func TestRevocationStores(t *testing.T) {
+	stores := map[string]func(t *testing.T) token.RevocationStore{
+		"In memory": func(*testing.T) token.RevocationStore { return token.NewInMemoryRevocationStore() },
+		"Redis": func(t *testing.T) token.RevocationStore {
+			store, _ := newTestRedisRevocationStore(t, time.Hour)
+			return store
+		},
+	}
+
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			t.Run("Tokens are revoked until they expire", func(t *testing.T) {
+				store := newStore(t)
+
+				require.NoError(t, store.Revoke(ctx, "revoked", time.Now().Add(time.Hour)))
+				require.NoError(t, store.Revoke(ctx, "expired", time.Now().Add(-time.Second)))
+
+				revoked, err := store.IsRevoked(ctx, "revoked")
+				require.NoError(t, err)
+				assert.True(t, revoked)
+				revoked, err = store.IsRevoked(ctx, "expired")
+				require.NoError(t, err)
+				assert.False(t, revoked)
+			})
+
+			t.Run("Subjects have no watermark until revoked", func(t *testing.T) {
+				watermark, err := newStore(t).IssuedBefore(ctx, "user-1")
+
+				require.NoError(t, err)
+				assert.True(t, watermark.IsZero())
+			})
+
+			t.Run("Watermarks only move forward", func(t *testing.T) {
+				store := newStore(t)
+				later := time.Unix(0, 1_700_000_000_123_456_789)
+
+				require.NoError(t, store.RevokeIssuedBefore(ctx, "user-1", later))
+				require.NoError(t, store.RevokeIssuedBefore(ctx, "user-1", later.Add(-time.Nanosecond)))
+
+				watermark, err := store.IssuedBefore(ctx, "user-1")
+				require.NoError(t, err)
+				assert.True(t, later.Equal(watermark), "watermark %v", watermark)
+
+				require.NoError(t, store.RevokeIssuedBefore(ctx, "user-1", later.Add(time.Nanosecond)))
+				watermark, err = store.IssuedBefore(ctx, "user-1")
+				require.NoError(t, err)
+				assert.True(t, later.Add(time.Nanosecond).Equal(watermark), "watermark %v", watermark)
+			})
+
+			t.Run("Concurrent revocations keep the latest watermark", func(t *testing.T) {
+				store := newStore(t)
+				base := time.Now()
+				var wg sync.WaitGroup
+				for i := 0; i < 50; i++ {
+					wg.Add(1)
+					go func(i int) {
+						defer wg.Done()
+						assert.NoError(t, store.RevokeIssuedBefore(ctx, "user-1", base.Add(time.Duration(i)*time.Second)))
+					}(i)
+				}
+				wg.Wait()
+
+				watermark, err := store.IssuedBefore(ctx, "user-1")
+				require.NoError(t, err)
+				assert.True(t, base.Add(49*time.Second).Equal(watermark), "watermark %v", watermark)
+			})
+		})
+	}
+}
+
+func TestRedisRevocationStoreWatermarkTTL(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Watermarks expire after their TTL", func(t *testing.T) {
+		store, server := newTestRedisRevocationStore(t, time.Hour)
+		require.NoError(t, store.RevokeIssuedBefore(ctx, "user-1", time.Now()))
+
+		assert.Equal(t, time.Hour, server.TTL("revoked_subject:user-1"))
+	})
+
+	t.Run("Watermarks without a TTL do not expire", func(t *testing.T) {
+		store, server := newTestRedisRevocationStore(t, 0)
+		require.NoError(t, store.RevokeIssuedBefore(ctx, "user-1", time.Now()))
+
+		assert.True(t, server.Exists("revoked_subject:user-1"))
+		assert.Zero(t, server.TTL("revoked_subject:user-1"))
+	})
+}
@@ -0,0 +1,228 @@
+package token
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jperdior/chatbot-kit/application/auth"
+	"github.com/jperdior/chatbot-kit/domain"
+	userdomain "github.com/jperdior/chatbot-kit/domain/user"
+)
+
+var (
+	hmacMethods       = []string{"HS256", "HS384", "HS512"}
+	asymmetricMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}
+)
+
+// Errors returned by Verifier, to be matched with errors.Is.
+var (
+	ErrInvalidToken          = domain.NewUnauthorizedError("Invalid token", "token.invalid")
+	ErrMissingClaim          = domain.NewUnauthorizedError("Missing token claim", "token.claim_missing")
+	ErrInvalidIssuer         = domain.NewUnauthorizedError("Invalid token issuer", "token.issuer_invalid")
+	ErrInvalidAudience       = domain.NewUnauthorizedError("Invalid token audience", "token.audience_invalid")
+	ErrRevocationUnavailable = domain.NewUnavailableError("Token revocation cannot be checked", "token.revocation_unavailable")
+	ErrTokenRevoked          = domain.NewUnauthorizedError("Token has been revoked", "token.revoked")
+	ErrInvalidUserID         = domain.NewUnauthorizedError("Invalid user ID", "token.user_id_invalid")
+	ErrInvalidEmail          = domain.NewUnauthorizedError("Invalid user email", "token.email_invalid")
+	ErrInvalidRoles          = domain.NewUnauthorizedError("Invalid user roles", "token.roles_invalid")
+	ErrInvalidClientID       = domain.NewUnauthorizedError("Invalid client ID", "token.client_id_invalid")
+	ErrUnknownTokenType      = domain.NewUnauthorizedError("Unknown token type", "token.type_unknown")
+)
+
+type verifierOptions struct {
+	jwks            *JWKS
+	revocationStore RevocationStore
+	issuers         []string
+	audiences       []string
+	leeway          time.Duration
+	requiredClaims  []string
+	permissions     auth.PermissionResolver
+}
+
+type VerifierOption func(*verifierOptions)
+
+// WithJWKS verifies asymmetrically signed tokens with the keys of a JWKS document.
+func WithJWKS(jwks *JWKS) VerifierOption {
+	return func(o *verifierOptions) {
+		o.jwks = jwks
+	}
+}
+
+// WithRevocationCheck rejects the tokens revoked by their jti or by the watermark of their subject.
+func WithRevocationCheck(store RevocationStore) VerifierOption {
+	return func(o *verifierOptions) {
+		o.revocationStore = store
+	}
+}
+
+// WithAcceptedIssuers only accepts the tokens whose iss claim is one of the given issuers.
+func WithAcceptedIssuers(issuers ...string) VerifierOption {
+	return func(o *verifierOptions) {
+		o.issuers = issuers
+	}
+}
+
+// WithAcceptedAudiences only accepts the tokens whose aud claim contains one of the given audiences.
+func WithAcceptedAudiences(audiences ...string) VerifierOption {
+	return func(o *verifierOptions) {
+		o.audiences = audiences
+	}
+}
+
+// WithLeeway tolerates the given clock skew when validating exp, nbf and iat.
+func WithLeeway(leeway time.Duration) VerifierOption {
+	return func(o *verifierOptions) {
+		o.leeway = leeway
+	}
+}
+
+// WithRequiredClaims rejects the tokens missing any of the named claims, such as exp or jti.
+func WithRequiredClaims(claims ...string) VerifierOption {
+	return func(o *verifierOptions) {
+		o.requiredClaims = claims
+	}
+}
+
+// WithPermissionResolver resolves the permissions of the roles of the users and of the scopes of
+// the clients, e.g. with an auth.RBAC. Without it no permission is granted.
+func WithPermissionResolver(resolver auth.PermissionResolver) VerifierOption {
+	return func(o *verifierOptions) {
+		o.permissions = resolver
+	}
+}
+
+// Verifier verifies the access tokens issued by JWTTokenGenerator and builds their security
+// context. Tokens signed with HMAC are verified with the secret key, an empty one rejecting them,
+// and tokens signed with RS256, ES256 or EdDSA against the JWKS given with WithJWKS.
+type Verifier struct {
+	secretKey    []byte
+	validMethods []string
+	options      verifierOptions
+}
+
+func NewVerifier(secretKey string, opts ...VerifierOption) *Verifier {
+	verifier := &Verifier{}
+	for _, opt := range opts {
+		opt(&verifier.options)
+	}
+	if secretKey != "" {
+		verifier.secretKey = []byte(secretKey)
+		verifier.validMethods = append(verifier.validMethods, hmacMethods...)
+	}
+	if verifier.options.jwks != nil {
+		verifier.validMethods = append(verifier.validMethods, asymmetricMethods...)
+	}
+	return verifier
+}
+
+// Verify implements the auth.TokenVerifier interface.
+func (v *Verifier) Verify(ctx context.Context, token string, at time.Time) (auth.SecurityContext, error) {
+	_, securityContext, err := v.VerifyClaims(ctx, token, at)
+	return securityContext, err
+}
+
+// VerifyClaims verifies the token as of the given time, validating exp, nbf and iat against it,
+// and returns its claims with the security context of its user or client. The errors are domain
+// errors, unavailable when the revocation cannot be checked and unauthorized otherwise.
+func (v *Verifier) VerifyClaims(ctx context.Context, token string, at time.Time) (*Claims, auth.SecurityContext, error) {
+	// Malformed claims fail the decoding.
+	claims := &Claims{}
+	parsed, err := jwt.ParseWithClaims(token, claims, v.keyfunc(ctx), jwt.WithValidMethods(v.validMethods),
+		jwt.WithLeeway(v.options.leeway), jwt.WithIssuedAt(), jwt.WithTimeFunc(func() time.Time { return at }))
+	if err != nil || !parsed.Valid {
+		return nil, nil, ErrInvalidToken.WithCause(err)
+	}
+	if err := v.validateClaims(claims); err != nil {
+		return nil, nil, err
+	}
+	if err := v.checkRevocation(ctx, claims); err != nil {
+		return nil, nil, err
+	}
+	securityContext, err := v.securityContext(claims)
+	if err != nil {
+		return nil, nil, err
+	}
+	return claims, securityContext, nil
+}
+
+func (v *Verifier) keyfunc(ctx context.Context) jwt.Keyfunc {
+	return func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); ok && v.secretKey != nil {
+			return v.secretKey, nil
+		}
+		if v.options.jwks == nil {
+			return nil, jwt.ErrSignatureInvalid
+		}
+		return v.options.jwks.Key(ctx, token)
+	}
+}
+
+// validateClaims checks the claims the jwt parser does not.
+func (v *Verifier) validateClaims(claims *Claims) error {
+	for _, name := range v.options.requiredClaims {
+		if !claims.Has(name) {
+			return ErrMissingClaim.WithParam("claim", name)
+		}
+	}
+	if len(v.options.issuers) > 0 && !slices.Contains(v.options.issuers, claims.Issuer) {
+		return ErrInvalidIssuer
+	}
+	if len(v.options.audiences) > 0 && !slices.ContainsFunc(v.options.audiences, func(audience string) bool {
+		return slices.Contains(claims.Audience, audience)
+	}) {
+		return ErrInvalidAudience
+	}
+	return nil
+}
+
+func (v *Verifier) checkRevocation(ctx context.Context, claims *Claims) error {
+	if v.options.revocationStore == nil {
+		return nil
+	}
+	var issuedAt time.Time
+	if claims.IssuedAt != nil {
+		issuedAt = claims.IssuedAt.Time
+	}
+	revoked, err := IsTokenRevoked(ctx, v.options.revocationStore, claims.ID, claims.SubjectID(), issuedAt)
+	if err != nil {
+		return ErrRevocationUnavailable.WithCause(err)
+	}
+	if revoked {
+		return ErrTokenRevoked
+	}
+	return nil
+}
+
+func (v *Verifier) securityContext(claims *Claims) (auth.SecurityContext, error) {
+	switch claims.TokenType {
+	case UserTokenType:
+		userID, err := userdomain.NewUserID(claims.UserID)
+		if err != nil {
+			return nil, ErrInvalidUserID
+		}
+		if claims.Email == "" {
+			return nil, ErrInvalidEmail
+		}
+		if claims.Roles == nil {
+			return nil, ErrInvalidRoles
+		}
+		securityContext := auth.NewUserSecurityContext(userID, claims.Email, claims.Roles)
+		securityContext.TenantID = claims.TenantID
+		securityContext.Scopes = claims.Scopes()
+		securityContext.Permissions = v.options.permissions
+		return securityContext, nil
+	case ClientTokenType:
+		if claims.ClientID == "" {
+			return nil, ErrInvalidClientID
+		}
+		securityContext := auth.NewClientSecurityContext(claims.ClientID, claims.ClientName)
+		securityContext.TenantID = claims.TenantID
+		securityContext.Scopes = claims.Scopes()
+		securityContext.Permissions = v.options.permissions
+		return securityContext, nil
+	default:
+		return nil, ErrUnknownTokenType
+	}
+}
@@ -0,0 +1,102 @@
+package token_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jperdior/chatbot-kit/application/auth"
+	"github.com/jperdior/chatbot-kit/domain"
+	"github.com/jperdior/chatbot-kit/infrastructure/token"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// unavailableRevocationStore cannot tell whether a token is revoked.
+type unavailableRevocationStore struct {
+	token.RevocationStore
+}
+
+func (unavailableRevocationStore) IsRevoked(context.Context, string) (bool, error) {
+	return false, errors.New("connection refused")
+}
+
+func signVerifierToken(t *testing.T, claims jwt.MapClaims) string {
+	t.Helper()
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("secret"))
+	require.NoError(t, err)
+	return signed
+}
+
+func TestVerifier(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	var _ auth.TokenVerifier = token.NewVerifier("secret")
+
+	t.Run("Tokens issued by the generator are verified", func(t *testing.T) {
+		rbac, err := auth.NewRBAC([]auth.Role{{Name: "ROLE_USER", Permissions: []string{"chats:read"}}})
+		require.NoError(t, err)
+		generator := token.NewJWTTokenGenerator("secret", 1, token.WithIssuer("auth-service"))
+		signed, err := generator.GenerateUserToken(token.UserClaims{
+			UserID: "f47ac10b-58cc-4372-a567-0e02b2c3d479", Email: "jane@example.com", Roles: []string{"ROLE_USER"}, TenantID: "acme",
+		})
+		require.NoError(t, err)
+		verifier := token.NewVerifier("secret", token.WithAcceptedIssuers("auth-service"), token.WithPermissionResolver(rbac))
+
+		claims, securityContext, err := verifier.VerifyClaims(ctx, signed, now)
+
+		require.NoError(t, err)
+		assert.Equal(t, "jane@example.com", claims.Email)
+		assert.Equal(t, "f47ac10b-58cc-4372-a567-0e02b2c3d479", securityContext.GetIdentifier())
+		assert.Equal(t, "acme", securityContext.GetTenantID())
+		assert.True(t, securityContext.Can("chats:read"))
+	})
+
+	t.Run("Tokens are verified as of the given time", func(t *testing.T) {
+		signed := signVerifierToken(t, jwt.MapClaims{
+			"token_type": "client",
+			"client_id":  "crm",
+			"iat":        now.Add(-time.Hour).Unix(),
+			"nbf":        now.Add(-time.Hour).Unix(),
+			"exp":        now.Add(-time.Minute).Unix(),
+		})
+		verifier := token.NewVerifier("secret")
+
+		_, err := verifier.Verify(ctx, signed, now)
+		assert.ErrorIs(t, err, token.ErrInvalidToken)
+
+		securityContext, err := verifier.Verify(ctx, signed, now.Add(-2*time.Minute))
+		require.NoError(t, err)
+		assert.Equal(t, "crm", securityContext.GetIdentifier())
+
+		_, err = verifier.Verify(ctx, signed, now.Add(-2*time.Hour))
+		assert.ErrorIs(t, err, token.ErrInvalidToken, "the token was not valid yet")
+	})
+
+	t.Run("Errors are domain errors", func(t *testing.T) {
+		valid := jwt.MapClaims{"token_type": "client", "client_id": "crm", "exp": now.Add(time.Hour).Unix()}
+		tests := []struct {
+			name     string
+			verifier *token.Verifier
+			token    string
+			expected error
+			category error
+		}{
+			{"Invalid signatures", token.NewVerifier("another secret"), signVerifierToken(t, valid), token.ErrInvalidToken, domain.ErrUnauthorized},
+			{"Missing claims", token.NewVerifier("secret", token.WithRequiredClaims("jti")), signVerifierToken(t, valid), token.ErrMissingClaim, domain.ErrUnauthorized},
+			{"Unknown token types", token.NewVerifier("secret"), signVerifierToken(t, jwt.MapClaims{"token_type": "refresh"}), token.ErrUnknownTokenType, domain.ErrUnauthorized},
+			{"Unavailable revocation stores", token.NewVerifier("secret", token.WithRevocationCheck(unavailableRevocationStore{})), signVerifierToken(t, jwt.MapClaims{"token_type": "client", "client_id": "crm", "jti": "1"}), token.ErrRevocationUnavailable, domain.ErrUnavailable},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				_, err := tt.verifier.Verify(ctx, tt.token, now)
+
+				assert.ErrorIs(t, err, tt.expected)
+				assert.ErrorIs(t, err, tt.category)
+			})
+		}
+	})
+}
@@ -0,0 +1,63 @@
+// Package grpcerr maps errors to gRPC statuses, keeping the grpc dependency out of the HTTP
+// presentation package.
+package grpcerr
+
+import (
+	"errors"
+
+	"github.com/jperdior/chatbot-kit/domain"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Code returns the gRPC status code matching the category of a domain error, OK for a nil
+// error and Internal for any other error. Conflicts map to Aborted, the code gRPC recommends
+// for concurrency conflicts the client can retry at a higher level.
+func Code(err error) codes.Code {
+	if err == nil {
+		return codes.OK
+	}
+	var domainErr *domain.DomainError
+	if !errors.As(err, &domainErr) {
+		return codes.Internal
+	}
+	switch domainErr.Category {
+	case domain.CategoryValidation:
+		return codes.InvalidArgument
+	case domain.CategoryNotFound:
+		return codes.NotFound
+	case domain.CategoryConflict:
+		return codes.Aborted
+	case domain.CategoryUnauthorized:
+		return codes.Unauthenticated
+	case domain.CategoryForbidden:
+		return codes.PermissionDenied
+	case domain.CategoryUnavailable:
+		return codes.Unavailable
+	default:
+		return codes.Internal
+	}
+}
+
+// Status converts an error into a gRPC status for the handlers of a gRPC server. Like
+// presentation.NewProblemDetailsFromError, it only exposes the message of domain errors other
+// than internal ones, whose key is the reason of an ErrorInfo detail.
+func Status(err error) *status.Status {
+	code := Code(err)
+	var domainErr *domain.DomainError
+	if code == codes.OK || !errors.As(err, &domainErr) {
+		return status.New(code, code.String())
+	}
+	if code != codes.Internal {
+		return status.New(code, domainErr.Message)
+	}
+	st := status.New(code, code.String())
+	if domainErr.Key == "" {
+		return st
+	}
+	if detailed, err := st.WithDetails(&errdetails.ErrorInfo{Reason: domainErr.Key}); err == nil {
+		return detailed
+	}
+	return st
+}
@@ -0,0 +1,62 @@
+package grpcerr
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/jperdior/chatbot-kit/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+)
+
+func TestCode(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected codes.Code
+	}{
+		{"No error", nil, codes.OK},
+		{"Validation errors", domain.NewValidationError("invalid", "request.invalid"), codes.InvalidArgument},
+		{"Not found errors", domain.NewNotFoundError("chat", "42"), codes.NotFound},
+		{"Conflicts", domain.NewConcurrencyConflictError("chat", "42", 1), codes.Aborted},
+		{"Unauthorized errors", domain.NewUnauthorizedError("no token", "authentication.required"), codes.Unauthenticated},
+		{"Forbidden errors", domain.ErrForbidden, codes.PermissionDenied},
+		{"Unavailable errors", domain.ErrUnavailable, codes.Unavailable},
+		{"Wrapped domain errors", fmt.Errorf("finding: %w", domain.NewNotFoundError("chat", "42")), codes.NotFound},
+		{"Other errors", errors.New("boom"), codes.Internal},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, Code(tt.err))
+		})
+	}
+}
+
+func TestStatus(t *testing.T) {
+	t.Run("Domain errors expose their message", func(t *testing.T) {
+		st := Status(domain.NewNotFoundError("chat", "42"))
+
+		assert.Equal(t, codes.NotFound, st.Code())
+		assert.Equal(t, "chat with ID 42 not found", st.Message())
+	})
+
+	t.Run("Internal errors only expose their key", func(t *testing.T) {
+		st := Status(domain.NewInternalError("specification cannot be converted", "specification.not_convertible"))
+
+		assert.Equal(t, codes.Internal, st.Code())
+		assert.Equal(t, codes.Internal.String(), st.Message())
+		require.Len(t, st.Details(), 1)
+		assert.Equal(t, "specification.not_convertible", st.Details()[0].(*errdetails.ErrorInfo).Reason)
+	})
+
+	t.Run("Other errors do not expose their message", func(t *testing.T) {
+		st := Status(errors.New("connection refused to 10.0.0.3"))
+
+		assert.Equal(t, codes.Internal, st.Code())
+		assert.Equal(t, codes.Internal.String(), st.Message())
+	})
+}
@@ -1,10 +1,42 @@
 package presentation
 
 // PaginationDTO represents the pagination metadata and the results
-type PaginationDTO struct {
-	Page       int         `json:"page"`
-	PageSize   int         `json:"pageSize"`
-	TotalRows  int64       `json:"totalRows"`
-	TotalPages int         `json:"totalPages"`
-	Data       interface{} `json:"data"`
+type PaginationDTO[T any] struct {
+	Page       int   `json:"page"`
+	PageSize   int   `json:"pageSize"`
+	TotalRows  int64 `json:"totalRows"`
+	TotalPages int   `json:"totalPages"`
+	HasNext    bool  `json:"hasNext"`
+	Data       []T   `json:"data"`
+}
+
+// NewPaginationDTO builds a PaginationDTO computing the total pages from the total rows.
+// A negative totalRows means the count is unknown and is propagated to TotalPages, HasNext then
+// being left to the caller.
+func NewPaginationDTO[T any](data []T, page, pageSize int, totalRows int64) *PaginationDTO[T] {
+	if data == nil {
+		data = []T{}
+	}
+	pages := totalPages(totalRows, pageSize)
+	return &PaginationDTO[T]{
+		Page:       page,
+		PageSize:   pageSize,
+		TotalRows:  totalRows,
+		TotalPages: pages,
+		HasNext:    page < pages,
+		Data:       data,
+	}
+}
+
+func totalPages(totalRows int64, pageSize int) int {
+	if totalRows < 0 {
+		return -1
+	}
+	if pageSize <= 0 {
+		if totalRows == 0 {
+			return 0
+		}
+		return 1
+	}
+	return int((totalRows + int64(pageSize) - 1) / int64(pageSize))
 }
@@ -0,0 +1,211 @@
+package presentation
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/jperdior/chatbot-kit/application/correlation"
+	"github.com/jperdior/chatbot-kit/application/i18n"
+	"github.com/jperdior/chatbot-kit/domain"
+)
+
+const ProblemContentType = "application/problem+json"
+
+// ProblemDetails is an RFC 7807 problem document. Key, CorrelationID, Errors and Extensions
+// are serialized as extension members.
+type ProblemDetails struct {
+	Type          string              `json:"type"`
+	Title         string              `json:"title"`
+	Status        int                 `json:"status"`
+	Detail        string              `json:"detail,omitempty"`
+	Instance      string              `json:"instance,omitempty"`
+	Key           string              `json:"key,omitempty"`
+	CorrelationID string              `json:"correlation_id,omitempty"`
+	Errors        []domain.FieldError `json:"errors,omitempty"`
+	Extensions    map[string]any      `json:"-"`
+	// params are interpolated in the localized message of Key.
+	params map[string]any
+}
+
+var (
+	messageCatalogMu sync.RWMutex
+	messageCatalog   *i18n.Catalog
+)
+
+// SetMessageCatalog enables the localization of the problem details, nil disables it.
+func SetMessageCatalog(catalog *i18n.Catalog) {
+	messageCatalogMu.Lock()
+	defer messageCatalogMu.Unlock()
+	messageCatalog = catalog
+}
+
+func currentMessageCatalog() *i18n.Catalog {
+	messageCatalogMu.RLock()
+	defer messageCatalogMu.RUnlock()
+	return messageCatalog
+}
+
+func NewProblemDetails(status int, detail string) *ProblemDetails {
+	return &ProblemDetails{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+	}
+}
+
+// WithKey sets the catalog key localizing the detail and the parameters of its message.
+func (p *ProblemDetails) WithKey(key string, params map[string]any) *ProblemDetails {
+	p.Key = key
+	p.params = params
+	return p
+}
+
+// WithExtension adds a custom member to the problem document.
+func (p *ProblemDetails) WithExtension(name string, value any) *ProblemDetails {
+	if p.Extensions == nil {
+		p.Extensions = make(map[string]any)
+	}
+	p.Extensions[name] = value
+	return p
+}
+
+// MarshalJSON writes the extensions next to the standard members, which take precedence.
+func (p ProblemDetails) MarshalJSON() ([]byte, error) {
+	type problem ProblemDetails
+	standard, err := json.Marshal(problem(p))
+	if err != nil || len(p.Extensions) == 0 {
+		return standard, err
+	}
+
+	members := make(map[string]any, len(p.Extensions))
+	for name, value := range p.Extensions {
+		members[name] = value
+	}
+	var standardMembers map[string]any
+	if err := json.Unmarshal(standard, &standardMembers); err != nil {
+		return nil, err
+	}
+	for name, value := range standardMembers {
+		members[name] = value
+	}
+	return json.Marshal(members)
+}
+
+// HTTPStatus returns the HTTP status code matching the category of a domain error,
+// 400 for request validation errors and 500 for any other error.
+func HTTPStatus(err error) int {
+	var validationErrs validator.ValidationErrors
+	if errors.As(err, &validationErrs) {
+		return http.StatusBadRequest
+	}
+	var domainErr *domain.DomainError
+	if !errors.As(err, &domainErr) {
+		return http.StatusInternalServerError
+	}
+	switch domainErr.Category {
+	case domain.CategoryValidation:
+		return http.StatusBadRequest
+	case domain.CategoryNotFound:
+		return http.StatusNotFound
+	case domain.CategoryConflict:
+		return http.StatusConflict
+	case domain.CategoryUnauthorized:
+		return http.StatusUnauthorized
+	case domain.CategoryForbidden:
+		return http.StatusForbidden
+	case domain.CategoryUnavailable:
+		return http.StatusServiceUnavailable
+	case domain.CategoryInternal:
+		return http.StatusInternalServerError
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// NewProblemDetailsFromError converts domain errors and the validation errors of gin bindings.
+// The message of internal domain errors and of any other error is not exposed.
+func NewProblemDetailsFromError(err error) *ProblemDetails {
+	status := HTTPStatus(err)
+
+	var validationErrs validator.ValidationErrors
+	if errors.As(err, &validationErrs) {
+		problem := NewProblemDetails(status, "The request is not valid")
+		problem.Key = "request.invalid"
+		for _, fieldErr := range validationErrs {
+			problem.Errors = append(problem.Errors, domain.FieldError{
+				Field:   fieldErr.Field(),
+				Message: fieldErr.Error(),
+				Key:     "validation." + fieldErr.Tag(),
+				Params:  map[string]any{"field": fieldErr.Field(), "param": fieldErr.Param()},
+			})
+		}
+		return problem
+	}
+
+	var domainErr *domain.DomainError
+	if errors.As(err, &domainErr) {
+		if status == http.StatusInternalServerError {
+			// Internal errors describe the server, only their key reaches the client.
+			return NewProblemDetails(status, http.StatusText(status)).WithKey(domainErr.Key, nil)
+		}
+		problem := NewProblemDetails(status, domainErr.Message)
+		problem.Key = domainErr.Key
+		problem.Errors = domainErr.Fields
+		problem.params = domainErr.Params
+		return problem
+	}
+
+	return NewProblemDetails(status, "")
+}
+
+// Localize translates the detail and the field errors having a key in the given language,
+// keeping the original messages when the catalog has none.
+func (p *ProblemDetails) Localize(catalog *i18n.Catalog, lang string) {
+	if p.Key != "" {
+		if message, ok := catalog.Translate(lang, p.Key, p.params); ok {
+			p.Detail = message
+		}
+	}
+	// The field errors may share their backing array with the original domain error.
+	p.Errors = append([]domain.FieldError(nil), p.Errors...)
+	for i, fieldErr := range p.Errors {
+		if fieldErr.Key == "" {
+			continue
+		}
+		if message, ok := catalog.Translate(lang, fieldErr.Key, fieldErr.Params); ok {
+			p.Errors[i].Message = message
+		}
+	}
+}
+
+// AbortWithProblem writes the problem document, completing its instance and correlation ID
+// from the request, localizing it when a message catalog is set, and aborts the handler chain.
+// The language is the one negotiated by the language middleware or else the Accept-Language header.
+func AbortWithProblem(c *gin.Context, problem *ProblemDetails) {
+	if catalog := currentMessageCatalog(); catalog != nil {
+		lang, ok := i18n.LanguageFromContext(c.Request.Context())
+		if !ok {
+			lang = catalog.Match(c.GetHeader("Accept-Language"))
+		}
+		problem.Localize(catalog, lang)
+		c.Header("Content-Language", lang)
+	}
+	if problem.Instance == "" {
+		problem.Instance = c.Request.URL.Path
+	}
+	if problem.CorrelationID == "" {
+		problem.CorrelationID = correlation.IDFromContext(c.Request.Context())
+	}
+	c.Header("Content-Type", ProblemContentType)
+	c.AbortWithStatusJSON(problem.Status, problem)
+}
+
+// AbortWithError converts the error with NewProblemDetailsFromError and writes it.
+func AbortWithError(c *gin.Context, err error) {
+	AbortWithProblem(c, NewProblemDetailsFromError(err))
+}
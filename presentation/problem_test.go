@@ -0,0 +1,67 @@
+package presentation
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/jperdior/chatbot-kit/application/i18n"
+	"github.com/jperdior/chatbot-kit/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProblemDetailsLocalize(t *testing.T) {
+	catalog, err := i18n.NewCatalog("en")
+	require.NoError(t, err)
+	require.NoError(t, catalog.Add("es", map[string]string{
+		"request.invalid":     "La petición no es válida",
+		"validation.required": "El campo {field} es obligatorio",
+	}))
+
+	shared := domain.NewValidationError("invalid request", "request.invalid", domain.FieldError{
+		Field:   "email",
+		Message: "email is required",
+		Key:     "validation.required",
+		Params:  map[string]any{"field": "email"},
+	})
+
+	t.Run("Localizing leaves the original error untouched", func(t *testing.T) {
+		problem := NewProblemDetailsFromError(shared)
+		problem.Localize(catalog, "es")
+
+		assert.Equal(t, "La petición no es válida", problem.Detail)
+		assert.Equal(t, "El campo email es obligatorio", problem.Errors[0].Message)
+		assert.Equal(t, "email is required", shared.Fields[0].Message)
+	})
+
+	t.Run("Shared errors can be localized concurrently", func(t *testing.T) {
+		var wg sync.WaitGroup
+		for _, lang := range []string{"es", "en", "es", "en"} {
+			wg.Add(1)
+			go func(lang string) {
+				defer wg.Done()
+				NewProblemDetailsFromError(shared).Localize(catalog, lang)
+			}(lang)
+		}
+		wg.Wait()
+
+		assert.Equal(t, "email is required", shared.Fields[0].Message)
+	})
+
+	t.Run("Internal errors map to 500", func(t *testing.T) {
+		err := domain.NewInternalError("specification cannot be converted", "specification.not_convertible")
+
+		assert.Equal(t, 500, HTTPStatus(err))
+	})
+
+	t.Run("Internal errors only expose their key", func(t *testing.T) {
+		err := domain.NewInternalError("specification cannot be converted", "specification.not_convertible")
+
+		problem := NewProblemDetailsFromError(err)
+
+		assert.Equal(t, 500, problem.Status)
+		assert.Equal(t, "Internal Server Error", problem.Detail)
+		assert.Equal(t, "specification.not_convertible", problem.Key)
+		assert.Empty(t, problem.Errors)
+	})
+}